@@ -1,42 +1,222 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/lsp"
 	"github.com/kirkegaard/cobutler/pkg/cobutler/models"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/rpc"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/tracing"
 )
 
 func main() {
-	// Set up logging
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	// `cobutler lsp` speaks the Language Server Protocol over stdio
+	lspMode := len(os.Args) > 1 && os.Args[1] == "lsp"
+
+	// Set up logging; stdout carries the protocol in LSP mode so log to stderr
+	logOutput := os.Stdout
+	if lspMode {
+		logOutput = os.Stderr
+	}
+	logger := slog.New(slog.NewTextHandler(logOutput, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	}))
 	slog.SetDefault(logger)
 
+	// COBUTLER_TRACING selects the trace exporter, "otlp" or "stdout"; tracing is off without it
+	shutdownTracing, err := tracing.Setup(context.Background(), os.Getenv("COBUTLER_TRACING"))
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize database connection with high performance settings
 	dbFile := "brain.db"
+
+	// COBUTLER_DURABILITY trades write speed for crash safety: "fast", "normal" or "full"
+	durability, err := db.ParseDurability(os.Getenv("COBUTLER_DURABILITY"))
+	if err != nil {
+		logger.Error("Invalid durability", "error", err)
+		os.Exit(1)
+	}
+	graphOptions := db.DefaultGraphOptions()
+	graphOptions.Durability = durability
+
+	// `cobutler stats` prints the size and contents of the brain and exits
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		if err := printStats(dbFile, os.Stdout); err != nil {
+			logger.Error("Failed to get stats", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logger.Info("Initializing brain", "database", dbFile)
 
 	// Create the brain - this will automatically use optimized settings
-	brain, err := models.NewBrain(dbFile)
+	brain, err := models.NewBrain(dbFile, graphOptions)
+	if errors.Is(err, db.ErrCorrupt) {
+		logger.Error("Brain database is corrupt; restore it from a backup or recover it with sqlite3's .recover command",
+			"database", dbFile, "error", err)
+		os.Exit(1)
+	}
 	if err != nil {
 		logger.Error("Failed to initialize brain", "error", err)
 		os.Exit(1)
 	}
 	defer brain.Close()
 
+	// Completions learned with a context are remembered in the brain's database
+	// and recalled before walking the graph
+	memory, err := models.NewCompletionMemory(brain.Graph(), 0, 0)
+	if err != nil {
+		logger.Error("Failed to open completion memory", "error", err)
+		os.Exit(1)
+	}
+	defer memory.Flush()
+
 	// Set up API handler with ultra-fast response method
 	handler := api.NewHandler(brain)
+	handler.Memory = memory
+	// Learned text is written in batches in the background, flushed when the
+	// server stops
+	handler.Queue = api.NewLearnQueue(brain, api.LearnQueueConfig{})
+
+	// Code templates are loaded from a directory and reloaded when it changes
+	templatesDir := "templates"
+	templates, err := models.NewTemplateStore(templatesDir)
+	if err != nil {
+		logger.Error("Failed to load templates", "dir", templatesDir, "error", err)
+		os.Exit(1)
+	}
+	go templates.Watch(context.Background(), 2*time.Second)
+	handler.Templates = templates
+
+	// COBUTLER_RATE_LIMITS points to a file of predict and learn rate limits,
+	// shared by the HTTP, session and gRPC APIs and the language server
+	var limits *api.RateLimiter
+	if limitsFile := os.Getenv("COBUTLER_RATE_LIMITS"); limitsFile != "" {
+		config, err := api.LoadRateLimitConfig(limitsFile)
+		if err != nil {
+			logger.Error("Failed to load rate limit config", "file", limitsFile, "error", err)
+			os.Exit(1)
+		}
+		limits = api.NewRateLimiter(config)
+	}
+
+	if lspMode {
+		logger.Info("Starting language server on stdio")
+		lspServer := lsp.NewServer(handler)
+		if limits != nil {
+			lspServer.RateLimit(limits)
+		}
+		if err := lspServer.Serve(os.Stdin, os.Stdout); err != nil {
+			logger.Error("Language server failed", "error", err)
+		}
+		// Lines queued while editing are learned before exiting
+		flushQueue(handler.Queue)
+		return
+	}
+
+	// COBUTLER_AUTH points to a file of API keys; without it the API is open
+	var auth *api.AuthConfig
+	if authFile := os.Getenv("COBUTLER_AUTH"); authFile != "" {
+		if auth, err = api.LoadAuthConfig(authFile); err != nil {
+			logger.Error("Failed to load auth config", "file", authFile, "error", err)
+			os.Exit(1)
+		}
+	}
 
-	// Configure and start HTTP server
-	http.HandleFunc("/predict", handler.Predict)
-	http.HandleFunc("/learn", handler.Learn)
+	// Keys with a namespace are served from that namespace's brain
+	namespaces, closeBrains, err := openNamespaces(handler, graphOptions, auth)
+	if err != nil {
+		logger.Error("Failed to open namespaces", "error", err)
+		os.Exit(1)
+	}
+	defer closeBrains()
+
+	// Configure and start HTTP server, wrapped in the default middleware
+	server, err := newServer(handler, "8080", auth, namespaces, limits)
+	if err != nil {
+		logger.Error("Failed to create server", "error", err)
+		os.Exit(1)
+	}
+	if err := server.Start(); err != nil {
+		logger.Error("Failed to start server", "error", err)
+		os.Exit(1)
+	}
+
+	// Long-lived editor sessions are served over JSON-RPC on a separate port.
+	// With auth, sessions send a key with session/authenticate first.
+	// COBUTLER_SESSION_ADDR sets where they listen, only locally by default.
+	sessionAddr := os.Getenv("COBUTLER_SESSION_ADDR")
+	if sessionAddr == "" {
+		sessionAddr = "localhost:8081"
+	}
+	sessionServer := api.NewSessionServer(handler, sessionAddr)
+	if auth != nil {
+		sessionServer.RequireAuth(auth, namespaces)
+	}
+	if limits != nil {
+		sessionServer.RateLimit(limits)
+	}
+	if err := sessionServer.Start(); err != nil {
+		logger.Error("Failed to start session server", "error", err)
+		os.Exit(1)
+	}
+
+	// Typed clients can use the gRPC API next to the HTTP handlers, with the
+	// same keys, TLS settings and rate limits. COBUTLER_GRPC_ADDR sets where it
+	// listens.
+	grpcAddr := os.Getenv("COBUTLER_GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	grpcServer, err := rpc.NewServer(handler, grpcAddr, rpc.Config{Auth: auth, Namespaces: namespaces, RateLimits: limits})
+	if err != nil {
+		logger.Error("Failed to create gRPC server", "error", err)
+		os.Exit(1)
+	}
+	if err := grpcServer.Start(); err != nil {
+		logger.Error("Failed to start gRPC server", "error", err)
+		os.Exit(1)
+	}
+
+	// Serve until interrupted, then let in-flight requests finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	if err := server.Stop(context.Background()); err != nil {
+		logger.Error("Failed to stop server", "error", err)
+	}
+	if err := sessionServer.Stop(context.Background()); err != nil {
+		logger.Error("Failed to stop session server", "error", err)
+	}
+	if err := grpcServer.Stop(context.Background()); err != nil {
+		logger.Error("Failed to stop gRPC server", "error", err)
+	}
+
+	// Every frontend has stopped, so nothing more can be queued. Texts accepted
+	// before shutdown are learned before the deferred calls flush the memories
+	// and close the brains, namespaces first.
+	flushQueue(handler.Queue)
+}
 
-	logger.Info("Starting server", "address", ":8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		logger.Error("Server failed", "error", err)
+// flushQueue closes queue, waiting a while for the texts in it to be learned
+func flushQueue(queue *api.LearnQueue) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := queue.Close(ctx); err != nil {
+		slog.Error("Failed to flush learn queue", "error", err)
 	}
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/models"
+)
+
+// openNamespaces opens the brain of every namespace in auth with graphOptions
+// and creates a handler for each, sharing handler's templates. The returned
+// function flushes the namespace learn queues and completion memories and closes
+// their brains.
+func openNamespaces(handler *api.Handler, graphOptions db.GraphOptions, auth *api.AuthConfig) (map[string]*api.Handler, func(), error) {
+	var brains []api.Brain
+	var queues []*api.LearnQueue
+	var memories []*models.CompletionMemory
+	closeBrains := func() {
+		for _, queue := range queues {
+			queue.Close(context.Background())
+		}
+		for _, memory := range memories {
+			memory.Flush()
+		}
+		for _, brain := range brains {
+			brain.Close()
+		}
+	}
+	if auth == nil {
+		return nil, closeBrains, nil
+	}
+
+	handlers := make(map[string]*api.Handler, len(auth.Namespaces))
+	for namespace, dbFile := range auth.Namespaces {
+		brain, err := models.NewBrain(dbFile, graphOptions)
+		if err != nil {
+			closeBrains()
+			return nil, nil, fmt.Errorf("failed to initialize brain for namespace %s: %w", namespace, err)
+		}
+		brains = append(brains, brain)
+
+		memory, err := models.NewCompletionMemory(brain.Graph(), 0, 0)
+		if err != nil {
+			closeBrains()
+			return nil, nil, fmt.Errorf("failed to open completion memory for namespace %s: %w", namespace, err)
+		}
+		memories = append(memories, memory)
+
+		namespaceHandler := api.NewHandler(brain)
+		namespaceHandler.Templates = handler.Templates
+		namespaceHandler.Memory = memory
+		namespaceHandler.Namespace = namespace
+		if handler.Queue != nil {
+			namespaceHandler.Queue = api.NewLearnQueue(brain, api.LearnQueueConfig{Namespace: namespace})
+			queues = append(queues, namespaceHandler.Queue)
+		}
+		handlers[namespace] = namespaceHandler
+	}
+	return handlers, closeBrains, nil
+}
+
+// newServer creates the HTTP API server on port. With an auth config requests
+// need an API key or client certificate, and keys with a namespace are served by
+// that namespace's handler. Rate limits apply per key, or per IP address without
+// auth.
+func newServer(handler *api.Handler, port string, auth *api.AuthConfig, namespaces map[string]*api.Handler, limits *api.RateLimiter) (*api.Server, error) {
+	middleware := api.DefaultMiddleware()
+	if auth != nil {
+		middleware = append(middleware, api.Auth(auth))
+	}
+	if limits != nil {
+		middleware = append(middleware, limits.Middleware)
+	}
+	if auth == nil {
+		return api.NewServer(handler, port, middleware...), nil
+	}
+
+	muxes := make(map[string]http.Handler, len(namespaces))
+	for namespace, namespaceHandler := range namespaces {
+		mux := http.NewServeMux()
+		namespaceHandler.SetupRoutes(mux)
+		muxes[namespace] = mux
+	}
+	middleware = append(middleware, api.Namespaces(muxes))
+
+	server := api.NewServer(handler, port, middleware...)
+	if auth.TLS.CertFile != "" {
+		if err := server.UseTLS(auth.TLS); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
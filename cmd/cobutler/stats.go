@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// printStats opens the brain database at dbFile and prints the same stats as
+// GET /stats in a readable form
+func printStats(dbFile string, out io.Writer) error {
+	graph, err := db.NewGraph(dbFile, db.GraphOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer graph.Close()
+
+	stats, err := graph.Stats(db.StatsTop)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Database\t%s\n", dbFile)
+	fmt.Fprintf(w, "Order\t%d\n", stats.Order)
+	fmt.Fprintf(w, "Tokenizer\t%s\n", stats.Tokenizer)
+	fmt.Fprintf(w, "Tokens\t%d\n", stats.Tokens)
+	fmt.Fprintf(w, "Nodes\t%d\n", stats.Nodes)
+	fmt.Fprintf(w, "Edges\t%d\n", stats.Edges)
+	fmt.Fprintf(w, "Edge weight\t%d\n", stats.EdgeWeight)
+	fmt.Fprintf(w, "File size\t%d bytes\n", stats.FileSize)
+	fmt.Fprintf(w, "WAL size\t%d bytes\n", stats.WALSize)
+
+	fmt.Fprintln(w, "\nTop tokens\tCount")
+	for _, f := range stats.TopTokens {
+		fmt.Fprintf(w, "%q\t%d\n", f.Text, f.Count)
+	}
+	fmt.Fprintln(w, "\nTop n-grams\tCount")
+	for _, f := range stats.TopNgrams {
+		fmt.Fprintf(w, "%q\t%d\n", f.Text, f.Count)
+	}
+
+	return w.Flush()
+}
@@ -3,6 +3,17 @@ local curl = require('plenary.curl')
 local config = require('cobutler.config')
 local util = require('cobutler.util')
 
+-- Request headers, with the API key when one is configured
+local function headers()
+  local h = {
+    content_type = "application/json",
+  }
+  if not util.is_empty(config.options.api_key) then
+    h.authorization = "Bearer " .. config.options.api_key
+  end
+  return h
+end
+
 -- Validate that the Cobutler API is accessible
 function M.setup()
   vim.schedule(function()
@@ -14,13 +25,11 @@ end
 function M.check_connection()
   local ok, result = pcall(function()
     return curl.post(config.options.api_url .. "/predict", {
-      headers = {
-        content_type = "application/json",
-      },
+      headers = headers(),
       body = vim.fn.json_encode({ 
         text = "test connection",
         max_words = config.options.max_reply_length,
-        precision = config.options.precision_rating
+        temperature = config.options.temperature
       }),
       timeout = 3000,
     })
@@ -42,14 +51,14 @@ function M.get_completion(context, callback)
   vim.schedule(function()
     local ok, result = pcall(function()
       return curl.post(config.options.api_url .. "/predict", {
-        headers = {
-          content_type = "application/json",
-        },
+        headers = headers(),
         body = vim.fn.json_encode({ 
           text = sanitized_context,
           max_words = config.options.max_reply_length,
-          precision = config.options.precision_rating,
+          temperature = config.options.temperature,
           use_cache = config.options.use_cache,
+          mode = config.options.mode,
+          stop = config.options.stop,
           debug = config.options.debug
         }),
         timeout = 5000,
@@ -73,11 +82,38 @@ function M.get_completion(context, callback)
     end
 
     vim.schedule(function()
-      callback(response.reply)
+      callback(response.reply, nil, response.id, response.replace or 0)
     end)
   end)
 end
 
+-- Report whether a completion was accepted, rejected or partially accepted
+function M.feedback(id, outcome, accepted)
+  if util.is_empty(id) then
+    return
+  end
+
+  vim.schedule(function()
+    local ok, result = pcall(function()
+      return curl.post(config.options.api_url .. "/feedback", {
+        headers = headers(),
+        body = vim.fn.json_encode({
+          id = id,
+          outcome = outcome,
+          accepted = accepted,
+        }),
+        timeout = 5000,
+      })
+    end)
+
+    if not ok or (result and result.status >= 400) then
+      if config.options.debug then
+        vim.notify("Failed to send feedback to API", vim.log.levels.DEBUG)
+      end
+    end
+  end)
+end
+
 -- Learn from text
 function M.learn(text, context)
   -- Sanitize the text and context
@@ -87,9 +123,7 @@ function M.learn(text, context)
   vim.schedule(function()
     local ok, result = pcall(function()
       return curl.post(config.options.api_url .. "/learn", {
-        headers = {
-          content_type = "application/json",
-        },
+        headers = headers(),
         body = vim.fn.json_encode({ 
           text = sanitized_text,
           context = sanitized_context,
@@ -4,9 +4,12 @@ local M = {}
 M.defaults = {
   -- API settings
   api_url = "http://localhost:8080",
+  api_key = nil, -- Sent as a bearer token when the server requires authentication
   max_reply_length = 5, -- Maximum number of words in the reply
-  precision_rating = 0.7, -- Controls precision of responses (0.0-1.0, higher = more focused)
+  temperature = 1.0, -- Randomness of replies (0 = always the most frequent continuation)
   use_cache = false, -- Whether to use token caching (disable to avoid repetition)
+  mode = "continue", -- "continue" completes the text at the cursor, "reply" replies to it
+  stop = { "scope" }, -- Where replies end: "line", "statement", "scope" or "sentence"
   debug = false, -- Enable debug logging on the server side
   
   -- Plugin behavior
@@ -54,9 +57,8 @@ M.options = {}
 function M.setup(opts)
   M.options = vim.tbl_deep_extend("force", {}, M.defaults, opts or {})
   
-  -- Clamp precision rating to valid range
-  if M.options.precision_rating < 0 then M.options.precision_rating = 0 end
-  if M.options.precision_rating > 1 then M.options.precision_rating = 1 end
+  -- Temperatures below zero make no sense
+  if M.options.temperature < 0 then M.options.temperature = 0 end
 end
 
 return M 
\ No newline at end of file
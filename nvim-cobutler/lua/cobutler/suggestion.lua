@@ -5,6 +5,9 @@ local util = require('cobutler.util')
 
 local ns_id = vim.api.nvim_create_namespace('cobutler')
 local current_suggestion = nil
+local current_completion_id = nil
+local current_replace = 0
+local current_context = nil
 local current_buffer = nil
 local active_extmark = nil
 local current_line = nil
@@ -39,12 +42,15 @@ local function clear_suggestion()
   end
   
   current_suggestion = nil
+  current_completion_id = nil
+  current_replace = 0
+  current_context = nil
   current_buffer = nil
   current_line = nil
 end
 
 -- Display suggestion as virtual text
-local function display_suggestion(bufnr, line, suggestion_text)
+local function display_suggestion(bufnr, line, suggestion_text, completion_id, context, replace)
   if util.is_empty(suggestion_text) then
     return
   end
@@ -55,6 +61,9 @@ local function display_suggestion(bufnr, line, suggestion_text)
   -- Store current buffer and suggestion
   current_buffer = bufnr
   current_suggestion = suggestion_text
+  current_completion_id = completion_id
+  current_replace = replace or 0
+  current_context = context
   current_line = line
   
   -- Split suggestion into lines
@@ -178,13 +187,13 @@ local function request_suggestion()
   local context = get_context(bufnr, row, col)
   
   -- Request completion
-  api.get_completion(context, function(completion, err)
+  api.get_completion(context, function(completion, err, completion_id, replace)
     if err or not completion then
       return
     end
     
     -- Display the suggestion
-    display_suggestion(bufnr, row, completion)
+    display_suggestion(bufnr, row, completion, completion_id, context, replace)
   end)
 end
 
@@ -201,8 +210,12 @@ function M.accept_suggestion()
   
   -- Save needed variables before clearing
   local suggestion_to_insert = current_suggestion
+  local completion_id = current_completion_id
+  -- Snippets can replace the trigger typed before the cursor
+  local replace = current_replace
   local buffer_to_modify = current_buffer
-  local original_context = get_context(current_buffer, current_line, 0)
+  -- Use the context the suggestion was generated for so the server remembers it under the same key
+  local original_context = current_context or get_context(current_buffer, current_line, 0)
   
   -- Clear the suggestion before modifying buffer
   clear_suggestion()
@@ -222,17 +235,21 @@ function M.accept_suggestion()
     -- Get the current line
     local line = vim.api.nvim_buf_get_lines(buffer_to_modify, row, row + 1, false)[1] or ""
     
-    -- Create the new line with the suggestion inserted at cursor position
-    local new_line = line:sub(1, col) .. suggestion_to_insert .. line:sub(col + 1)
+    -- Create the new lines with the suggestion inserted at cursor position
+    local before = line:sub(1, math.max(0, col - replace))
+    local new_lines = vim.split(before .. suggestion_to_insert, "\n")
+    local last_col = #new_lines[#new_lines]
+    new_lines[#new_lines] = new_lines[#new_lines] .. line:sub(col + 1)
     
-    -- Replace the current line with the new one
-    vim.api.nvim_buf_set_lines(buffer_to_modify, row, row + 1, false, {new_line})
+    -- Replace the current line with the new ones
+    vim.api.nvim_buf_set_lines(buffer_to_modify, row, row + 1, false, new_lines)
     
     -- Move cursor to end of inserted text
-    vim.api.nvim_win_set_cursor(0, {row + 1, col + #suggestion_to_insert})
+    vim.api.nvim_win_set_cursor(0, {row + #new_lines, last_col})
     
     -- Learn from what was accepted, passing the original context
     api.learn(suggestion_to_insert, original_context)
+    api.feedback(completion_id, "accepted")
   end)
   
   return true
@@ -281,6 +298,7 @@ local function setup_autocmds()
   -- Dismiss keymap
   vim.keymap.set('i', config.options.keymaps.dismiss, function()
     if current_suggestion then
+      api.feedback(current_completion_id, "rejected")
       clear_suggestion()
     else
       -- Pass through the key
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scopes an API key can be granted
+const (
+	// ScopePredict allows generating and inspecting replies
+	ScopePredict = "predict"
+	// ScopeLearn allows learning text and sending feedback
+	ScopeLearn = "learn"
+	// ScopeAdmin allows everything, including templates, stats and metrics
+	ScopeAdmin = "admin"
+)
+
+// APIKey is a client allowed to use the API
+type APIKey struct {
+	// Name identifies the client in logs
+	Name string `yaml:"name"`
+	// Key is sent as a bearer token or in the X-API-Key header
+	Key string `yaml:"key"`
+	// CommonName authenticates clients presenting a verified certificate with
+	// this subject common name instead of a key
+	CommonName string   `yaml:"common_name"`
+	Scopes     []string `yaml:"scopes"`
+	// Namespace selects the brain the client's requests are served from. The
+	// default brain is used when it is empty.
+	Namespace string `yaml:"namespace"`
+}
+
+// HasScope reports whether the key was granted scope
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// TLSConfig configures HTTPS and client certificates
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile verifies client certificates, which authenticate clients by
+	// their common name
+	ClientCAFile string `yaml:"client_ca_file"`
+	// RequireClientCert rejects connections without a verified client
+	// certificate, so keys alone are not enough
+	RequireClientCert bool `yaml:"require_client_cert"`
+}
+
+// AuthConfig configures who may use the API
+type AuthConfig struct {
+	Keys []APIKey  `yaml:"keys"`
+	TLS  TLSConfig `yaml:"tls"`
+	// Namespaces maps the namespaces keys can use to brain database files
+	Namespaces map[string]string `yaml:"namespaces"`
+}
+
+// LoadAuthConfig reads and validates an auth config file
+func LoadAuthConfig(path string) (*AuthConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auth config: %w", err)
+	}
+
+	var config AuthConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse auth config: %w", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+	return &config, nil
+}
+
+// validate checks that every key can authenticate and only uses known scopes
+// and namespaces
+func (c *AuthConfig) validate() error {
+	names := make(map[string]bool, len(c.Keys))
+	for i, key := range c.Keys {
+		// Rate limits and logs tell clients apart by name
+		if key.Name == "" {
+			return fmt.Errorf("key %d has no name", i)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("key %d has the same name as another key: %s", i, key.Name)
+		}
+		names[key.Name] = true
+
+		if key.Key == "" && key.CommonName == "" {
+			return fmt.Errorf("key %d (%s) has neither a key nor a common name", i, key.Name)
+		}
+		for _, scope := range key.Scopes {
+			if scope != ScopePredict && scope != ScopeLearn && scope != ScopeAdmin {
+				return fmt.Errorf("key %d (%s) has unknown scope %q", i, key.Name, scope)
+			}
+		}
+		if _, ok := c.Namespaces[key.Namespace]; key.Namespace != "" && !ok {
+			return fmt.Errorf("key %d (%s) has unknown namespace %q", i, key.Name, key.Namespace)
+		}
+	}
+	return nil
+}
+
+// ScopeForPath returns the scope needed to request path
+func ScopeForPath(path string) string {
+	switch {
+	case path == "/learn", path == "/feedback":
+		return ScopeLearn
+	case strings.HasPrefix(path, "/admin/"), path == "/stats", path == "/metrics":
+		return ScopeAdmin
+	default:
+		return ScopePredict
+	}
+}
+
+// Auth rejects requests without a known key or verified client certificate with
+// 401, and requests for a path outside the key's scopes with 403. The request's
+// context carries the key and its logger includes the key's name.
+func Auth(config *AuthConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := config.authenticate(r)
+			if !ok {
+				Logger(r.Context()).Warn("Unauthenticated request", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			logger := Logger(r.Context()).With("key", key.Name)
+			if scope := ScopeForPath(r.URL.Path); !key.HasScope(scope) {
+				logger.Warn("Key lacks scope", "path", r.URL.Path, "scope", scope)
+				writeError(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			ctx := WithAPIKey(r.Context(), key)
+			ctx = context.WithValue(ctx, loggerKey, logger)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authenticate finds the key for a request's bearer token or X-API-Key header,
+// falling back to its verified client certificate
+func (c *AuthConfig) authenticate(r *http.Request) (APIKey, bool) {
+	token := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	if token != "" {
+		return c.AuthenticateToken(token)
+	}
+
+	if r.TLS != nil {
+		return c.AuthenticateCertificate(r.TLS.VerifiedChains)
+	}
+	return APIKey{}, false
+}
+
+// AuthenticateToken finds the key with token
+func (c *AuthConfig) AuthenticateToken(token string) (APIKey, bool) {
+	if token == "" {
+		return APIKey{}, false
+	}
+
+	// Every key is compared so the time taken doesn't reveal which matched
+	var found APIKey
+	ok := false
+	for _, key := range c.Keys {
+		if key.Key != "" && subtle.ConstantTimeCompare([]byte(key.Key), []byte(token)) == 1 {
+			found, ok = key, true
+		}
+	}
+	return found, ok
+}
+
+// AuthenticateCertificate finds the key with the common name of a verified client
+// certificate
+func (c *AuthConfig) AuthenticateCertificate(verifiedChains [][]*x509.Certificate) (APIKey, bool) {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return APIKey{}, false
+	}
+
+	commonName := verifiedChains[0][0].Subject.CommonName
+	for _, key := range c.Keys {
+		if key.CommonName != "" && key.CommonName == commonName {
+			return key, true
+		}
+	}
+	return APIKey{}, false
+}
+
+// WithAPIKey returns a context carrying key, for servers authenticating outside
+// of Auth
+func WithAPIKey(ctx context.Context, key APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey, key)
+}
+
+// APIKeyFromContext returns the key Auth authenticated the request with, if any
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey).(APIKey)
+	return key, ok
+}
+
+// Namespaces serves requests whose key has a namespace from that namespace's
+// handler, usually a mux set up with SetupRoutes for the namespace's brain. Other
+// requests go to the next handler. It must come after Auth.
+func Namespaces(handlers map[string]http.Handler) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, _ := APIKeyFromContext(r.Context())
+			if key.Namespace == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			handler, ok := handlers[key.Namespace]
+			if !ok {
+				Logger(r.Context()).Error("No brain for namespace", "namespace", key.Namespace)
+				writeError(w, r, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ServerTLSConfig builds the TLS settings for servers that don't load the
+// certificate themselves, such as the gRPC server
+func (c TLSConfig) ServerTLSConfig() (*tls.Config, error) {
+	config, err := c.serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	config.Certificates = []tls.Certificate{cert}
+	return config, nil
+}
+
+// serverTLSConfig builds the TLS settings for HTTPS, verifying client
+// certificates when a client CA is configured
+func (c TLSConfig) serverTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.ClientCAFile == "" {
+		if c.RequireClientCert {
+			return nil, fmt.Errorf("client certificates are required but no client CA is configured")
+		}
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if c.RequireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	config := &AuthConfig{
+		Keys: []APIKey{
+			{Name: "editor", Key: "editor-key", Scopes: []string{ScopePredict}},
+			{Name: "ops", Key: "ops-key", Scopes: []string{ScopeAdmin}},
+			{Name: "ci", CommonName: "ci.example.com", Scopes: []string{ScopeLearn}},
+		},
+	}
+	var seen APIKey
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = APIKeyFromContext(r.Context())
+	}), RequestID, Auth(config))
+
+	certificate := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "ci.example.com"}},
+	}}}
+
+	tests := []struct {
+		name    string
+		path    string
+		header  string
+		value   string
+		tls     *tls.ConnectionState
+		want    int
+		wantKey string
+	}{
+		{name: "no key", path: "/predict", want: http.StatusUnauthorized},
+		{name: "unknown key", path: "/predict", header: "Authorization", value: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "bearer token", path: "/predict", header: "Authorization", value: "Bearer editor-key", want: http.StatusOK, wantKey: "editor"},
+		{name: "api key header", path: "/predict", header: "X-API-Key", value: "editor-key", want: http.StatusOK, wantKey: "editor"},
+		{name: "missing scope", path: "/learn", header: "X-API-Key", value: "editor-key", want: http.StatusForbidden},
+		{name: "admin has every scope", path: "/learn", header: "X-API-Key", value: "ops-key", want: http.StatusOK, wantKey: "ops"},
+		{name: "client certificate", path: "/learn", tls: certificate, want: http.StatusOK, wantKey: "ci"},
+		{name: "client certificate scope", path: "/admin/templates", tls: certificate, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = APIKey{}
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			req.TLS = tt.tls
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if seen.Name != tt.wantKey {
+				t.Errorf("Expected key %q, got %q", tt.wantKey, seen.Name)
+			}
+		})
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	config := &AuthConfig{
+		Keys: []APIKey{
+			{Name: "team", Key: "team-key", Scopes: []string{ScopePredict}, Namespace: "team"},
+			{Name: "default", Key: "default-key", Scopes: []string{ScopePredict}},
+		},
+		Namespaces: map[string]string{"team": "team.db"},
+	}
+	served := ""
+	namespaces := map[string]http.Handler{
+		"team": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served = "team" }),
+	}
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = "default"
+	}), Auth(config), Namespaces(namespaces))
+
+	for key, want := range map[string]string{"team-key": "team", "default-key": "default"} {
+		req := httptest.NewRequest(http.MethodPost, "/predict", nil)
+		req.Header.Set("X-API-Key", key)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if served != want {
+			t.Errorf("Expected %s to be served from %q, got %q", key, want, served)
+		}
+	}
+}
+
+func TestLoadAuthConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		return path
+	}
+
+	config, err := LoadAuthConfig(write("valid.yaml", `
+keys:
+  - name: editor
+    key: s3cret
+    scopes: [predict, learn]
+    namespace: team
+namespaces:
+  team: team.db
+`))
+	if err != nil {
+		t.Fatalf("LoadAuthConfig failed: %v", err)
+	}
+	if len(config.Keys) != 1 || !config.Keys[0].HasScope(ScopeLearn) || config.Namespaces["team"] != "team.db" {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+
+	invalid := map[string]string{
+		"unknown scope":     "keys:\n  - name: a\n    key: k\n    scopes: [write]\n",
+		"unknown namespace": "keys:\n  - name: a\n    key: k\n    namespace: team\n",
+		"no credentials":    "keys:\n  - name: a\n    scopes: [predict]\n",
+		"no name":           "keys:\n  - key: k\n    scopes: [predict]\n",
+		"duplicate name":    "keys:\n  - name: a\n    key: k\n  - name: a\n    key: l\n",
+	}
+	for name, content := range invalid {
+		_, err := LoadAuthConfig(write(strings.ReplaceAll(name, " ", "-")+".yaml", content))
+		if err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// defaultNeighbors is how many successors and predecessors /graph/token lists
+const defaultNeighbors = 20
+
+// Explanation is a reply with the walk that produced it
+type Explanation struct {
+	Reply string `json:"reply"`
+	// Pivot is the token the walk started from
+	Pivot string `json:"pivot"`
+	// EdgeIDs are the edges walked, as returned by SearchRandomWalk
+	EdgeIDs []int     `json:"edge_ids"`
+	Steps   []db.Step `json:"steps"`
+	Score   float64   `json:"score"`
+	// Seed reproduces the reply when sent with the same request
+	Seed int64 `json:"seed"`
+}
+
+// ExplainingBrain is implemented by brains that can report how a reply was
+// generated. Replies are explained as generated, before post-processing.
+type ExplainingBrain interface {
+	Explain(ctx context.Context, text string, sampling db.Sampling) (Explanation, error)
+}
+
+// GraphBrain is implemented by brains that can list the neighbors of a token
+type GraphBrain interface {
+	TokenNeighbors(ctx context.Context, text string, limit int) (db.Neighbors, error)
+}
+
+// Explain handles POST /explain, generating a reply like /predict and returning
+// the walk behind it
+func (h *Handler) Explain(w http.ResponseWriter, r *http.Request) {
+	log := Logger(r.Context())
+
+	if r.Method != http.MethodPost {
+		log.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req RequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, err)
+		return
+	}
+
+	explainer, ok := h.Brain.(ExplainingBrain)
+	if !ok {
+		log.Warn("Brain does not explain replies")
+		writeError(w, r, http.StatusNotImplemented, "Explain not supported")
+		return
+	}
+
+	sampling, seed := newSampling(req)
+	_, processedText := extractCodeMetadata(req.Text)
+	explanation, err := explainer.Explain(r.Context(), processedText, sampling)
+	if err != nil {
+		log.Error("Failed to explain reply", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to explain reply")
+		return
+	}
+	explanation.Seed = seed
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(explanation)
+
+	log.Info("Explain request succeeded", "pivot", explanation.Pivot, "edges", len(explanation.EdgeIDs), "seed", seed)
+}
+
+// GraphToken handles GET /graph/token/{text}, listing the tokens learned after
+// and before a token with their counts
+func (h *Handler) GraphToken(w http.ResponseWriter, r *http.Request) {
+	log := Logger(r.Context())
+
+	if r.Method != http.MethodGet {
+		log.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	limit := defaultNeighbors
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Warn("Invalid limit", "limit", v)
+			writeError(w, r, http.StatusBadRequest, "Invalid request")
+			return
+		}
+		limit = n
+	}
+
+	graph, ok := h.Brain.(GraphBrain)
+	if !ok {
+		log.Warn("Brain does not list token neighbors")
+		writeError(w, r, http.StatusNotImplemented, "Graph not supported")
+		return
+	}
+
+	text := r.PathValue("text")
+	neighbors, err := graph.TokenNeighbors(r.Context(), text, limit)
+	if errors.Is(err, db.ErrUnknownToken) {
+		writeError(w, r, http.StatusNotFound, "Unknown token")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to get token neighbors", "token", text, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to get token neighbors")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(neighbors)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// explainingBrain is a mock brain that explains replies and lists neighbors
+type explainingBrain struct {
+	mockBrain
+}
+
+func (b *explainingBrain) Explain(ctx context.Context, text string, sampling db.Sampling) (Explanation, error) {
+	return Explanation{Reply: "err", Pivot: "if", EdgeIDs: []int{4, 2}, Score: 1.5}, nil
+}
+
+func (b *explainingBrain) TokenNeighbors(ctx context.Context, text string, limit int) (db.Neighbors, error) {
+	if text != "a/b" {
+		return db.Neighbors{}, db.ErrUnknownToken
+	}
+	return db.Neighbors{Token: text, Successors: []db.Frequency{{Text: "c", Count: int64(limit)}}}, nil
+}
+
+func TestExplain(t *testing.T) {
+	mux := http.NewServeMux()
+	(&Handler{Brain: &explainingBrain{}}).SetupRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/explain", strings.NewReader(`{"text":"if","seed":7}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var explanation Explanation
+	if err := json.NewDecoder(rec.Body).Decode(&explanation); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if explanation.Pivot != "if" || len(explanation.EdgeIDs) != 2 || explanation.Seed != 7 {
+		t.Errorf("Unexpected explanation: %+v", explanation)
+	}
+}
+
+func TestGraphToken(t *testing.T) {
+	mux := http.NewServeMux()
+	(&Handler{Brain: &explainingBrain{}}).SetupRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graph/token/a/b?limit=3", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var neighbors db.Neighbors
+	if err := json.NewDecoder(rec.Body).Decode(&neighbors); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if neighbors.Token != "a/b" || len(neighbors.Successors) != 1 || neighbors.Successors[0].Count != 3 {
+		t.Errorf("Unexpected neighbors: %+v", neighbors)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graph/token/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
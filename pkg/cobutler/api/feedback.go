@@ -0,0 +1,223 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+)
+
+// Feedback outcomes accepted by the /feedback endpoint
+const (
+	OutcomeAccepted = "accepted"
+	OutcomeRejected = "rejected"
+	OutcomePartial  = "partial"
+)
+
+const (
+	// completionTTL is how long a completion ID can receive feedback
+	completionTTL = 10 * time.Minute
+	// maxCompletions caps how many completions are remembered for feedback
+	maxCompletions = 10000
+)
+
+// FeedbackBrain is implemented by brains that can reinforce or penalize completions.
+// edgeIDs are the edges of the walk that produced a completion; a positive delta
+// boosts their counts and a negative delta down-weights them.
+type FeedbackBrain interface {
+	Reinforce(edgeIDs []int, delta int) error
+}
+
+// FeedbackPayload represents an incoming feedback request
+type FeedbackPayload struct {
+	ID      string `json:"id"`
+	Outcome string `json:"outcome"`
+	// Accepted is the accepted prefix of the completion for partial outcomes
+	Accepted string `json:"accepted,omitempty"`
+}
+
+// FeedbackStats reports how often completions are accepted
+type FeedbackStats struct {
+	Accepted       int64   `json:"accepted"`
+	Rejected       int64   `json:"rejected"`
+	Partial        int64   `json:"partial"`
+	AcceptanceRate float64 `json:"acceptance_rate"`
+}
+
+// feedbackCounters tracks feedback outcomes
+type feedbackCounters struct {
+	accepted atomic.Int64
+	rejected atomic.Int64
+	partial  atomic.Int64
+}
+
+// stats returns the current counts and acceptance rate.
+// Partial acceptances count as accepted for the rate.
+func (c *feedbackCounters) stats() FeedbackStats {
+	stats := FeedbackStats{
+		Accepted: c.accepted.Load(),
+		Rejected: c.rejected.Load(),
+		Partial:  c.partial.Load(),
+	}
+	if total := stats.Accepted + stats.Rejected + stats.Partial; total > 0 {
+		stats.AcceptanceRate = float64(stats.Accepted+stats.Partial) / float64(total)
+	}
+	return stats
+}
+
+// completion is a reply handed out by /predict that can still receive feedback.
+// edgeIDs are the edges of the walk that produced it, empty for snippets and
+// brains that don't report their walks.
+type completion struct {
+	reply   string
+	edgeIDs []int
+	created time.Time
+}
+
+// completionStore remembers recent completions by ID, evicting the oldest
+// entries once it is full and ignoring entries older than completionTTL
+type completionStore struct {
+	mu      sync.Mutex
+	entries map[string]completion
+	order   []string
+}
+
+// newCompletionStore creates an empty completion store
+func newCompletionStore() *completionStore {
+	return &completionStore{
+		entries: make(map[string]completion),
+	}
+}
+
+// add stores a completion and returns its ID
+func (s *completionStore) add(reply string, edgeIDs []int) string {
+	id := newID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.order) >= maxCompletions {
+		delete(s.entries, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	s.entries[id] = completion{reply: reply, edgeIDs: edgeIDs, created: time.Now()}
+	s.order = append(s.order, id)
+	return id
+}
+
+// take removes and returns the completion with the given ID
+func (s *completionStore) take(id string) (completion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.entries[id]
+	if !ok {
+		return completion{}, false
+	}
+	delete(s.entries, id)
+
+	if time.Since(c.created) > completionTTL {
+		return completion{}, false
+	}
+	return c, true
+}
+
+// newID returns a random hex ID for completions and requests
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Feedback handles accept/reject feedback for completions returned by Predict.
+// GET returns the acceptance statistics.
+func (h *Handler) Feedback(w http.ResponseWriter, r *http.Request) {
+	log := Logger(r.Context())
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.feedback.stats())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		log.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req FeedbackPayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		decodeError(w, r, err)
+		return
+	}
+
+	if req.Outcome != OutcomeAccepted && req.Outcome != OutcomeRejected && req.Outcome != OutcomePartial {
+		log.Warn("Invalid feedback outcome", "outcome", req.Outcome)
+		writeError(w, r, http.StatusBadRequest, "Invalid outcome")
+		return
+	}
+
+	c, ok := h.completionStore().take(req.ID)
+	if !ok {
+		log.Warn("Unknown or expired completion", "id", req.ID)
+		writeError(w, r, http.StatusNotFound, "Unknown completion")
+		return
+	}
+
+	log.Info("Received feedback", "id", req.ID, "outcome", req.Outcome)
+	metrics.ObserveFeedback(req.Outcome, req.Outcome != OutcomeRejected)
+
+	edgeIDs, delta := c.edgeIDs, 1
+	switch req.Outcome {
+	case OutcomeAccepted:
+		h.feedback.accepted.Add(1)
+	case OutcomeRejected:
+		h.feedback.rejected.Add(1)
+		delta = -1
+	case OutcomePartial:
+		h.feedback.partial.Add(1)
+		edgeIDs = acceptedEdges(c, req.Accepted)
+	}
+
+	if reinforcer, ok := h.Brain.(FeedbackBrain); ok && len(edgeIDs) > 0 {
+		if err := reinforcer.Reinforce(edgeIDs, delta); err != nil {
+			log.Error("Failed to apply feedback", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Failed to apply feedback")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	log.Info("Feedback request succeeded")
+}
+
+// acceptedEdges returns the edges that produced the accepted prefix of a
+// completion. The walk emits about one word per edge, so the edges are cut in
+// proportion to the words kept; post-processing may have changed the reply.
+func acceptedEdges(c completion, accepted string) []int {
+	kept := len(strings.Fields(accepted))
+	total := len(strings.Fields(c.reply))
+	if kept == 0 || total == 0 {
+		return nil
+	}
+	if kept >= total {
+		return c.edgeIDs
+	}
+	return c.edgeIDs[:len(c.edgeIDs)*kept/total]
+}
+
+// completionStore returns the handler's completion store, creating it on first use
+func (h *Handler) completionStore() *completionStore {
+	h.completionsOnce.Do(func() {
+		h.completions = newCompletionStore()
+	})
+	return h.completions
+}
@@ -1,12 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
-	"math/rand"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/models"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/syntax"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/tracing"
 )
 
 // Brain defines the interface required by the API handlers
@@ -19,23 +29,92 @@ type Brain interface {
 	Close() error
 }
 
+// CompletionRecaller is implemented by brains that remember completions passed to
+// RememberCompletion. A recalled completion is returned instead of a random walk.
+type CompletionRecaller interface {
+	RecallCompletion(context string) (string, bool)
+}
+
+// CompletionMemory remembers completions learned with a context and recalls them
+// for later predictions in that context, like models.CompletionMemory
+type CompletionMemory interface {
+	RememberCompletion(context, completion string)
+	CompletionRecaller
+}
+
+// ForgettingBrain is implemented by brains that can unlearn previously learned text
+type ForgettingBrain interface {
+	Forget(text string) error
+}
+
 // RequestPayload represents the incoming JSON request
 type RequestPayload struct {
-	Text      string  `json:"text"`
-	MaxWords  int     `json:"max_words,omitempty"`
-	Precision float64 `json:"precision,omitempty"`
-	Context   string  `json:"context,omitempty"`
-	UseCache  bool    `json:"use_cache,omitempty"`
+	Text     string `json:"text"`
+	MaxWords int    `json:"max_words,omitempty"`
+	Context  string `json:"context,omitempty"`
+	UseCache bool   `json:"use_cache,omitempty"`
+	// Temperature weights the walk's edge choices by count; 0 always takes the
+	// most frequent edge. Defaults to DefaultTemperature.
+	Temperature *float64 `json:"temperature,omitempty"`
+	// Deprecated: Precision is ignored since replies are weighted by Temperature.
+	// It is still decoded so requests sending it can be warned about.
+	Precision *float64 `json:"precision,omitempty"`
+	// Stop lists the conditions that end a reply: "line", "statement", "scope" or "sentence"
+	Stop []string `json:"stop,omitempty"`
+	// MaxTokens ends a reply after this many generated words
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// Seed makes the reply reproducible; without it a random seed is used
+	Seed *int64 `json:"seed,omitempty"`
+	// Strategy is "walk" for a random walk or "beam" for the most likely reply
+	Strategy string `json:"strategy,omitempty"`
+	// BeamWidth is how many sequences beam search keeps. Defaults to DefaultBeamWidth.
+	BeamWidth int `json:"beam_width,omitempty"`
+	// LengthNormalize makes beam search rank replies by their mean rather than
+	// total log-probability, so longer replies aren't penalized for their length
+	LengthNormalize bool `json:"length_normalize,omitempty"`
+	// Mode is "reply" to reply to the text or "continue" to complete it from its end
+	Mode string `json:"mode,omitempty"`
 }
 
 // ResponsePayload represents the outgoing JSON response
 type ResponsePayload struct {
 	Reply string `json:"reply"`
+	// ID identifies the completion when sending feedback
+	ID string `json:"id,omitempty"`
+	// Kind is "snippet" when the reply comes from a code template
+	Kind string `json:"kind,omitempty"`
+	// Snippet is the reply in snippet syntax with tab stops when Kind is "snippet"
+	Snippet string `json:"snippet,omitempty"`
+	// Replace is how many bytes before the cursor the snippet replaces
+	Replace int `json:"replace,omitempty"`
+	// FinishReason tells why generation stopped, e.g. "statement" or "dead_end"
+	FinishReason string `json:"finish_reason,omitempty"`
+	// Seed reproduces the reply when sent back with the same request. It is left
+	// out when the brain can't seed replies.
+	Seed int64 `json:"seed,omitempty"`
 }
 
+// KindSnippet marks a reply that comes from a code template
+const KindSnippet = "snippet"
+
 // Handler contains the HTTP handlers for the API
 type Handler struct {
 	Brain Brain
+	// Templates are offered as snippets; nil uses the built-in templates
+	Templates *models.TemplateStore
+	// Queue learns /learn requests in the background; nil learns them before
+	// responding
+	Queue *LearnQueue
+	// Memory remembers completions learned with a context; nil leaves
+	// remembering and recalling them to the brain
+	Memory CompletionMemory
+	// Namespace labels the brain's metrics; empty for the default brain
+	Namespace string
+
+	templatesOnce   sync.Once
+	completions     *completionStore
+	completionsOnce sync.Once
+	feedback        feedbackCounters
 }
 
 // NewHandler creates a new Handler
@@ -47,140 +126,375 @@ func NewHandler(brain Brain) *Handler {
 
 // SetupRoutes configures the HTTP routes for the application
 func (h *Handler) SetupRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/predict", h.Predict)
-	mux.HandleFunc("/learn", h.Learn)
+	routes := map[string]http.HandlerFunc{
+		"/predict":         h.Predict,
+		"/predict/stream":  h.PredictStream,
+		"/learn":           h.Learn,
+		"/feedback":        h.Feedback,
+		"/admin/templates": h.AdminTemplates,
+		"/stats":           h.Stats,
+		"/explain":         h.Explain,
+		// The token may itself contain slashes
+		"/graph/token/{text...}": h.GraphToken,
+	}
+	for path, handler := range routes {
+		mux.HandleFunc(path, metrics.Instrument(path, tracing.Middleware(path, handler)))
+	}
+	mux.Handle("/metrics", metrics.Handler())
+
+	// Brain size gauges are read from the brain's size, or its full stats when it
+	// can't count itself more cheaply. Scrapes reuse a size for metrics.BrainSizeTTL.
+	switch brain := h.Brain.(type) {
+	case SizeBrain:
+		metrics.SetBrainSize(h.Namespace, func() (metrics.BrainSize, error) {
+			s, err := brain.Size()
+			return metrics.BrainSize{Tokens: s.Tokens, Nodes: s.Nodes, Edges: s.Edges}, err
+		})
+	case StatsBrain:
+		metrics.SetBrainSize(h.Namespace, func() (metrics.BrainSize, error) {
+			s, err := brain.Stats()
+			return metrics.BrainSize{Tokens: s.Tokens, Nodes: s.Nodes, Edges: s.Edges}, err
+		})
+	}
+}
+
+// configureCache enables or disables the brain's token cache for a request
+func (h *Handler) configureCache(useCache bool) {
+	brainWithCache, ok := h.Brain.(interface {
+		EnableCache()
+		DisableCache()
+	})
+	if !ok {
+		return
+	}
+
+	if useCache {
+		slog.Info("Enabling cache for request")
+		brainWithCache.EnableCache()
+	} else {
+		slog.Info("Disabling cache for request")
+		brainWithCache.DisableCache()
+	}
 }
 
 // Predict handles requests to generate predictions from the brain
 func (h *Handler) Predict(w http.ResponseWriter, r *http.Request) {
+	log := Logger(r.Context())
+
 	if r.Method != http.MethodPost {
-		slog.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req RequestPayload
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Warn("Invalid request", "error", err)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		decodeError(w, r, err)
 		return
 	}
 
-	slog.Info("Received predict request",
+	log.Info("Received predict request",
 		"text_length", len(req.Text),
 		"max_words", req.MaxWords,
-		"precision", req.Precision,
+		"temperature", req.Temperature,
+		"strategy", req.Strategy,
+		"mode", req.Mode,
 		"use_cache", req.UseCache)
+	if req.Precision != nil {
+		log.Warn("Ignoring precision, which was replaced by temperature", "precision", *req.Precision)
+	}
 
-	// Check if cache setting should be modified
-	if brainWithCache, ok := h.Brain.(interface {
-		EnableCache()
-		DisableCache()
-	}); ok {
-		if req.UseCache {
-			slog.Info("Enabling cache for request")
-			brainWithCache.EnableCache()
-		} else {
-			slog.Info("Disabling cache for request")
-			brainWithCache.DisableCache()
+	if err := validateGeneration(req); err != nil {
+		log.Warn("Invalid request", "error", err)
+		writeError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// A code template triggered by the last word wins over a generated reply
+	filetype, _ := stripCodeMarkers(req.Text)
+	if snippet, ok := h.FindSnippet(extractCursorPrefix(req.Text), filetype); ok {
+		resp := ResponsePayload{
+			Reply:   snippet.Text,
+			ID:      h.completionStore().add(snippet.Text, nil),
+			Kind:    KindSnippet,
+			Snippet: snippet.Body,
+			Replace: snippet.Replace,
 		}
+		json.NewEncoder(w).Encode(resp)
+
+		log.Info("Predict request succeeded", "snippet", snippet.Name, "trigger", snippet.Trigger, "id", resp.ID)
+		return
+	}
+
+	completion, err := h.Complete(r.Context(), req)
+	if err != nil {
+		log.Error("Failed to generate reply", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to generate reply")
+		return
 	}
 
+	resp := ResponsePayload{
+		Reply:        completion.Reply,
+		ID:           h.completionStore().add(completion.Reply, completion.EdgeIDs),
+		FinishReason: completion.FinishReason,
+		Seed:         completion.Seed,
+	}
+	json.NewEncoder(w).Encode(resp)
+	metrics.ReplyLength.Observe(float64(len(strings.Fields(resp.Reply))))
+
+	log.Info("Predict request succeeded",
+		"response_length", len(resp.Reply),
+		"finish_reason", resp.FinishReason,
+		"seed", resp.Seed,
+		"id", resp.ID)
+}
+
+// FindSnippet looks up a code template triggered by the text before the cursor
+func (h *Handler) FindSnippet(prefix, filetype string) (models.Snippet, bool) {
+	return h.templateStore().FindSnippet(prefix, filetype)
+}
+
+// templateStore returns the handler's templates, falling back to the built-in ones
+func (h *Handler) templateStore() *models.TemplateStore {
+	h.templatesOnce.Do(func() {
+		if h.Templates == nil {
+			h.Templates, _ = models.NewTemplateStore("")
+		}
+	})
+	return h.Templates
+}
+
+// Completion is a generated reply and why generation stopped
+type Completion struct {
+	Reply string
+	// FinishReason is a stop condition, StopReasonMaxTokens, StopReasonMaxWords
+	// or the db.StopReason the walk ended with
+	FinishReason string
+	// Seed reproduces the reply when sent with the same request, or is 0 when
+	// the brain can't seed replies
+	Seed int64
+	// EdgeIDs are the edges of the walk that produced the reply, when the brain
+	// reports them
+	EdgeIDs []int
+}
+
+// Complete applies the request's cache setting, extracts code metadata from the
+// text and generates a post-processed reply
+func (h *Handler) Complete(ctx context.Context, req RequestPayload) (Completion, error) {
+	// Check if cache setting should be modified
+	h.configureCache(req.UseCache)
+
 	// Extract code-specific information
+	_, span := tracing.Start(ctx, "extractCodeMetadata")
 	filetype, processedText := extractCodeMetadata(req.Text)
+	span.End()
 
-	// Get multiple replies and select based on precision rating
-	var reply string
-	var err error
+	return h.GenerateReply(ctx, filetype, processedText, req)
+}
 
-	// Default precision if not specified
-	precision := req.Precision
-	if precision <= 0 {
-		precision = 0.7 // Default precision
+// GenerateReply produces a post-processed reply for already extracted text.
+// It is shared by the HTTP handlers and the session protocol; ctx is checked
+// between reply attempts so superseded requests stop early.
+func (h *Handler) GenerateReply(ctx context.Context, filetype, processedText string, req RequestPayload) (Completion, error) {
+	if err := validateGeneration(req); err != nil {
+		return Completion{}, err
 	}
-	if precision > 1 {
-		precision = 1.0 // Cap at 1.0
+
+	sampling, seed := newSampling(req)
+	if !h.seeded(req) {
+		if req.Seed != nil {
+			Logger(ctx).Warn("Brain can't seed replies, ignoring seed")
+		}
+		seed = 0
 	}
 
-	// For high precision, generate multiple responses and find most common elements
-	if precision > 0.7 {
-		// Generate multiple responses - more for higher precision
-		numResponses := 3
-		if precision > 0.9 {
-			numResponses = 5
+	// Completions remembered for this context come back deterministically
+	if recaller, ok := h.recaller(); ok {
+		reply, ok := recaller.RecallCompletion(processedText)
+		metrics.ObserveCache("completion_memory", ok)
+		if ok {
+			Logger(ctx).Info("Recalled remembered completion", "response_length", len(reply))
+			completion := Completion{Reply: reply, FinishReason: string(db.StopEnd), Seed: seed}
+			return h.finishReply(ctx, processedText, completion, filetype, req), nil
 		}
+	}
+
+	completion, err := h.generate(ctx, sampling, filetype, processedText, req)
+	if err != nil {
+		return Completion{}, err
+	}
 
-		replies := make([]string, numResponses)
-		for i := 0; i < numResponses; i++ {
-			replies[i], err = h.Brain.Reply(processedText)
-			if err != nil {
-				slog.Error("Failed to generate reply", "error", err)
-				http.Error(w, "Failed to generate reply", http.StatusInternalServerError)
-				return
+	if err := ctx.Err(); err != nil {
+		return Completion{}, err
+	}
+
+	completion.Seed = seed
+	return h.finishReply(ctx, processedText, completion, filetype, req), nil
+}
+
+// generate produces a single reply, stopping at the request's stop conditions.
+// Brains that stream are stopped inside the generation loop; replies from other
+// brains are truncated afterwards.
+func (h *Handler) generate(ctx context.Context, sampling db.Sampling, filetype, processedText string, req RequestPayload) (completion Completion, err error) {
+	metrics.Candidates.Inc()
+	ctx, span := tracing.Start(ctx, "reply attempt",
+		attribute.String("strategy", req.Strategy),
+		attribute.String("mode", req.Mode))
+	defer func() {
+		span.SetAttributes(attribute.String("finish_reason", completion.FinishReason))
+		tracing.End(span, err)
+	}()
+
+	stop := newStopper(processedText, filetype, req)
+
+	if stop.active() {
+		var reply strings.Builder
+		finishReason := ""
+		result, streamed, err := h.replyStream(ctx, processedText, sampling, req, func(token string) error {
+			keep, reason := stop.push(token)
+			reply.WriteString(keep)
+			if reason != "" {
+				finishReason = reason
+				return errStopCondition
 			}
+			return nil
+		})
+		if err != nil && !stoppedEarly(err) {
+			return Completion{}, err
 		}
-
-		// Select reply based on precision
-		reply = selectReplyByPrecision(replies, precision)
-	} else {
-		// For lower precision, just get a single response (more creative)
-		reply, err = h.Brain.Reply(processedText)
-		if err != nil {
-			slog.Error("Failed to generate reply", "error", err)
-			http.Error(w, "Failed to generate reply", http.StatusInternalServerError)
-			return
+		if streamed {
+			if finishReason == "" {
+				finishReason = string(result.StopReason)
+			}
+			return Completion{Reply: strings.TrimRight(reply.String(), " \t"), FinishReason: finishReason, EdgeIDs: result.EdgeIDs}, nil
 		}
 	}
 
+	reply, result, err := h.reply(ctx, processedText, sampling, req)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	reply, finishReason := stop.truncate(reply)
+	if finishReason == "" {
+		finishReason = string(result.StopReason)
+	}
+	return Completion{Reply: reply, FinishReason: finishReason, EdgeIDs: result.EdgeIDs}, nil
+}
+
+// finishReply post-processes a reply for the filetype and applies the word limit
+func (h *Handler) finishReply(ctx context.Context, prefix string, completion Completion, filetype string, req RequestPayload) Completion {
+	_, span := tracing.Start(ctx, "postProcessCodeReply", attribute.String("filetype", filetype))
+	defer span.End()
+
 	// Post-process the reply based on filetype and improve code completion
-	reply = postProcessCodeReply(reply, filetype)
+	completion.Reply = postProcessCodeReply(prefix, completion.Reply, filetype)
 
 	// Apply max_words limit if provided
 	if req.MaxWords > 0 {
-		reply = limitWords(reply, req.MaxWords)
+		limited := limitWords(completion.Reply, req.MaxWords)
+		if limited != completion.Reply {
+			completion.Reply = limited
+			completion.FinishReason = StopReasonMaxWords
+		}
 	}
 
-	resp := ResponsePayload{Reply: reply}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
-
-	slog.Info("Predict request succeeded", "response_length", len(reply))
+	return completion
 }
 
 // Learn handles requests to train the brain with new text
 func (h *Handler) Learn(w http.ResponseWriter, r *http.Request) {
+	log := Logger(r.Context())
+
 	if r.Method != http.MethodPost {
-		slog.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req RequestPayload
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		slog.Warn("Invalid request", "error", err)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		decodeError(w, r, err)
+		return
+	}
+
+	log.Info("Received learn request", "text_length", len(req.Text))
+
+	queued, err := h.LearnText(r.Context(), req.Text, req.Context)
+	switch {
+	case err == nil:
+	case r.Context().Err() != nil:
+		log.Info("Client went away while queueing text", "error", err)
+		return
+	case errors.Is(err, ErrLearnQueueFull), errors.Is(err, ErrLearnQueueClosed):
+		log.Warn("Failed to queue text", "queued", h.Queue.Len(), "error", err)
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, http.StatusServiceUnavailable, "Learn queue is full")
+		return
+	default:
+		log.Error("Failed to learn", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to learn")
 		return
 	}
 
-	slog.Info("Received learn request", "text_length", len(req.Text))
+	status := http.StatusOK
+	if queued {
+		status = http.StatusAccepted
+	}
+	w.WriteHeader(status)
+	log.Info("Learn request succeeded", "queued", queued)
+}
 
+// LearnText learns text, through the learn queue when the handler has one, and
+// remembers it as the completion of lastContext once it is learned. It reports
+// whether the text was queued rather than learned. It is shared by the HTTP
+// handlers, the session protocol and the gRPC service.
+func (h *Handler) LearnText(ctx context.Context, text, lastContext string) (bool, error) {
 	// Process the text, removing any special markers
-	_, cleanText := extractCodeMetadata(req.Text)
+	_, cleanText := extractCodeMetadata(text)
+
+	// The context is cleaned the same way as predict text so both produce the
+	// same key
+	var remember func()
+	_, cleanContext := extractCodeMetadata(lastContext)
+	if len(cleanContext) > 0 && len(cleanText) > 0 {
+		remember = func() {
+			h.RememberCompletion(cleanContext, cleanText)
+			Logger(ctx).Info("Remembered completion for context", "context_length", len(lastContext))
+		}
+	}
 
+	if h.Queue != nil {
+		return true, h.Queue.Enqueue(ctx, cleanText, remember)
+	}
 	if err := h.Brain.Learn(cleanText); err != nil {
-		slog.Error("Failed to learn", "error", err)
-		http.Error(w, "Failed to learn", http.StatusInternalServerError)
-		return
+		return false, err
 	}
+	if remember != nil {
+		remember()
+	}
+	return false, nil
+}
 
-	// If there's a lastContext and this is a response to it, remember this completion
-	if len(req.Context) > 0 && len(cleanText) > 0 {
-		h.Brain.RememberCompletion(req.Context, cleanText)
-		slog.Info("Remembered completion for context", "context_length", len(req.Context))
+// RememberCompletion remembers a completion for a context in the handler's
+// memory, or the brain's when it has none
+func (h *Handler) RememberCompletion(context, completion string) {
+	if h.Memory != nil {
+		h.Memory.RememberCompletion(context, completion)
+		return
 	}
+	h.Brain.RememberCompletion(context, completion)
+}
 
-	w.WriteHeader(http.StatusOK)
-	slog.Info("Learn request succeeded")
+// recaller returns the handler's memory, or the brain if it recalls completions
+func (h *Handler) recaller() (CompletionRecaller, bool) {
+	if h.Memory != nil {
+		return h.Memory, true
+	}
+	recaller, ok := h.Brain.(CompletionRecaller)
+	return recaller, ok
 }
 
 // limitWords restricts a string to a maximum number of words
@@ -197,69 +511,21 @@ func limitWords(text string, maxWords int) string {
 	return strings.Join(words[:maxWords], " ")
 }
 
-// selectReplyByPrecision picks a response based on precision level
-func selectReplyByPrecision(replies []string, precision float64) string {
-	if len(replies) == 0 {
-		return ""
-	}
-
-	if len(replies) == 1 {
-		return replies[0]
-	}
-
-	// Higher precision values choose shorter, more conservative replies
-	if precision > 0.9 {
-		// Find the shortest reply
-		shortestIdx := 0
-		shortestLen := len(strings.Fields(replies[0]))
-
-		for i := 1; i < len(replies); i++ {
-			currLen := len(strings.Fields(replies[i]))
-			if currLen < shortestLen {
-				shortestLen = currLen
-				shortestIdx = i
-			}
-		}
-
-		return replies[shortestIdx]
-	} else if precision > 0.7 {
-		// Find a reply that's not too long or too short (middle of the pack)
-		lengths := make([]int, len(replies))
-		for i, reply := range replies {
-			lengths[i] = len(strings.Fields(reply))
-		}
-
-		// Sort the indices by length
-		type indexedLength struct {
-			idx    int
-			length int
-		}
-
-		sortedLengths := make([]indexedLength, len(lengths))
-		for i, length := range lengths {
-			sortedLengths[i] = indexedLength{idx: i, length: length}
-		}
-
-		// Sort by length
-		for i := 0; i < len(sortedLengths); i++ {
-			for j := i + 1; j < len(sortedLengths); j++ {
-				if sortedLengths[i].length > sortedLengths[j].length {
-					sortedLengths[i], sortedLengths[j] = sortedLengths[j], sortedLengths[i]
-				}
-			}
-		}
+// extractCodeMetadata extracts filetype and other code metadata from the text
+func extractCodeMetadata(text string) (string, string) {
+	filetype, text := stripCodeMarkers(text)
+	return filetype, strings.TrimSpace(text)
+}
 
-		// Pick the middle one
-		midIdx := sortedLengths[len(sortedLengths)/2].idx
-		return replies[midIdx]
-	} else {
-		// Lower precision, more randomness - pick randomly from all responses
-		return replies[rand.Intn(len(replies))]
-	}
+// extractCursorPrefix returns the text before the cursor with the markers removed.
+// Unlike extractCodeMetadata it keeps trailing whitespace on the cursor line.
+func extractCursorPrefix(text string) string {
+	_, text = stripCodeMarkers(text)
+	return strings.TrimRight(text, "\r\n")
 }
 
-// extractCodeMetadata extracts filetype and other code metadata from the text
-func extractCodeMetadata(text string) (string, string) {
+// stripCodeMarkers removes the filetype marker and the after-cursor hints
+func stripCodeMarkers(text string) (string, string) {
 	// Default filetype
 	filetype := "text"
 
@@ -272,41 +538,32 @@ func extractCodeMetadata(text string) (string, string) {
 		text = filetypeRegex.ReplaceAllString(text, "")
 	}
 
-	// Clean out any other special markers we've added
-	text = regexp.MustCompile(`(?m)^// AFTER CURSOR:.*$`).ReplaceAllString(text, "")
-	text = regexp.MustCompile(`(?m)^// CONTEXT AFTER:.*$`).ReplaceAllString(text, "")
+	// The after-cursor hints and the commented lines that follow them are appended
+	// at the end, so everything from the first hint onwards is dropped
+	text = regexp.MustCompile(`(?ms)^// (?:AFTER CURSOR|CONTEXT AFTER):.*\z`).ReplaceAllString(text, "")
 
 	// Clean up multiple blank lines
 	text = regexp.MustCompile(`\n{3,}`).ReplaceAllString(text, "\n\n")
 
-	return filetype, strings.TrimSpace(text)
+	return filetype, text
 }
 
-// postProcessCodeReply improves the code quality of replies
-func postProcessCodeReply(reply, filetype string) string {
+// postProcessCodeReply improves the code quality of replies. The syntax package
+// trims the reply where it stops being valid after the prefix and closes the
+// scopes it opened; the rest are small formatting fixes per filetype.
+func postProcessCodeReply(prefix, reply, filetype string) string {
 	// Skip processing for non-code filetypes
 	if filetype == "text" || filetype == "" {
 		return reply
 	}
 
+	reply = syntax.Fix(prefix, reply, filetype)
+
 	// Fix common code formatting issues based on filetype
 	switch filetype {
 	case "go":
-		// Fix unmatched brackets or parentheses
-		reply = fixBracketBalance(reply, "{", "}")
-		reply = fixBracketBalance(reply, "(", ")")
-
 		// Ensure proper spacing after keywords
-		reply = regexp.MustCompile(`(if|for|switch|func)\(`).ReplaceAllString(reply, "$1 (")
-
-	case "javascript", "typescript", "jsx", "tsx":
-		// Fix unmatched brackets, parentheses, or template literals
-		reply = fixBracketBalance(reply, "{", "}")
-		reply = fixBracketBalance(reply, "(", ")")
-		reply = fixBracketBalance(reply, "[", "]")
-
-		// Fix arrow functions
-		reply = regexp.MustCompile(`(\w+)\s*=>\s*{([^}]*)$`).ReplaceAllString(reply, "$1 => {$2}")
+		reply = regexp.MustCompile(`(if|for|switch)\(`).ReplaceAllString(reply, "$1 (")
 
 	case "python":
 		// Fix indentation issues
@@ -336,25 +593,7 @@ func postProcessCodeReply(reply, filetype string) string {
 	case "lua":
 		// Fix function declarations
 		reply = regexp.MustCompile(`function\s*([a-zA-Z0-9_.]+)\s*\(`).ReplaceAllString(reply, "function $1(")
-
-		// Fix 'end' keyword if missing
-		if strings.Contains(reply, "function ") && !strings.Contains(reply, "end") {
-			reply += "\nend"
-		}
 	}
 
 	return reply
 }
-
-// fixBracketBalance ensures balanced brackets/parentheses
-func fixBracketBalance(text, opening, closing string) string {
-	openCount := strings.Count(text, opening)
-	closeCount := strings.Count(text, closing)
-
-	// Add missing closing brackets
-	if openCount > closeCount {
-		text += strings.Repeat(closing, openCount-closeCount)
-	}
-
-	return text
-}
@@ -2,10 +2,16 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db/dbtest"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/models"
 )
 
 // mockBrain is a mock implementation of the Brain for testing
@@ -20,6 +26,12 @@ func (m *mockBrain) Learn(text string) error {
 	return nil
 }
 
+func (m *mockBrain) RememberCompletion(context, completion string) {}
+
+func (m *mockBrain) EnableCache() {}
+
+func (m *mockBrain) DisableCache() {}
+
 func (m *mockBrain) Close() error {
 	return nil
 }
@@ -66,6 +78,45 @@ func TestPredict(t *testing.T) {
 	}
 }
 
+func TestPredictSnippet(t *testing.T) {
+	handler := &Handler{
+		Brain: &mockBrain{},
+	}
+
+	// The editor plugin sends the filetype and after-cursor hints with the text
+	text := "// FILETYPE: go\nx := compute()\nif \n// AFTER CURSOR: \n// CONTEXT AFTER: \n// return x"
+	jsonData, err := json.Marshal(RequestPayload{Text: text})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/predict", bytes.NewBuffer(jsonData))
+	rec := httptest.NewRecorder()
+	handler.Predict(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var resp ResponsePayload
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Kind != KindSnippet {
+		t.Errorf("Expected kind %q, got %q", KindSnippet, resp.Kind)
+	}
+	if want := "compute {\n\t\n}"; resp.Reply != want {
+		t.Errorf("Expected reply %q, got %q", want, resp.Reply)
+	}
+	if want := "${1:compute} {\n\t$0\n}"; resp.Snippet != want {
+		t.Errorf("Expected snippet %q, got %q", want, resp.Snippet)
+	}
+	if resp.ID == "" {
+		t.Error("Expected snippet replies to get a feedback ID")
+	}
+}
+
 func TestLearn(t *testing.T) {
 	// Create a mock brain
 	mockBrain := &mockBrain{}
@@ -95,3 +146,265 @@ func TestLearn(t *testing.T) {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
 	}
 }
+
+// mapMemory is a completion memory keyed by the exact context
+type mapMemory map[string]string
+
+func (m mapMemory) RememberCompletion(context, completion string) {
+	m[context] = completion
+}
+
+func (m mapMemory) RecallCompletion(context string) (string, bool) {
+	completion, ok := m[context]
+	return completion, ok
+}
+
+func TestCompletionMemory(t *testing.T) {
+	memory := mapMemory{}
+	handler := &Handler{Brain: &mockBrain{}, Memory: memory}
+
+	rec := httptest.NewRecorder()
+	handler.Learn(rec, httptest.NewRequest(http.MethodPost, "/learn", strings.NewReader(`{"text":"{ return err }","context":"if err != nil"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	if memory["if err != nil"] != "{ return err }" {
+		t.Fatalf("Expected the completion to be remembered, got %v", memory)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Predict(rec, httptest.NewRequest(http.MethodPost, "/predict", strings.NewReader(`{"text":"if err != nil"}`)))
+	var resp ResponsePayload
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Reply != "{ return err }" {
+		t.Errorf("Expected the remembered completion, got %q", resp.Reply)
+	}
+}
+
+func TestPredictStream(t *testing.T) {
+	// Create a handler with the mock brain
+	handler := &Handler{
+		Brain: &mockBrain{},
+	}
+
+	// Create a test request limited to three words
+	req := httptest.NewRequest(http.MethodGet, "/predict/stream?text=Test+input&max_words=3", nil)
+	rec := httptest.NewRecorder()
+
+	// Call the handler
+	handler.PredictStream(rec, req)
+
+	// Check the response
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected content type %q, got %q", "text/event-stream", contentType)
+	}
+
+	body := rec.Body.String()
+	if count := strings.Count(body, "event: token\n"); count != 3 {
+		t.Errorf("Expected 3 token events, got %d", count)
+	}
+
+	expectedDone := `event: done
+data: {"reply":"instant mock reply","score":0,"stop_reason":"max_words"}`
+	if !strings.Contains(body, expectedDone) {
+		t.Errorf("Expected final event %q in body %q", expectedDone, body)
+	}
+}
+
+// tokenBrain streams fixed tokens and, like some brains, returns the error emit
+// gave it
+type tokenBrain struct {
+	mockBrain
+	tokens []string
+}
+
+func (b *tokenBrain) ReplyStream(ctx context.Context, text string, emit func(token string) error) (StreamResult, error) {
+	for _, token := range b.tokens {
+		if err := emit(token); err != nil {
+			return StreamResult{StopReason: db.StopCancelled}, err
+		}
+	}
+	return StreamResult{StopReason: db.StopEnd}, nil
+}
+
+func TestStreamReply(t *testing.T) {
+	handler := &Handler{Brain: &tokenBrain{tokens: []string{"fmt.Println(", "x ", "+ ", "y "}}}
+	prefix := "// FILETYPE: go\nfunc main() {\n\t"
+
+	tests := []struct {
+		name       string
+		req        RequestPayload
+		wantReply  string
+		wantTokens string
+		wantReason string
+	}{
+		{
+			name:       "closing suffix follows the trimmed reply",
+			req:        RequestPayload{Text: prefix},
+			wantReply:  "fmt.Println(x + y)",
+			wantTokens: "fmt.Println(x + y )",
+			wantReason: "end",
+		},
+		{
+			name:       "stop returned by the brain",
+			req:        RequestPayload{Text: prefix, MaxTokens: 2},
+			wantReply:  "fmt.Println(x)",
+			wantTokens: "fmt.Println(x )",
+			wantReason: StopReasonMaxTokens,
+		},
+		{
+			name:       "word limit returned by the brain",
+			req:        RequestPayload{Text: prefix, MaxWords: 1},
+			wantReply:  "fmt.Println()",
+			wantTokens: "fmt.Println()",
+			wantReason: StopReasonMaxWords,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokens strings.Builder
+			done, err := handler.StreamReply(context.Background(), tt.req, func(token string) error {
+				tokens.WriteString(token)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamReply failed: %v", err)
+			}
+			if done.Reply != tt.wantReply || done.StopReason != tt.wantReason {
+				t.Errorf("Expected %q (%s), got %q (%s)", tt.wantReply, tt.wantReason, done.Reply, done.StopReason)
+			}
+			if tokens.String() != tt.wantTokens {
+				t.Errorf("Expected tokens %q, got %q", tt.wantTokens, tokens.String())
+			}
+		})
+	}
+}
+
+// feedbackBrain records reinforcement of the continuing brain's walk edges
+type feedbackBrain struct {
+	continuingBrain
+	deltas map[int]int
+}
+
+func (b *feedbackBrain) Reinforce(edgeIDs []int, delta int) error {
+	for _, edgeID := range edgeIDs {
+		b.deltas[edgeID] += delta
+	}
+	return nil
+}
+
+func TestFeedback(t *testing.T) {
+	brain := &feedbackBrain{deltas: make(map[int]int)}
+	handler := NewHandler(brain)
+
+	// predict returns a completion ID for " brown fox", walked over edges 1 and 2
+	predict := func() string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/predict", strings.NewReader(`{"text":"the quick","mode":"continue"}`))
+		rec := httptest.NewRecorder()
+		handler.Predict(rec, req)
+
+		var resp ResponsePayload
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.ID == "" {
+			t.Fatal("Expected a completion ID in the predict response")
+		}
+		return resp.ID
+	}
+	feedback := func(body string) int {
+		rec := httptest.NewRecorder()
+		handler.Feedback(rec, httptest.NewRequest(http.MethodPost, "/feedback", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	// Reject it
+	id := predict()
+	body := `{"id":"` + id + `","outcome":"rejected"}`
+	if code := feedback(body); code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	if brain.deltas[1] != -1 || brain.deltas[2] != -1 {
+		t.Errorf("Expected the walk's edges to be penalized by -1, got %v", brain.deltas)
+	}
+
+	// Feedback can only be given once per completion
+	if code := feedback(body); code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, code)
+	}
+
+	// Only the edges of the accepted words are reinforced
+	if code := feedback(`{"id":"` + predict() + `","outcome":"partial","accepted":"brown"}`); code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	if brain.deltas[1] != 0 || brain.deltas[2] != -1 {
+		t.Errorf("Expected only the first edge to be reinforced, got %v", brain.deltas)
+	}
+
+	stats := handler.feedback.stats()
+	if stats.Rejected != 1 || stats.Partial != 1 || stats.AcceptanceRate != 0.5 {
+		t.Errorf("Unexpected feedback stats: %+v", stats)
+	}
+}
+
+// graphBrain replies with a models.Replier over a real graph and reinforces the
+// graph's edges
+type graphBrain struct {
+	mockBrain
+	*models.Replier
+	graph *db.Graph
+}
+
+func (b *graphBrain) Reinforce(edgeIDs []int, delta int) error {
+	return b.graph.Reinforce(edgeIDs, delta)
+}
+
+func TestFeedbackOnReply(t *testing.T) {
+	graph, err := db.NewGraph(dbtest.Create(t, dbtest.Brain{Order: 2}), db.GraphOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open graph: %v", err)
+	}
+	defer graph.Close()
+	if err := models.NewLearner(graph, models.NewCobeTokenizer()).Learn("the quick brown fox jumps"); err != nil {
+		t.Fatalf("Learn failed: %v", err)
+	}
+	handler := NewHandler(&graphBrain{Replier: models.NewReplier(graph, models.NewCobeTokenizer()), graph: graph})
+
+	// Walks read committed counts, so the total is read the same way
+	total := func() int {
+		t.Helper()
+		var total int
+		if err := graph.Reader.QueryRow("SELECT SUM(count) FROM edges").Scan(&total); err != nil {
+			t.Fatalf("Failed to sum edge counts: %v", err)
+		}
+		return total
+	}
+	before := total()
+
+	// A plain predict replies with a walk rather than a continuation
+	rec := httptest.NewRecorder()
+	handler.Predict(rec, httptest.NewRequest(http.MethodPost, "/predict", strings.NewReader(`{"text":"quick"}`)))
+	var resp ResponsePayload
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Reply == "" || resp.ID == "" {
+		t.Fatalf("Expected a reply with a completion ID, got %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Feedback(rec, httptest.NewRequest(http.MethodPost, "/feedback", strings.NewReader(`{"id":"`+resp.ID+`","outcome":"accepted"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	if after := total(); after <= before {
+		t.Errorf("Expected accepting the reply to reinforce its edges, total count went from %d to %d", before, after)
+	}
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+)
+
+// Learn queue defaults used for zero LearnQueueConfig fields
+const (
+	DefaultLearnQueueSize = 1024
+	DefaultLearnBatchSize = 64
+	DefaultLearnQueueWait = 100 * time.Millisecond
+)
+
+// ErrLearnQueueFull is returned when text can't be queued because the writer is
+// behind. Clients should retry later.
+var ErrLearnQueueFull = errors.New("learn queue is full")
+
+// ErrLearnQueueClosed is returned when text is queued after the queue was closed
+var ErrLearnQueueClosed = errors.New("learn queue is closed")
+
+// BatchLearner is implemented by brains that can learn several texts in one
+// transaction, such as those embedding a models.Learner. Other brains learn
+// queued texts one at a time.
+type BatchLearner interface {
+	LearnBatch(texts []string) error
+}
+
+// LearnQueueConfig configures a LearnQueue
+type LearnQueueConfig struct {
+	// Size is how many texts can wait to be learned
+	Size int
+	// BatchSize is the most texts learned in one batch
+	BatchSize int
+	// Wait is how long Enqueue waits for room in a full queue
+	Wait time.Duration
+	// Namespace labels the queue's depth metric; empty for the default brain
+	Namespace string
+}
+
+// LearnQueue learns texts in the background so requests don't wait on the
+// database. A single writer drains the queue, learning whatever is waiting in
+// batches of up to BatchSize.
+type LearnQueue struct {
+	brain  Brain
+	config LearnQueueConfig
+	texts  chan queuedText
+	depth  prometheus.Gauge
+
+	// mu guards closed and keeps Enqueue from sending on a closed channel
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+// NewLearnQueue creates a queue learning into brain and starts its writer
+func NewLearnQueue(brain Brain, config LearnQueueConfig) *LearnQueue {
+	if config.Size <= 0 {
+		config.Size = DefaultLearnQueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultLearnBatchSize
+	}
+	if config.Wait <= 0 {
+		config.Wait = DefaultLearnQueueWait
+	}
+
+	q := &LearnQueue{
+		brain:  brain,
+		config: config,
+		texts:  make(chan queuedText, config.Size),
+		depth:  metrics.LearnQueueDepth.WithLabelValues(config.Namespace),
+		done:   make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// queuedText is a text waiting to be learned and what to do once it is
+type queuedText struct {
+	text    string
+	learned func()
+}
+
+// done runs the text's learned callback, if any
+func (t queuedText) done() {
+	if t.learned != nil {
+		t.learned()
+	}
+}
+
+// Enqueue queues text to be learned. learned, when not nil, is called once the
+// text has been learned, so work depending on it, like remembering it as a
+// completion, doesn't run ahead of it. When the queue is full Enqueue waits up
+// to the configured wait before giving up with ErrLearnQueueFull, or returns
+// ctx's error when ctx is done first.
+func (q *LearnQueue) Enqueue(ctx context.Context, text string, learned func()) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrLearnQueueClosed
+	}
+
+	item := queuedText{text: text, learned: learned}
+	select {
+	case q.texts <- item:
+		q.depth.Set(float64(len(q.texts)))
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(q.config.Wait)
+	defer timer.Stop()
+	select {
+	case q.texts <- item:
+		q.depth.Set(float64(len(q.texts)))
+		return nil
+	case <-timer.C:
+		return ErrLearnQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Len returns the number of texts waiting to be learned
+func (q *LearnQueue) Len() int {
+	return len(q.texts)
+}
+
+// Close stops accepting texts and waits for the writer to learn the ones already
+// queued, or for ctx to be done
+func (q *LearnQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.texts)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run learns queued texts until the queue is closed and drained
+func (q *LearnQueue) run() {
+	defer close(q.done)
+
+	batch := make([]queuedText, 0, q.config.BatchSize)
+	for item := range q.texts {
+		batch = append(batch[:0], item)
+		// Take whatever else is already waiting, without blocking
+	fill:
+		for len(batch) < q.config.BatchSize {
+			select {
+			case item, ok := <-q.texts:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, item)
+			default:
+				break fill
+			}
+		}
+		q.depth.Set(float64(len(q.texts)))
+		q.learn(batch)
+	}
+	q.depth.Set(0)
+}
+
+// learn learns a batch of texts. A failed batch is retried one text at a time so
+// one bad text doesn't lose the others.
+func (q *LearnQueue) learn(batch []queuedText) {
+	start := time.Now()
+	metrics.LearnBatchSize.Observe(float64(len(batch)))
+
+	if batcher, ok := q.brain.(BatchLearner); ok && len(batch) > 1 {
+		texts := make([]string, len(batch))
+		for i, item := range batch {
+			texts[i] = item.text
+		}
+		err := batcher.LearnBatch(texts)
+		if err == nil {
+			for _, item := range batch {
+				item.done()
+			}
+			slog.Debug("Learned batch", "texts", len(batch), "duration", time.Since(start))
+			return
+		}
+		slog.Warn("Failed to learn batch, learning texts one at a time", "texts", len(batch), "error", err)
+	}
+
+	for _, item := range batch {
+		if err := q.brain.Learn(item.text); err != nil {
+			slog.Error("Failed to learn queued text", "text_length", len(item.text), "error", err)
+			continue
+		}
+		item.done()
+	}
+	slog.Debug("Learned batch", "texts", len(batch), "duration", time.Since(start))
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchBrain records the batches it learns and can block learning until released
+type batchBrain struct {
+	mockBrain
+	mu      sync.Mutex
+	batches [][]string
+	release chan struct{}
+}
+
+func (b *batchBrain) LearnBatch(texts []string) error {
+	if b.release != nil {
+		<-b.release
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, append([]string(nil), texts...))
+	return nil
+}
+
+func (b *batchBrain) Learn(text string) error {
+	return b.LearnBatch([]string{text})
+}
+
+func (b *batchBrain) learned() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var texts []string
+	for _, batch := range b.batches {
+		texts = append(texts, batch...)
+	}
+	return texts
+}
+
+func TestLearnQueueFlushesOnClose(t *testing.T) {
+	brain := &batchBrain{release: make(chan struct{})}
+	queue := NewLearnQueue(brain, LearnQueueConfig{Size: 10, BatchSize: 4})
+
+	texts := []string{"one", "two", "three", "four", "five"}
+	for _, text := range texts {
+		if err := queue.Enqueue(context.Background(), text, nil); err != nil {
+			t.Fatalf("Failed to queue %q: %v", text, err)
+		}
+	}
+	close(brain.release)
+
+	if err := queue.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close queue: %v", err)
+	}
+	if got := strings.Join(brain.learned(), " "); got != "one two three four five" {
+		t.Errorf("Expected every text to be learned in order, got %q", got)
+	}
+	for _, batch := range brain.batches {
+		if len(batch) > 4 {
+			t.Errorf("Expected batches of at most 4 texts, got %d", len(batch))
+		}
+	}
+	if len(brain.batches) >= len(texts) {
+		t.Errorf("Expected texts to be batched, got %d batches", len(brain.batches))
+	}
+
+	if err := queue.Enqueue(context.Background(), "six", nil); err != ErrLearnQueueClosed {
+		t.Errorf("Expected ErrLearnQueueClosed after closing, got %v", err)
+	}
+}
+
+func TestLearnQueueBackpressure(t *testing.T) {
+	brain := &batchBrain{release: make(chan struct{})}
+	queue := NewLearnQueue(brain, LearnQueueConfig{Size: 1, BatchSize: 1, Wait: 10 * time.Millisecond})
+	handler := &Handler{Brain: brain, Queue: queue}
+
+	learn := func() int {
+		rec := httptest.NewRecorder()
+		handler.Learn(rec, httptest.NewRequest(http.MethodPost, "/learn", strings.NewReader(`{"text":"hello"}`)))
+		return rec.Code
+	}
+
+	// The writer holds the first text while the second fills the queue
+	if code := learn(); code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d", http.StatusAccepted, code)
+	}
+	deadline := time.Now().Add(time.Second)
+	for queue.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if code := learn(); code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d", http.StatusAccepted, code)
+	}
+	if code := learn(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a full queue to answer %d, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	close(brain.release)
+	if err := queue.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close queue: %v", err)
+	}
+	if got := len(brain.learned()); got != 2 {
+		t.Errorf("Expected 2 texts learned, got %d", got)
+	}
+}
+
+func TestLearnQueueRemembersAfterLearning(t *testing.T) {
+	brain := &batchBrain{release: make(chan struct{})}
+	memory := mapMemory{}
+	queue := NewLearnQueue(brain, LearnQueueConfig{Size: 10})
+	handler := &Handler{Brain: brain, Queue: queue, Memory: memory}
+
+	rec := httptest.NewRecorder()
+	handler.Learn(rec, httptest.NewRequest(http.MethodPost, "/learn", strings.NewReader(`{"text":"{ return err }","context":"if err != nil"}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d", http.StatusAccepted, rec.Code)
+	}
+
+	// The writer is still holding the text, so it isn't remembered yet
+	if len(memory) != 0 {
+		t.Errorf("Expected the completion to wait for the text to be learned, got %v", memory)
+	}
+
+	close(brain.release)
+	if err := queue.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close queue: %v", err)
+	}
+	if memory["if err != nil"] != "{ return err }" {
+		t.Errorf("Expected the completion to be remembered once learned, got %v", memory)
+	}
+}
+
+func TestLearnQueueEnqueueCancelled(t *testing.T) {
+	brain := &batchBrain{release: make(chan struct{})}
+	queue := NewLearnQueue(brain, LearnQueueConfig{Size: 1, BatchSize: 1, Wait: time.Minute})
+	defer func() {
+		close(brain.release)
+		queue.Close(context.Background())
+	}()
+
+	// Fill the queue while the writer holds the first text
+	for i := 0; i < 2; i++ {
+		if err := queue.Enqueue(context.Background(), "hello", nil); err != nil {
+			t.Fatalf("Failed to queue text: %v", err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for i == 0 && queue.Len() > 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := queue.Enqueue(ctx, "hello", nil); err != context.Canceled {
+		t.Errorf("Expected context.Canceled for a cancelled enqueue, got %v", err)
+	}
+}
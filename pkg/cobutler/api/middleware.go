@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/internal/httputil"
+)
+
+// DefaultMaxBodyBytes limits request bodies to 1 MiB
+const DefaultMaxBodyBytes = 1 << 20
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware wraps an HTTP handler
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in middleware, the first being the outermost
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// DefaultMiddleware returns the middleware NewServer wraps requests in when
+// none is given: request IDs, timing, panic recovery and body size limits
+func DefaultMiddleware() []Middleware {
+	return []Middleware{RequestID, Timing, Recover, LimitBody(DefaultMaxBodyBytes)}
+}
+
+// contextKey keys the values middleware stores in request contexts
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loggerKey
+	apiKeyKey
+)
+
+// RequestID gives every request an ID, taken from its X-Request-ID header or
+// generated, and echoes it in the response. The request's context carries the ID
+// and a logger that includes it.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, loggerKey, slog.Default().With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the ID RequestID gave the request, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Logger returns the request's logger, which includes its ID, or the default
+// logger outside of requests
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Timing logs every request with its status and duration
+func Timing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httputil.NewRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		Logger(r.Context()).Info("Request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.Status(),
+			"bytes", recorder.Bytes(),
+			"duration", time.Since(start))
+	})
+}
+
+// ErrorPayload is the JSON body of every error returned by the API
+type ErrorPayload struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Recover turns a panic in a handler into a logged stack trace and a JSON 500.
+// When the response was already started, as with streams, the error can't be
+// sent and the connection is aborted instead.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httputil.NewRecorder(w)
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// The server aborts the response without logging for this one
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			Logger(r.Context()).Error("Handler panicked", "panic", v, "stack", string(debug.Stack()))
+			if recorder.WroteHeader() {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(w, r, http.StatusInternalServerError, "Internal server error")
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// LimitBody rejects request bodies larger than limit bytes. Handlers see the
+// limit as a read error, answered with decodeError.
+func LimitBody(limit int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeError writes a JSON error with the request's ID
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorPayload{Error: message, RequestID: RequestIDFromContext(r.Context())})
+}
+
+// decodeError answers a request whose body couldn't be decoded, with 413 when
+// it was over the size limit and 400 otherwise
+func decodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		Logger(r.Context()).Warn("Request body too large", "limit", tooLarge.Limit)
+		writeError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+	Logger(r.Context()).Warn("Invalid request", "error", err)
+	writeError(w, r, http.StatusBadRequest, "Invalid request")
+}
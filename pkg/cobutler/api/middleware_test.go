@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}), DefaultMiddleware()...)
+
+	// A request ID from the client is kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "abc123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if seen != "abc123" || rec.Header().Get(RequestIDHeader) != "abc123" {
+		t.Errorf("Expected request ID abc123, handler saw %q and response has %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+
+	// Otherwise one is generated
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if seen == "" || rec.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("Expected a generated request ID, handler saw %q and response has %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestRecover(t *testing.T) {
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("postProcessCodeReply failed")
+	}), DefaultMiddleware()...)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/predict", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	var payload ErrorPayload
+	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
+		t.Fatalf("Expected a JSON error: %v", err)
+	}
+	if payload.RequestID == "" || payload.RequestID != rec.Header().Get(RequestIDHeader) {
+		t.Errorf("Expected the error to carry the request ID, got %+v", payload)
+	}
+}
+
+func TestRecoverAfterHeaders(t *testing.T) {
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("event: token\n\n"))
+		panic("walk failed")
+	}))
+
+	rec := httptest.NewRecorder()
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Expected the response to be aborted, got %v", v)
+		}
+		if strings.Contains(rec.Body.String(), "error") {
+			t.Errorf("Expected no error body after the stream started, got %q", rec.Body.String())
+		}
+	}()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/predict/stream", nil))
+}
+
+func TestLimitBody(t *testing.T) {
+	handler := Chain(http.HandlerFunc((&Handler{Brain: &mockBrain{}}).Predict), LimitBody(16))
+
+	body := `{"text":"` + strings.Repeat("a", 32) + `"}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/predict", strings.NewReader(body)))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+	var payload ErrorPayload
+	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil || payload.Error != "Request body too large" {
+		t.Errorf("Expected a JSON error, got %+v (%v)", payload, err)
+	}
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+)
+
+// limiterIdle is how long a client's limiters are kept after its last request
+const limiterIdle = 10 * time.Minute
+
+// RateLimit is a token bucket holding up to Burst requests, refilled at PerSecond.
+// A zero PerSecond turns the limit off.
+type RateLimit struct {
+	PerSecond float64 `yaml:"per_second"`
+	Burst     int     `yaml:"burst"`
+}
+
+// RateLimitConfig configures how fast each client, an API key or an IP address,
+// may predict and learn
+type RateLimitConfig struct {
+	Predict RateLimit `yaml:"predict"`
+	Learn   RateLimit `yaml:"learn"`
+	// LearnBytesPerDay caps the bytes each client can send to /learn per UTC day.
+	// Zero means no quota.
+	LearnBytesPerDay int64 `yaml:"learn_bytes_per_day"`
+}
+
+// LoadRateLimitConfig reads a rate limit config file
+func LoadRateLimitConfig(path string) (RateLimitConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RateLimitConfig{}, fmt.Errorf("failed to read rate limit config: %w", err)
+	}
+
+	var config RateLimitConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return RateLimitConfig{}, fmt.Errorf("failed to parse rate limit config: %w", err)
+	}
+	return config, nil
+}
+
+// clientLimits are the token buckets of one client
+type clientLimits struct {
+	predict  *rate.Limiter
+	learn    *rate.Limiter
+	lastSeen time.Time
+}
+
+// learnQuota counts the bytes one client learned on a UTC day
+type learnQuota struct {
+	day     string
+	learned int64
+}
+
+// RateLimiter tracks the limits of every client. One limiter can be shared by
+// several servers so a client's requests count against the same limits.
+type RateLimiter struct {
+	config RateLimitConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*clientLimits
+	// quotas are kept apart from clients so they outlive idle limiters and
+	// only go when their day is over
+	quotas    map[string]*learnQuota
+	lastSweep time.Time
+}
+
+// RateLimits answers requests over their client's predict or learn rate, or
+// over its daily learn quota, with 429 and a Retry-After header. Clients are
+// identified by their API key when Auth comes first, otherwise by IP address.
+func RateLimits(config RateLimitConfig) Middleware {
+	return NewRateLimiter(config).Middleware
+}
+
+// NewRateLimiter creates a rate limiter for config
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	return newRateLimiter(config, time.Now)
+}
+
+// newRateLimiter creates a rate limiter reading the time from now
+func newRateLimiter(config RateLimitConfig, now func() time.Time) *RateLimiter {
+	return &RateLimiter{
+		config:  config,
+		now:     now,
+		clients: make(map[string]*clientLimits),
+		quotas:  make(map[string]*learnQuota),
+	}
+}
+
+// Middleware applies the limits for the scope of the request's path, like
+// RateLimits
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := ScopeForPath(r.URL.Path)
+		if scope == ScopeAdmin {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The body is read up front to count it against the learn quota
+		var size int64
+		if r.URL.Path == "/learn" && l.config.LearnBytesPerDay > 0 {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				decodeError(w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			size = int64(len(body))
+		}
+
+		client := clientID(r)
+		if retryAfter, ok := l.Allow(client, scope, size); !ok {
+			metrics.RateLimited.WithLabelValues(scope).Inc()
+			Logger(r.Context()).Warn("Rate limited", "client", client, "scope", scope, "retry_after", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, r, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allow takes a request of size bytes for scope from client's limits. Sizes
+// only count against the learn quota, when there is one. When the request
+// isn't allowed it reports how long to wait before retrying.
+func (l *RateLimiter) Allow(client, scope string, size int64) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	limits, ok := l.clients[client]
+	if !ok {
+		limits = &clientLimits{
+			predict: newLimiter(l.config.Predict),
+			learn:   newLimiter(l.config.Learn),
+		}
+		l.clients[client] = limits
+	}
+	limits.lastSeen = now
+
+	limiter := limits.predict
+	if scope == ScopeLearn {
+		limiter = limits.learn
+	}
+
+	// Quotas reset at midnight UTC
+	var quota *learnQuota
+	if size > 0 && l.config.LearnBytesPerDay > 0 {
+		day := now.UTC().Format(time.DateOnly)
+		quota = l.quotas[client]
+		if quota == nil || quota.day != day {
+			quota = &learnQuota{day: day}
+			l.quotas[client] = quota
+		}
+		if quota.learned+size > l.config.LearnBytesPerDay {
+			midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			return midnight.Sub(now), false
+		}
+	}
+
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return time.Second, false
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return delay, false
+	}
+
+	if quota != nil {
+		quota.learned += size
+	}
+	return 0, true
+}
+
+// sweep forgets the limiters of clients that haven't made a request for
+// limiterIdle and the quotas of past days, at most once a minute
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for client, limits := range l.clients {
+		if now.Sub(limits.lastSeen) > limiterIdle {
+			delete(l.clients, client)
+		}
+	}
+	day := now.UTC().Format(time.DateOnly)
+	for client, quota := range l.quotas {
+		if quota.day != day {
+			delete(l.quotas, client)
+		}
+	}
+}
+
+// newLimiter creates a token bucket for limit, or one that allows everything
+// when the limit is off
+func newLimiter(limit RateLimit) *rate.Limiter {
+	if limit.PerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(limit.PerSecond), max(limit.Burst, 1))
+}
+
+// clientID identifies the client of a request by its API key, or by its IP
+// address for unauthenticated requests
+func clientID(r *http.Request) string {
+	if key, ok := APIKeyFromContext(r.Context()); ok {
+		return "key:" + key.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimits(t *testing.T) {
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		RateLimits(RateLimitConfig{Predict: RateLimit{PerSecond: 0.1, Burst: 1}}))
+
+	request := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request("/predict", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the first request to pass, got %d", rec.Code)
+	}
+	rec := request("/predict", "10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("Expected Retry-After 10, got %q", got)
+	}
+
+	// Other clients and unlimited scopes are unaffected
+	if rec := request("/predict", "10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another IP to pass, got %d", rec.Code)
+	}
+	if rec := request("/learn", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("Expected learning without a limit to pass, got %d", rec.Code)
+	}
+}
+
+func TestLearnQuota(t *testing.T) {
+	now := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(RateLimitConfig{LearnBytesPerDay: 10}, func() time.Time { return now })
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	learn := func(text string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/learn", strings.NewReader(text)))
+		return rec
+	}
+
+	if rec := learn("123456"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected learning within the quota to pass, got %d", rec.Code)
+	}
+	rec := learn("123456")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Expected to retry at midnight, got Retry-After %q", got)
+	}
+
+	// Idling long enough to drop the client's limiters keeps its quota
+	now = now.Add(limiterIdle + time.Minute)
+	if rec := learn("123456"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the quota to survive an idle client, got %d", rec.Code)
+	}
+
+	// The quota resets the next day
+	now = now.Add(time.Hour)
+	if rec := learn("123456"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the quota to reset, got %d", rec.Code)
+	}
+}
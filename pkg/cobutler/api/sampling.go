@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/tracing"
+)
+
+// DefaultTemperature samples edges in proportion to how often they were learned
+const DefaultTemperature = 1.0
+
+// Generation strategies accepted in RequestPayload.Strategy
+const (
+	// StrategyWalk generates replies with a random walk, the default
+	StrategyWalk = "walk"
+	// StrategyBeam generates the most likely reply with beam search
+	StrategyBeam = "beam"
+)
+
+// Beam search defaults for requests that don't set beam_width or max_tokens
+const (
+	DefaultBeamWidth     = 4
+	DefaultBeamMaxTokens = 15
+)
+
+// BeamBrain is implemented by brains that can decode the most likely reply with
+// beam search instead of a random walk
+type BeamBrain interface {
+	ReplyBeam(ctx context.Context, text string, opts BeamReplyOptions) (string, StreamResult, error)
+}
+
+// BeamReplyOptions configures a beam search reply. Brains translate it into a
+// db.BeamOptions for the search.
+type BeamReplyOptions struct {
+	Width     int
+	MaxTokens int
+	// LengthNormalize ranks replies by mean rather than total log-probability
+	LengthNormalize bool
+	// StopTokens end a sequence when it reaches one of them
+	StopTokens []string
+	// Continue searches forward from the end of the text instead of replying to it
+	Continue bool
+}
+
+// Generation modes accepted in RequestPayload.Mode
+const (
+	// ModeReply replies to the text from a pivot word inside it, the default
+	ModeReply = "reply"
+	// ModeContinue continues the text from its end
+	ModeContinue = "continue"
+)
+
+var (
+	// ErrUnknownStrategy is returned for requests with an unknown generation strategy
+	ErrUnknownStrategy = errors.New("unknown strategy")
+	// ErrUnknownMode is returned for requests with an unknown generation mode
+	ErrUnknownMode = errors.New("unknown mode")
+)
+
+// ContinuingBrain is implemented by brains that can continue text from its end
+// instead of replying to it. Tokens are emitted as the walk chooses them, and the
+// edges the walk took are returned.
+type ContinuingBrain interface {
+	ContinueSample(ctx context.Context, prefix string, sampling db.Sampling, emit func(token string) error) ([]int, db.StopReason, error)
+}
+
+// validateGeneration checks the request's strategy and mode
+func validateGeneration(req RequestPayload) error {
+	switch req.Strategy {
+	case "", StrategyWalk, StrategyBeam:
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownStrategy, req.Strategy)
+	}
+
+	switch req.Mode {
+	case "", ModeReply, ModeContinue:
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownMode, req.Mode)
+	}
+
+	return nil
+}
+
+// continues reports whether a request should be continued rather than replied
+// to. Brains that can't continue text reply instead.
+func (h *Handler) continues(req RequestPayload) bool {
+	if req.Mode != ModeContinue {
+		return false
+	}
+	_, ok := h.Brain.(ContinuingBrain)
+	return ok
+}
+
+// beamOptions returns the beam search settings for a request, or false if the
+// request doesn't ask for beam search or the brain can't do it
+func (h *Handler) beamReplyOptions(req RequestPayload) (BeamReplyOptions, bool) {
+	if req.Strategy != StrategyBeam {
+		return BeamReplyOptions{}, false
+	}
+	if _, ok := h.Brain.(BeamBrain); !ok {
+		return BeamReplyOptions{}, false
+	}
+
+	opts := BeamReplyOptions{
+		Width:           req.BeamWidth,
+		MaxTokens:       req.MaxTokens,
+		LengthNormalize: req.LengthNormalize,
+		Continue:        req.Mode == ModeContinue,
+	}
+	if opts.Width <= 0 {
+		opts.Width = DefaultBeamWidth
+	}
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = DefaultBeamMaxTokens
+	}
+	for _, condition := range req.Stop {
+		if condition == StopLine {
+			opts.StopTokens = append(opts.StopTokens, "\n")
+		}
+	}
+	return opts, true
+}
+
+// SamplingBrain is implemented by brains whose walks can be controlled by the
+// caller: random choices come from the request's source, so the same seed and
+// brain give the same reply, and edges are weighted by the request's temperature.
+// models.Replier implements it. Streamed replies return the edges walked.
+type SamplingBrain interface {
+	ReplySample(text string, sampling db.Sampling) (string, error)
+	ReplyStreamSample(ctx context.Context, text string, sampling db.Sampling, emit func(token string) error) ([]int, db.StopReason, error)
+}
+
+// seeded reports whether a reply to req is reproducible from its seed. Replies
+// from brains that don't take the request's random source aren't, so no seed is
+// reported for them.
+func (h *Handler) seeded(req RequestPayload) bool {
+	if _, ok := h.beamReplyOptions(req); ok {
+		return true
+	}
+	if h.continues(req) {
+		return true
+	}
+	_, ok := h.Brain.(SamplingBrain)
+	return ok
+}
+
+// newSampling returns the sampling settings for a request and its seed. Requests
+// without a seed get a fresh one, which is returned so the reply can be reproduced.
+func newSampling(req RequestPayload) (db.Sampling, int64) {
+	seed := time.Now().UnixNano()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	temperature := DefaultTemperature
+	if req.Temperature != nil {
+		temperature = max(*req.Temperature, 0)
+	}
+
+	return db.Sampling{Rand: rand.New(rand.NewSource(seed)), Temperature: temperature}, seed
+}
+
+// reply generates a whole reply with beam search when the request asks for it,
+// otherwise with a walk using the sampling settings when the brain supports them.
+// The stop reason is db.StopEnd unless the brain reports one, and the walk's
+// edges are known unless the brain only has Reply.
+func (h *Handler) reply(ctx context.Context, text string, sampling db.Sampling, req RequestPayload) (string, StreamResult, error) {
+	log := Logger(ctx)
+
+	if opts, ok := h.beamReplyOptions(req); ok {
+		return h.Brain.(BeamBrain).ReplyBeam(ctx, text, opts)
+	}
+	if req.Strategy == StrategyBeam {
+		log.Warn("Brain does not support beam search, using a random walk")
+	}
+
+	if h.continues(req) {
+		var reply strings.Builder
+		edgeIDs, reason, err := h.Brain.(ContinuingBrain).ContinueSample(ctx, text, sampling, func(token string) error {
+			reply.WriteString(token)
+			return nil
+		})
+		return reply.String(), StreamResult{StopReason: reason, EdgeIDs: edgeIDs}, err
+	}
+	if req.Mode == ModeContinue {
+		log.Warn("Brain does not support continuation, replying instead")
+	}
+
+	// Sampled walks are streamed into the reply so their edges can be
+	// reinforced by feedback
+	if sampler, ok := h.Brain.(SamplingBrain); ok {
+		var reply strings.Builder
+		edgeIDs, reason, err := sampler.ReplyStreamSample(ctx, text, sampling, func(token string) error {
+			reply.WriteString(token)
+			return nil
+		})
+		return strings.TrimSpace(reply.String()), StreamResult{StopReason: reason, EdgeIDs: edgeIDs}, err
+	}
+
+	_, span := tracing.Start(ctx, "Brain.Reply")
+	reply, err := h.Brain.Reply(text)
+	tracing.End(span, err)
+	return reply, StreamResult{StopReason: db.StopEnd}, err
+}
+
+// replyStream generates a reply token by token, using the sampling settings when
+// the brain supports them. It reports false if the brain can't stream or the
+// request asks for beam search, which only knows the reply once it is done.
+func (h *Handler) replyStream(ctx context.Context, text string, sampling db.Sampling, req RequestPayload, emit func(token string) error) (StreamResult, bool, error) {
+	if _, ok := h.beamReplyOptions(req); ok {
+		return StreamResult{}, false, nil
+	}
+	if h.continues(req) {
+		edgeIDs, reason, err := h.Brain.(ContinuingBrain).ContinueSample(ctx, text, sampling, emit)
+		return StreamResult{StopReason: reason, EdgeIDs: edgeIDs}, true, err
+	}
+	if sampler, ok := h.Brain.(SamplingBrain); ok {
+		edgeIDs, reason, err := sampler.ReplyStreamSample(ctx, text, sampling, emit)
+		return StreamResult{StopReason: reason, EdgeIDs: edgeIDs}, true, err
+	}
+	if streamer, ok := h.Brain.(StreamingBrain); ok {
+		result, err := streamer.ReplyStream(ctx, text, emit)
+		return result, true, err
+	}
+	return StreamResult{}, false, nil
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// samplingBrain picks reply words with the caller's random source
+type samplingBrain struct {
+	mockBrain
+}
+
+var sampledWords = []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta"}
+
+func (b *samplingBrain) ReplySample(text string, sampling db.Sampling) (string, error) {
+	words := make([]string, 6)
+	for i := range words {
+		words[i] = sampledWords[sampling.Rand.Intn(len(sampledWords))]
+	}
+	return strings.Join(words, " "), nil
+}
+
+func (b *samplingBrain) ReplyStreamSample(ctx context.Context, text string, sampling db.Sampling, emit func(token string) error) ([]int, db.StopReason, error) {
+	reply, _ := b.ReplySample(text, sampling)
+	for _, token := range strings.SplitAfter(reply, " ") {
+		if err := emit(token); err != nil {
+			return nil, db.StopCancelled, nil
+		}
+	}
+	return nil, db.StopEnd, nil
+}
+
+func TestPredictSeed(t *testing.T) {
+	handler := &Handler{
+		Brain: &samplingBrain{},
+	}
+
+	predict := func(req RequestPayload) ResponsePayload {
+		t.Helper()
+
+		jsonData, err := json.Marshal(req)
+		if err != nil {
+			t.Fatalf("Failed to marshal request: %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.Predict(rec, httptest.NewRequest(http.MethodPost, "/predict", bytes.NewBuffer(jsonData)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+		}
+
+		var resp ResponsePayload
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	seed := int64(42)
+	for _, temperature := range []float64{0.5, 2} {
+		first := predict(RequestPayload{Text: "Test input", Seed: &seed, Temperature: &temperature})
+		second := predict(RequestPayload{Text: "Test input", Seed: &seed, Temperature: &temperature})
+		if first.Reply != second.Reply {
+			t.Errorf("Temperature %v: expected the same reply for seed %d, got %q and %q", temperature, seed, first.Reply, second.Reply)
+		}
+		if first.Seed != seed {
+			t.Errorf("Expected seed %d in response, got %d", seed, first.Seed)
+		}
+	}
+
+	// An unseeded reply reports the seed that reproduces it
+	unseeded := predict(RequestPayload{Text: "Test input", MaxTokens: 4})
+	replayed := predict(RequestPayload{Text: "Test input", MaxTokens: 4, Seed: &unseeded.Seed})
+	if unseeded.Reply != replayed.Reply {
+		t.Errorf("Expected seed %d to reproduce %q, got %q", unseeded.Seed, unseeded.Reply, replayed.Reply)
+	}
+
+	// Brains that can't seed replies don't claim the seed reproduces them
+	handler.Brain = &mockBrain{}
+	if resp := predict(RequestPayload{Text: "Test input", Seed: &seed}); resp.Seed != 0 {
+		t.Errorf("Expected no seed from a brain that can't seed replies, got %d", resp.Seed)
+	}
+}
+
+// beamBrain records the beam search options it was asked for
+type beamBrain struct {
+	mockBrain
+	opts BeamReplyOptions
+}
+
+func (b *beamBrain) ReplyBeam(ctx context.Context, text string, opts BeamReplyOptions) (string, StreamResult, error) {
+	b.opts = opts
+	return "most likely reply", StreamResult{StopReason: db.StopToken}, nil
+}
+
+func TestPredictBeam(t *testing.T) {
+	brain := &beamBrain{}
+	handler := &Handler{
+		Brain: brain,
+	}
+
+	tests := []struct {
+		name       string
+		req        RequestPayload
+		wantStatus int
+		wantReply  string
+		wantOpts   BeamReplyOptions
+	}{
+		{
+			name:       "walk by default",
+			req:        RequestPayload{Text: "Test input"},
+			wantStatus: http.StatusOK,
+			wantReply:  "instant mock reply for: Test input",
+		},
+		{
+			name:       "beam defaults",
+			req:        RequestPayload{Text: "Test input", Strategy: StrategyBeam},
+			wantStatus: http.StatusOK,
+			wantReply:  "most likely reply",
+			wantOpts:   BeamReplyOptions{Width: DefaultBeamWidth, MaxTokens: DefaultBeamMaxTokens},
+		},
+		{
+			name:       "beam options",
+			req:        RequestPayload{Text: "Test input", Strategy: StrategyBeam, BeamWidth: 8, MaxTokens: 5, Stop: []string{StopLine}, LengthNormalize: true},
+			wantStatus: http.StatusOK,
+			wantReply:  "most likely reply",
+			wantOpts:   BeamReplyOptions{Width: 8, MaxTokens: 5, StopTokens: []string{"\n"}, LengthNormalize: true},
+		},
+		{
+			name:       "unknown strategy",
+			req:        RequestPayload{Text: "Test input", Strategy: "greedy"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brain.opts = BeamReplyOptions{}
+
+			jsonData, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatalf("Failed to marshal request: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.Predict(rec, httptest.NewRequest(http.MethodPost, "/predict", bytes.NewBuffer(jsonData)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var resp ResponsePayload
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Reply != tt.wantReply {
+				t.Errorf("Expected reply %q, got %q", tt.wantReply, resp.Reply)
+			}
+			if !reflect.DeepEqual(brain.opts, tt.wantOpts) {
+				t.Errorf("Expected beam options %+v, got %+v", tt.wantOpts, brain.opts)
+			}
+		})
+	}
+}
+
+// continuingBrain continues any prefix with a fixed completion
+type continuingBrain struct {
+	mockBrain
+}
+
+func (b *continuingBrain) ContinueSample(ctx context.Context, prefix string, sampling db.Sampling, emit func(token string) error) ([]int, db.StopReason, error) {
+	var edgeIDs []int
+	for i, token := range []string{" brown", " fox"} {
+		edgeIDs = append(edgeIDs, i+1)
+		if err := emit(token); err != nil {
+			return edgeIDs, db.StopCancelled, nil
+		}
+	}
+	return edgeIDs, db.StopEnd, nil
+}
+
+func TestPredictContinue(t *testing.T) {
+	handler := &Handler{
+		Brain: &continuingBrain{},
+	}
+
+	tests := []struct {
+		name       string
+		req        RequestPayload
+		wantStatus int
+		wantReply  string
+	}{
+		{name: "reply by default", req: RequestPayload{Text: "the quick"}, wantStatus: http.StatusOK, wantReply: "instant mock reply for: the quick"},
+		{name: "continue", req: RequestPayload{Text: "the quick", Mode: ModeContinue}, wantStatus: http.StatusOK, wantReply: " brown fox"},
+		{name: "continue with stop", req: RequestPayload{Text: "the quick", Mode: ModeContinue, MaxTokens: 1}, wantStatus: http.StatusOK, wantReply: " brown"},
+		{name: "unknown mode", req: RequestPayload{Text: "the quick", Mode: "chat"}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonData, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatalf("Failed to marshal request: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.Predict(rec, httptest.NewRequest(http.MethodPost, "/predict", bytes.NewBuffer(jsonData)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var resp ResponsePayload
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Reply != tt.wantReply {
+				t.Errorf("Expected reply %q, got %q", tt.wantReply, resp.Reply)
+			}
+		})
+	}
+}
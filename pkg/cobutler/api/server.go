@@ -10,36 +10,68 @@ import (
 
 // Server represents an HTTP server for the API
 type Server struct {
-	server *http.Server
-	port   string
+	server  *http.Server
+	handler *Handler
+	port    string
+	// certFile and keyFile serve HTTPS when set
+	certFile string
+	keyFile  string
 }
 
-// NewServer creates a new server with the given handler and port
-func NewServer(handler *Handler, port string) *Server {
+// NewServer creates a new server with the given handler and port. Requests pass
+// through middleware, the first being the outermost, or DefaultMiddleware if none
+// is given.
+func NewServer(handler *Handler, port string, middleware ...Middleware) *Server {
 	mux := http.NewServeMux()
 	handler.SetupRoutes(mux)
 
+	if len(middleware) == 0 {
+		middleware = DefaultMiddleware()
+	}
+
 	return &Server{
 		server: &http.Server{
 			Addr:    fmt.Sprintf(":%s", port),
-			Handler: mux,
+			Handler: Chain(mux, middleware...),
 		},
-		port: port,
+		handler: handler,
+		port:    port,
+	}
+}
+
+// UseTLS serves HTTPS with the configured certificate, verifying client
+// certificates for Auth when a client CA is configured. It must be called before Start.
+func (s *Server) UseTLS(config TLSConfig) error {
+	tlsConfig, err := config.serverTLSConfig()
+	if err != nil {
+		return err
 	}
+	s.server.TLSConfig = tlsConfig
+	s.certFile = config.CertFile
+	s.keyFile = config.KeyFile
+	return nil
 }
 
 // Start starts the server in a goroutine
 func (s *Server) Start() error {
 	go func() {
-		slog.Info("Server starting", "port", s.port)
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Info("Server starting", "port", s.port, "tls", s.certFile != "")
+		var err error
+		if s.certFile != "" {
+			err = s.server.ListenAndServeTLS(s.certFile, s.keyFile)
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			slog.Error("Server failed to start", "error", err)
 		}
 	}()
 	return nil
 }
 
-// Stop gracefully shuts down the server
+// Stop gracefully shuts down the server. The handler's learn queue is shared with
+// the other frontends, so it is left for the caller to close once they have all
+// stopped.
 func (s *Server) Stop(ctx context.Context) error {
 	slog.Info("Shutting down server...")
 	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -48,7 +80,6 @@ func (s *Server) Stop(ctx context.Context) error {
 	if err := s.server.Shutdown(shutdownCtx); err != nil {
 		return fmt.Errorf("server shutdown failed: %w", err)
 	}
-
 	slog.Info("Server stopped")
 	return nil
 }
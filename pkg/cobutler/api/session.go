@@ -0,0 +1,538 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/jsonrpc"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+)
+
+// sessionContextLines is how many lines before the cursor are sent to the brain,
+// matching the context window used by the editor plugin
+const sessionContextLines = 15
+
+// SessionOpenParams are the parameters of session/open
+type SessionOpenParams struct {
+	Filetype string `json:"filetype"`
+	Text     string `json:"text"`
+}
+
+// SessionEdit replaces Length bytes at Offset in the session buffer with Text
+type SessionEdit struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Text   string `json:"text"`
+}
+
+// SessionChangeParams are the parameters of session/change
+type SessionChangeParams struct {
+	Filetype string        `json:"filetype,omitempty"`
+	Edits    []SessionEdit `json:"edits"`
+}
+
+// SessionPredictParams are the parameters of session/predict
+type SessionPredictParams struct {
+	Cursor          int      `json:"cursor"`
+	MaxWords        int      `json:"max_words,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	UseCache        bool     `json:"use_cache,omitempty"`
+	Stop            []string `json:"stop,omitempty"`
+	MaxTokens       int      `json:"max_tokens,omitempty"`
+	Seed            *int64   `json:"seed,omitempty"`
+	Strategy        string   `json:"strategy,omitempty"`
+	BeamWidth       int      `json:"beam_width,omitempty"`
+	Mode            string   `json:"mode,omitempty"`
+	LengthNormalize bool     `json:"length_normalize,omitempty"`
+}
+
+// SessionLearnParams are the parameters of session/learn
+type SessionLearnParams struct {
+	Text    string `json:"text"`
+	Context string `json:"context,omitempty"`
+}
+
+// SessionAuthenticateParams are the parameters of session/authenticate
+type SessionAuthenticateParams struct {
+	Key string `json:"key"`
+}
+
+// SessionCancelParams are the parameters of $/cancelRequest
+type SessionCancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// SessionServer serves long-lived editor sessions using JSON-RPC over TCP.
+// Each connection keeps its own buffer, updated with incremental edits, so
+// predictions only need to send the cursor position.
+type SessionServer struct {
+	handler  *Handler
+	addr     string
+	listener net.Listener
+	wg       sync.WaitGroup
+	// auth makes sessions send session/authenticate first; namespaces serve
+	// sessions whose key has a namespace
+	auth       *AuthConfig
+	namespaces map[string]*Handler
+	// limits are the rate limits of predictions and learning, if any
+	limits *RateLimiter
+}
+
+// NewSessionServer creates a new session server with the given handler,
+// listening on addr, like "localhost:8081"
+func NewSessionServer(handler *Handler, addr string) *SessionServer {
+	return &SessionServer{
+		handler: handler,
+		addr:    addr,
+	}
+}
+
+// RequireAuth makes every session authenticate with session/authenticate before
+// anything else, using a key from config. It must be called before Start.
+func (s *SessionServer) RequireAuth(config *AuthConfig, namespaces map[string]*Handler) {
+	s.auth = config
+	s.namespaces = namespaces
+}
+
+// RateLimit applies limits to session predictions and learning, counting learned
+// text against the learn quota. Sessions count as their key's client, or their
+// IP address without auth. It must be called before Start.
+func (s *SessionServer) RateLimit(limits *RateLimiter) {
+	s.limits = limits
+}
+
+// Start starts accepting session connections in a goroutine
+func (s *SessionServer) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("session server failed to listen: %w", err)
+	}
+	s.listener = listener
+
+	go func() {
+		slog.Info("Session server starting", "addr", listener.Addr().String())
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("Session server failed to accept", "error", err)
+				}
+				return
+			}
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.ServeConn(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Stop stops accepting new sessions and waits for open ones to finish
+func (s *SessionServer) Stop(ctx context.Context) error {
+	if s.listener == nil {
+		return nil
+	}
+	if err := s.listener.Close(); err != nil {
+		return fmt.Errorf("session server shutdown failed: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("Session server stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("session server shutdown failed: %w", ctx.Err())
+	}
+}
+
+// ServeConn serves a single session until the connection is closed.
+// It can be used directly with stdin/stdout for editors that spawn cobutler.
+func (s *SessionServer) ServeConn(rwc io.ReadWriteCloser) {
+	defer rwc.Close()
+
+	sess := &session{
+		server:  s,
+		handler: s.handler,
+		conn:    jsonrpc.NewConn(rwc, rwc),
+		client:  "ip:",
+	}
+	if conn, ok := rwc.(net.Conn); ok && conn.RemoteAddr() != nil {
+		host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			host = conn.RemoteAddr().String()
+		}
+		sess.client = "ip:" + host
+	}
+	defer sess.cancelPending()
+
+	slog.Info("Session opened")
+	for {
+		req, err := sess.conn.Read()
+		if err != nil {
+			var rpcErr *jsonrpc.Error
+			if errors.As(err, &rpcErr) {
+				sess.conn.ReplyError(nil, rpcErr)
+				continue
+			}
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.Warn("Session read failed", "error", err)
+			}
+			break
+		}
+		sess.dispatch(req)
+	}
+	sess.wg.Wait()
+	slog.Info("Session closed")
+}
+
+// session holds the per-connection state of an editor session
+type session struct {
+	server  *SessionServer
+	handler *Handler
+	conn    *jsonrpc.Conn
+	// key is the key the session authenticated with, if any
+	key *APIKey
+	// client identifies the session for rate limits until it authenticates
+	client string
+
+	mu       sync.Mutex
+	filetype string
+	buffer   string
+	// cancel cancels the in-flight prediction, the request with ID pendingID
+	cancel    context.CancelCauseFunc
+	pendingID string
+	wg        sync.WaitGroup
+}
+
+// dispatch handles a single request. Buffer edits are applied in order on the
+// read loop; predictions run in the background and cancel any earlier one.
+func (s *session) dispatch(req *jsonrpc.Request) {
+	var result interface{}
+	err := s.authorize(req.Method)
+
+	switch {
+	case err != nil:
+	case req.Method == "session/authenticate":
+		var params SessionAuthenticateParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			err = s.authenticate(params)
+		}
+	case req.Method == "session/open":
+		var params SessionOpenParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			s.mu.Lock()
+			s.filetype = params.Filetype
+			s.buffer = params.Text
+			s.mu.Unlock()
+		}
+	case req.Method == "session/change":
+		var params SessionChangeParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			err = s.applyChange(params)
+		}
+	case req.Method == "session/predict":
+		var params SessionPredictParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			if err = s.allow(ScopePredict, 0); err == nil {
+				s.predict(req.ID, params)
+				return
+			}
+		}
+	case req.Method == "session/learn":
+		var params SessionLearnParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			if err = s.allow(ScopeLearn, int64(len(req.Params))); err == nil {
+				err = s.learn(params)
+			}
+		}
+	case req.Method == "$/cancelRequest":
+		var params SessionCancelParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			s.cancelRequest(string(params.ID))
+		}
+	default:
+		err = jsonrpc.NewError(jsonrpc.CodeMethodNotFound, fmt.Sprintf("method not found: %s", req.Method))
+	}
+
+	if req.IsNotification() {
+		if err != nil {
+			slog.Warn("Session notification failed", "method", req.Method, "error", err)
+		}
+		return
+	}
+	s.respond(req.ID, result, err)
+}
+
+// Causes of a cancelled prediction, sent as the message of its error
+var (
+	errSuperseded       = errors.New("superseded by a newer request")
+	errRequestCancelled = errors.New("request cancelled")
+)
+
+// sessionScopes are the scopes keys need for each session method
+var sessionScopes = map[string]string{
+	"session/open":    ScopePredict,
+	"session/change":  ScopePredict,
+	"session/predict": ScopePredict,
+	"session/learn":   ScopeLearn,
+}
+
+// authorize checks that an authenticated session's key may call method. Without
+// auth every method is allowed.
+func (s *session) authorize(method string) error {
+	if s.server.auth == nil || method == "session/authenticate" || method == "$/cancelRequest" {
+		return nil
+	}
+	if s.key == nil {
+		return jsonrpc.NewError(jsonrpc.CodeUnauthorized, "unauthorized: call session/authenticate first")
+	}
+	if scope, ok := sessionScopes[method]; ok && !s.key.HasScope(scope) {
+		return jsonrpc.NewError(jsonrpc.CodeForbidden, fmt.Sprintf("key %s lacks the %s scope", s.key.Name, scope))
+	}
+	return nil
+}
+
+// allow takes a request of size bytes for scope from the session's rate limits,
+// like the HTTP rate limits
+func (s *session) allow(scope string, size int64) error {
+	if s.server.limits == nil {
+		return nil
+	}
+	client := s.client
+	if s.key != nil {
+		client = "key:" + s.key.Name
+	}
+
+	retryAfter, ok := s.server.limits.Allow(client, scope, size)
+	if ok {
+		return nil
+	}
+	metrics.RateLimited.WithLabelValues(scope).Inc()
+	slog.Warn("Session rate limited", "client", client, "scope", scope, "retry_after", retryAfter)
+	return jsonrpc.NewError(jsonrpc.CodeRateLimited, fmt.Sprintf("too many requests, retry after %s", retryAfter.Round(time.Second)))
+}
+
+// authenticate sets the session's key, and its brain when the key has a
+// namespace. A session authenticates once.
+func (s *session) authenticate(params SessionAuthenticateParams) error {
+	if s.server.auth == nil {
+		return nil
+	}
+	if s.key != nil {
+		return jsonrpc.NewError(jsonrpc.CodeInvalidRequest, "session is already authenticated")
+	}
+
+	key, ok := s.server.auth.AuthenticateToken(params.Key)
+	if !ok {
+		slog.Warn("Unauthenticated session")
+		return jsonrpc.NewError(jsonrpc.CodeUnauthorized, "unauthorized")
+	}
+	if key.Namespace != "" {
+		handler, ok := s.server.namespaces[key.Namespace]
+		if !ok {
+			slog.Error("No brain for namespace", "namespace", key.Namespace)
+			return jsonrpc.NewError(jsonrpc.CodeInternalError, "no brain for namespace")
+		}
+		s.handler = handler
+	}
+	s.key = &key
+	slog.Info("Session authenticated", "key", key.Name)
+	return nil
+}
+
+// respond sends a result or converts err into a JSON-RPC error
+func (s *session) respond(id json.RawMessage, result interface{}, err error) {
+	if err == nil {
+		if result == nil {
+			result = struct{}{}
+		}
+		s.conn.Reply(id, result)
+		return
+	}
+
+	var rpcErr *jsonrpc.Error
+	if !errors.As(err, &rpcErr) {
+		rpcErr = jsonrpc.NewError(jsonrpc.CodeInternalError, err.Error())
+	}
+	s.conn.ReplyError(id, rpcErr)
+}
+
+// applyChange applies incremental edits to the session buffer
+func (s *session) applyChange(params SessionChangeParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if params.Filetype != "" {
+		s.filetype = params.Filetype
+	}
+
+	buffer := s.buffer
+	for _, edit := range params.Edits {
+		if edit.Offset < 0 || edit.Length < 0 || edit.Offset+edit.Length > len(buffer) {
+			return jsonrpc.NewError(jsonrpc.CodeInvalidParams,
+				fmt.Sprintf("edit out of range: offset %d length %d buffer %d", edit.Offset, edit.Length, len(buffer)))
+		}
+		buffer = buffer[:edit.Offset] + edit.Text + buffer[edit.Offset+edit.Length:]
+	}
+	s.buffer = buffer
+
+	return nil
+}
+
+// predict cancels any in-flight prediction and starts a new one for the cursor position
+func (s *session) predict(id json.RawMessage, params SessionPredictParams) {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel(errSuperseded)
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s.cancel = cancel
+	s.pendingID = string(id)
+	filetype := s.filetype
+	text, err := contextBeforeCursor(s.buffer, params.Cursor)
+	s.mu.Unlock()
+
+	if err == nil {
+		if invalid := validateGeneration(RequestPayload{Strategy: params.Strategy, Mode: params.Mode}); invalid != nil {
+			err = jsonrpc.NewError(jsonrpc.CodeInvalidParams, invalid.Error())
+		}
+	}
+	if err != nil {
+		s.finish(id, cancel)
+		s.respond(id, nil, err)
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.finish(id, cancel)
+
+		if snippet, ok := s.handler.FindSnippet(text, filetype); ok {
+			s.respond(id, ResponsePayload{
+				Reply:   snippet.Text,
+				Kind:    KindSnippet,
+				Snippet: snippet.Body,
+				Replace: snippet.Replace,
+			}, nil)
+			return
+		}
+
+		s.handler.configureCache(params.UseCache)
+
+		completion, err := s.handler.GenerateReply(ctx, filetype, strings.TrimSpace(text), RequestPayload{
+			MaxWords:        params.MaxWords,
+			Temperature:     params.Temperature,
+			UseCache:        params.UseCache,
+			Stop:            params.Stop,
+			MaxTokens:       params.MaxTokens,
+			Seed:            params.Seed,
+			Strategy:        params.Strategy,
+			BeamWidth:       params.BeamWidth,
+			Mode:            params.Mode,
+			LengthNormalize: params.LengthNormalize,
+		})
+		if errors.Is(err, context.Canceled) {
+			s.respond(id, nil, jsonrpc.NewError(jsonrpc.CodeRequestCancelled, context.Cause(ctx).Error()))
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to generate session reply", "error", err)
+			s.respond(id, nil, err)
+			return
+		}
+
+		s.respond(id, ResponsePayload{
+			Reply:        completion.Reply,
+			FinishReason: completion.FinishReason,
+			Seed:         completion.Seed,
+		}, nil)
+	}()
+}
+
+// learn trains the brain from an accepted completion
+func (s *session) learn(params SessionLearnParams) error {
+	_, err := s.handler.LearnText(context.Background(), params.Text, params.Context)
+	return err
+}
+
+// finish releases the context of the prediction with the given ID, clearing it
+// as the in-flight prediction unless a newer one replaced it
+func (s *session) finish(id json.RawMessage, cancel context.CancelCauseFunc) {
+	cancel(nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pendingID == string(id) {
+		s.cancel = nil
+		s.pendingID = ""
+	}
+}
+
+// cancelRequest cancels the in-flight prediction if it is the request with the
+// given ID; requests that already finished are ignored
+func (s *session) cancelRequest(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil && s.pendingID == id {
+		s.cancel(errRequestCancelled)
+		s.cancel = nil
+		s.pendingID = ""
+	}
+}
+
+// cancelPending cancels the in-flight prediction, if any
+func (s *session) cancelPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		s.cancel(errRequestCancelled)
+		s.cancel = nil
+		s.pendingID = ""
+	}
+}
+
+// contextBeforeCursor returns the trailing lines of buffer up to the cursor offset
+func contextBeforeCursor(buffer string, cursor int) (string, error) {
+	if cursor < 0 || cursor > len(buffer) {
+		return "", jsonrpc.NewError(jsonrpc.CodeInvalidParams,
+			fmt.Sprintf("cursor %d out of range for buffer of %d bytes", cursor, len(buffer)))
+	}
+
+	lines := strings.Split(buffer[:cursor], "\n")
+	if len(lines) > sessionContextLines+1 {
+		lines = lines[len(lines)-sessionContextLines-1:]
+	}
+	// Trailing whitespace is kept so templates only trigger after a complete word
+	return strings.TrimLeft(strings.Join(lines, "\n"), " \t\r\n"), nil
+}
+
+// decodeParams unmarshals request parameters, reporting invalid params on failure
+func decodeParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return jsonrpc.NewError(jsonrpc.CodeInvalidParams, err.Error())
+	}
+	return nil
+}
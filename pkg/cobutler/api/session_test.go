@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/jsonrpc"
+)
+
+// sessionResponse is a JSON-RPC response to a session request
+type sessionResponse struct {
+	ID     int             `json:"id"`
+	Result ResponsePayload `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+// sessionCall writes a framed JSON-RPC request and reads the framed response
+func sessionCall(t *testing.T, conn net.Conn, reader *bufio.Reader, id int, method string, params interface{}) sessionResponse {
+	t.Helper()
+	sessionSend(t, conn, id, method, params)
+	return sessionRead(t, reader)
+}
+
+// sessionSend writes a framed JSON-RPC request without waiting for the response.
+// An id of 0 sends a notification.
+func sessionSend(t *testing.T, conn net.Conn, id int, method string, params interface{}) {
+	t.Helper()
+
+	msg := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+	if id != 0 {
+		msg["id"] = id
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	go fmt.Fprintf(conn, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// sessionRead reads the next framed response
+func sessionRead(t *testing.T, reader *bufio.Reader) sessionResponse {
+	t.Helper()
+
+	headers, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("Failed to read response headers: %v", err)
+	}
+	length, _ := strconv.Atoi(headers.Get("Content-Length"))
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+
+	var resp sessionResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestSessionPredict(t *testing.T) {
+	server := NewSessionServer(&Handler{Brain: &mockBrain{}}, "localhost:0")
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go server.ServeConn(conn)
+	reader := bufio.NewReader(client)
+
+	// Open a buffer and type on the second line incrementally
+	sessionCall(t, client, reader, 1, "session/open", SessionOpenParams{Filetype: "text", Text: "first line\n"})
+	sessionCall(t, client, reader, 2, "session/change", SessionChangeParams{
+		Edits: []SessionEdit{{Offset: 11, Length: 0, Text: "second"}},
+	})
+
+	resp := sessionCall(t, client, reader, 3, "session/predict", SessionPredictParams{Cursor: 17})
+	if resp.Error != nil {
+		t.Fatalf("Expected no error, got code %d", resp.Error.Code)
+	}
+
+	expectedReply := "instant mock reply for: first line\nsecond"
+	if resp.ID != 3 || resp.Result.Reply != expectedReply {
+		t.Errorf("Expected reply %q for id 3, got %q for id %d", expectedReply, resp.Result.Reply, resp.ID)
+	}
+
+	// Edits outside the buffer are rejected
+	resp = sessionCall(t, client, reader, 4, "session/change", SessionChangeParams{
+		Edits: []SessionEdit{{Offset: 100, Length: 1}},
+	})
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("Expected invalid params error for out of range edit, got %+v", resp.Error)
+	}
+}
+
+func TestSessionAuth(t *testing.T) {
+	server := NewSessionServer(&Handler{Brain: &mockBrain{}}, "localhost:0")
+	server.RequireAuth(&AuthConfig{Keys: []APIKey{
+		{Name: "editor", Key: "editor-key", Scopes: []string{ScopePredict}},
+	}}, nil)
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go server.ServeConn(conn)
+	reader := bufio.NewReader(client)
+
+	open := SessionOpenParams{Filetype: "text", Text: "hello"}
+	if resp := sessionCall(t, client, reader, 1, "session/open", open); resp.Error == nil || resp.Error.Code != jsonrpc.CodeUnauthorized {
+		t.Errorf("Expected an unauthorized error before authenticating, got %+v", resp.Error)
+	}
+	if resp := sessionCall(t, client, reader, 2, "session/authenticate", SessionAuthenticateParams{Key: "nope"}); resp.Error == nil || resp.Error.Code != jsonrpc.CodeUnauthorized {
+		t.Errorf("Expected an unknown key to be rejected, got %+v", resp.Error)
+	}
+	if resp := sessionCall(t, client, reader, 3, "session/authenticate", SessionAuthenticateParams{Key: "editor-key"}); resp.Error != nil {
+		t.Fatalf("Expected the key to authenticate, got code %d", resp.Error.Code)
+	}
+	if resp := sessionCall(t, client, reader, 4, "session/open", open); resp.Error != nil {
+		t.Errorf("Expected an authenticated session to open a buffer, got code %d", resp.Error.Code)
+	}
+	if resp := sessionCall(t, client, reader, 5, "session/learn", SessionLearnParams{Text: "hello"}); resp.Error == nil || resp.Error.Code != jsonrpc.CodeForbidden {
+		t.Errorf("Expected learning without the learn scope to be forbidden, got %+v", resp.Error)
+	}
+}
+
+func TestSessionRateLimits(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(RateLimitConfig{
+		Learn:            RateLimit{PerSecond: 1, Burst: 2},
+		LearnBytesPerDay: 100,
+	}, func() time.Time { return now })
+
+	server := NewSessionServer(&Handler{Brain: &mockBrain{}}, "localhost:0")
+	server.RateLimit(limiter)
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go server.ServeConn(conn)
+	reader := bufio.NewReader(client)
+
+	if resp := sessionCall(t, client, reader, 1, "session/learn", SessionLearnParams{Text: "hello"}); resp.Error != nil {
+		t.Fatalf("Expected the first learn to be allowed, got code %d", resp.Error.Code)
+	}
+	// The learn quota is checked before the rate, so an oversized text doesn't
+	// use up the burst
+	long := SessionLearnParams{Text: strings.Repeat("a", 100)}
+	if resp := sessionCall(t, client, reader, 2, "session/learn", long); resp.Error == nil || resp.Error.Code != jsonrpc.CodeRateLimited {
+		t.Errorf("Expected a learn over the quota to be rate limited, got %+v", resp.Error)
+	}
+	if resp := sessionCall(t, client, reader, 3, "session/learn", SessionLearnParams{Text: "world"}); resp.Error != nil {
+		t.Fatalf("Expected the second learn to be allowed, got code %d", resp.Error.Code)
+	}
+	if resp := sessionCall(t, client, reader, 4, "session/learn", SessionLearnParams{Text: "again"}); resp.Error == nil || resp.Error.Code != jsonrpc.CodeRateLimited {
+		t.Errorf("Expected a learn over the burst to be rate limited, got %+v", resp.Error)
+	}
+
+	// Predictions have their own limit
+	if resp := sessionCall(t, client, reader, 5, "session/predict", SessionPredictParams{}); resp.Error != nil {
+		t.Errorf("Expected predictions to be allowed, got code %d", resp.Error.Code)
+	}
+}
+
+// blockingBrain continues text until its context is cancelled, sending the
+// context of each continuation on started
+type blockingBrain struct {
+	mockBrain
+	started chan context.Context
+}
+
+func (b *blockingBrain) ContinueSample(ctx context.Context, text string, sampling db.Sampling, emit func(token string) error) ([]int, db.StopReason, error) {
+	b.started <- ctx
+	<-ctx.Done()
+	return nil, db.StopCancelled, ctx.Err()
+}
+
+func TestSessionCancelRequest(t *testing.T) {
+	brain := &blockingBrain{started: make(chan context.Context, 1)}
+	server := NewSessionServer(&Handler{Brain: brain}, "localhost:0")
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go server.ServeConn(conn)
+	reader := bufio.NewReader(client)
+
+	sessionCall(t, client, reader, 1, "session/open", SessionOpenParams{Filetype: "text", Text: "hello world"})
+	sessionSend(t, client, 2, "session/predict", SessionPredictParams{Cursor: 11, Mode: ModeContinue})
+	ctx := <-brain.started
+
+	// Cancelling another request leaves the prediction running
+	sessionSend(t, client, 0, "$/cancelRequest", SessionCancelParams{ID: json.RawMessage("7")})
+	if resp := sessionCall(t, client, reader, 3, "session/open", SessionOpenParams{Text: "hello"}); resp.ID != 3 {
+		t.Fatalf("Expected the response to request 3, got %d", resp.ID)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Expected cancelling request 7 to leave request 2 running")
+	}
+
+	sessionSend(t, client, 0, "$/cancelRequest", SessionCancelParams{ID: json.RawMessage("2")})
+	resp := sessionRead(t, reader)
+	if resp.ID != 2 || resp.Error == nil || resp.Error.Code != jsonrpc.CodeRequestCancelled {
+		t.Errorf("Expected request 2 to be cancelled, got id %d error %+v", resp.ID, resp.Error)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// BrainStats summarizes the size and contents of a brain
+type BrainStats = db.Stats
+
+// StatsBrain is implemented by brains that can report their size. Brains backed
+// by a Graph report its Stats with db.StatsTop tokens and n-grams.
+type StatsBrain interface {
+	Stats() (BrainStats, error)
+}
+
+// BrainSize is the number of tokens, nodes and edges in a brain
+type BrainSize = db.Size
+
+// SizeBrain is implemented by brains that can count their tokens, nodes and
+// edges more cheaply than their full Stats. Brains backed by a Graph report its
+// Size.
+type SizeBrain interface {
+	Size() (BrainSize, error)
+}
+
+// Stats handles GET /stats, reporting the size and contents of the brain
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	log := Logger(r.Context())
+
+	if r.Method != http.MethodGet {
+		log.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	statsBrain, ok := h.Brain.(StatsBrain)
+	if !ok {
+		log.Warn("Brain does not report statistics")
+		writeError(w, r, http.StatusNotImplemented, "Stats not supported")
+		return
+	}
+
+	stats, err := statsBrain.Stats()
+	if err != nil {
+		log.Error("Failed to get stats", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to get stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
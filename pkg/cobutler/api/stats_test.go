@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+)
+
+// statsBrain is a mock brain that reports fixed stats
+type statsBrain struct {
+	mockBrain
+}
+
+func (b *statsBrain) Stats() (BrainStats, error) {
+	return BrainStats{Order: 2, Tokens: 3, TopTokens: []db.Frequency{{Text: "func", Count: 7}}}, nil
+}
+
+func TestStats(t *testing.T) {
+	handler := &Handler{Brain: &statsBrain{}}
+
+	rec := httptest.NewRecorder()
+	handler.Stats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var stats BrainStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stats.Order != 2 || stats.Tokens != 3 || len(stats.TopTokens) != 1 || stats.TopTokens[0].Text != "func" {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Brains without stats are reported as not implemented
+	rec = httptest.NewRecorder()
+	(&Handler{Brain: &mockBrain{}}).Stats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotImplemented, rec.Code)
+	}
+}
+
+func TestBrainSizeMetrics(t *testing.T) {
+	// Each handler reports its own brain's size under its namespace
+	defaultMux, teamMux := http.NewServeMux(), http.NewServeMux()
+	(&Handler{Brain: &statsBrain{}}).SetupRoutes(defaultMux)
+	(&Handler{Brain: &statsBrain{}, Namespace: "team"}).SetupRoutes(teamMux)
+	defer metrics.SetBrainSize("", nil)
+	defer metrics.SetBrainSize("team", nil)
+
+	rec := httptest.NewRecorder()
+	defaultMux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`cobutler_brain_tokens{namespace=""} 3`,
+		`cobutler_brain_tokens{namespace="team"} 3`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
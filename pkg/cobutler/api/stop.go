@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/syntax"
+)
+
+// Stop conditions accepted in RequestPayload.Stop. The finish reason of a reply
+// cut by one of them is the condition's name.
+const (
+	// StopLine stops at the end of the first line
+	StopLine = "line"
+	// StopStatement stops at the end of the first statement
+	StopStatement = "statement"
+	// StopScope stops after the closer of the scope the cursor is in
+	StopScope = "scope"
+	// StopSentence stops after the first sentence of prose
+	StopSentence = "sentence"
+)
+
+// Finish reasons for limits applied by the handler rather than the walk, which
+// reports a db.StopReason
+const (
+	// StopReasonMaxTokens is the finish reason when RequestPayload.MaxTokens is reached
+	StopReasonMaxTokens = "max_tokens"
+	// StopReasonMaxWords is the finish reason when RequestPayload.MaxWords is reached
+	StopReasonMaxWords = "max_words"
+)
+
+// errStopCondition stops generation once a stop condition is met
+var errStopCondition = errors.New("stop condition met")
+
+// stoppedEarly reports whether err only means generation was stopped by a stop
+// condition or the word limit. Brains may return the error emit gave them.
+func stoppedEarly(err error) bool {
+	return errors.Is(err, errStopCondition) || errors.Is(err, errMaxWords)
+}
+
+// sentenceEndRegex matches a sentence terminator followed by whitespace or the end
+var sentenceEndRegex = regexp.MustCompile(`[.!?]+(\s|$)`)
+
+// stopper applies a request's stop conditions to a reply as it is generated
+type stopper struct {
+	prefix     string
+	filetype   string
+	conditions map[string]bool
+	maxTokens  int
+
+	tokens int
+	text   strings.Builder
+}
+
+// newStopper creates a stopper for a reply to prefix
+func newStopper(prefix, filetype string, req RequestPayload) *stopper {
+	conditions := make(map[string]bool)
+	for _, condition := range req.Stop {
+		conditions[condition] = true
+	}
+
+	return &stopper{
+		prefix:     prefix,
+		filetype:   filetype,
+		conditions: conditions,
+		maxTokens:  req.MaxTokens,
+	}
+}
+
+// active reports whether any stop condition is set
+func (s *stopper) active() bool {
+	return len(s.conditions) > 0 || s.maxTokens > 0
+}
+
+// push adds a generated token. It returns the part of the token to keep and,
+// once generation should stop, the finish reason.
+func (s *stopper) push(token string) (string, string) {
+	if !s.active() {
+		return token, ""
+	}
+
+	from := s.text.Len()
+	s.text.WriteString(token)
+	text := s.text.String()
+
+	if end, reason := s.boundary(text, from); reason != "" {
+		return text[from:end], reason
+	}
+
+	if strings.TrimSpace(token) != "" {
+		s.tokens++
+	}
+	if s.maxTokens > 0 && s.tokens >= s.maxTokens {
+		return token, StopReasonMaxTokens
+	}
+
+	return token, ""
+}
+
+// truncate applies the stop conditions to a complete reply, one word at a time.
+// Whitespace left after the stopping point is dropped.
+func (s *stopper) truncate(reply string) (string, string) {
+	var kept strings.Builder
+	for _, token := range strings.SplitAfter(reply, " ") {
+		keep, reason := s.push(token)
+		kept.WriteString(keep)
+		if reason != "" {
+			return strings.TrimRight(kept.String(), " \t"), reason
+		}
+	}
+	return kept.String(), ""
+}
+
+// boundary returns the end of the earliest enabled boundary in text at or after
+// from, and its condition
+func (s *stopper) boundary(text string, from int) (int, string) {
+	end, reason := len(text)+1, ""
+	found := func(at int, condition string) {
+		if at < from {
+			at = from
+		}
+		if at < end {
+			end, reason = at, condition
+		}
+	}
+
+	if s.conditions[StopLine] {
+		// Leading line breaks don't count as the end of the first line
+		for i := from; i < len(text); i++ {
+			if text[i] == '\n' && strings.TrimSpace(text[:i]) != "" {
+				found(i, StopLine)
+				break
+			}
+		}
+	}
+
+	if syntax.Supported(s.filetype) {
+		statement, scope := s.conditions[StopStatement], s.conditions[StopScope]
+		if at, boundary, ok := syntax.FindBoundary(s.prefix, text, s.filetype, statement, scope); ok {
+			condition := StopStatement
+			if boundary == syntax.BoundaryScope {
+				condition = StopScope
+			}
+			found(at, condition)
+		}
+	} else if s.conditions[StopSentence] {
+		// Sentences only end prose; in code a dot is usually a selector
+		if loc := sentenceEndRegex.FindStringIndex(text[max(from-1, 0):]); loc != nil {
+			at := max(from-1, 0) + loc[1]
+			found(len(strings.TrimRight(text[:at], " \t\r\n")), StopSentence)
+		}
+	}
+
+	if reason == "" {
+		return 0, ""
+	}
+	return end, reason
+}
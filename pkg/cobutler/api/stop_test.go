@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStopperTruncate(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     string
+		filetype   string
+		req        RequestPayload
+		reply      string
+		wantReply  string
+		wantReason string
+	}{
+		{
+			name:       "line",
+			prefix:     "hello",
+			req:        RequestPayload{Stop: []string{StopLine}},
+			reply:      "world\nagain",
+			wantReply:  "world",
+			wantReason: StopLine,
+		},
+		{
+			name:       "statement",
+			prefix:     "func f() {\n\tx := ",
+			filetype:   "go",
+			req:        RequestPayload{Stop: []string{StopStatement}},
+			reply:      "compute(a, b)\n\ty := 2\n}",
+			wantReply:  "compute(a, b)",
+			wantReason: StopStatement,
+		},
+		{
+			name:       "scope",
+			prefix:     "func f() {\n\tx := 1\n\t",
+			filetype:   "go",
+			req:        RequestPayload{Stop: []string{StopScope}},
+			reply:      "return x\n}\n\nfunc g() {}",
+			wantReply:  "return x\n}",
+			wantReason: StopScope,
+		},
+		{
+			name:       "sentence",
+			prefix:     "The",
+			req:        RequestPayload{Stop: []string{StopSentence}},
+			reply:      "quick fox jumps. Then it sleeps.",
+			wantReply:  "quick fox jumps.",
+			wantReason: StopSentence,
+		},
+		{
+			name:       "max tokens",
+			prefix:     "The",
+			req:        RequestPayload{MaxTokens: 2},
+			reply:      "quick fox jumps",
+			wantReply:  "quick fox",
+			wantReason: StopReasonMaxTokens,
+		},
+		{
+			name:      "no condition met",
+			prefix:    "The",
+			req:       RequestPayload{Stop: []string{StopLine}},
+			reply:     "quick fox jumps",
+			wantReply: "quick fox jumps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, reason := newStopper(tt.prefix, tt.filetype, tt.req).truncate(tt.reply)
+			if reply != tt.wantReply || reason != tt.wantReason {
+				t.Errorf("truncate(%q) = %q, %q; want %q, %q", tt.reply, reply, reason, tt.wantReply, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestPredictStop(t *testing.T) {
+	handler := &Handler{
+		Brain: &mockBrain{},
+	}
+
+	jsonData, err := json.Marshal(RequestPayload{Text: "Test input", MaxTokens: 3})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/predict", bytes.NewBuffer(jsonData))
+	rec := httptest.NewRecorder()
+	handler.Predict(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var resp ResponsePayload
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if want := "instant mock reply"; resp.Reply != want {
+		t.Errorf("Expected reply %q, got %q", want, resp.Reply)
+	}
+	if resp.FinishReason != StopReasonMaxTokens {
+		t.Errorf("Expected finish reason %q, got %q", StopReasonMaxTokens, resp.FinishReason)
+	}
+}
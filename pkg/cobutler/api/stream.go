@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/tracing"
+)
+
+// errMaxWords stops a streamed generation once the word limit has been reached
+var errMaxWords = errors.New("max words reached")
+
+// StreamResult describes a finished generation
+type StreamResult struct {
+	Score float64
+	// StopReason is why the walk or beam search ended
+	StopReason db.StopReason
+	// EdgeIDs are the edges the walk took, in order, so feedback can reinforce them
+	EdgeIDs []int
+}
+
+// StreamingBrain is implemented by brains that can emit reply tokens while the walk runs.
+// emit is called once per token; when it returns an error generation must stop.
+type StreamingBrain interface {
+	ReplyStream(ctx context.Context, text string, emit func(token string) error) (StreamResult, error)
+}
+
+// StreamTokenEvent is sent for every generated token
+type StreamTokenEvent struct {
+	Token string `json:"token"`
+}
+
+// StreamDoneEvent is the final event of a streamed reply. StopReason is a
+// db.StopReason, StopReasonMaxWords, StopReasonMaxTokens or a stop condition.
+type StreamDoneEvent struct {
+	Reply      string  `json:"reply"`
+	Score      float64 `json:"score"`
+	StopReason string  `json:"stop_reason"`
+}
+
+// sseWriter writes Server-Sent Events and flushes after each one
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// send writes a single event with a JSON encoded payload
+func (s *sseWriter) send(event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// PredictStream handles requests to stream a prediction as Server-Sent Events.
+// Accepts GET with query parameters or POST with the same JSON body as Predict.
+func (h *Handler) PredictStream(w http.ResponseWriter, r *http.Request) {
+	log := Logger(r.Context())
+
+	var req RequestPayload
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Text = query.Get("text")
+		req.MaxWords, _ = strconv.Atoi(query.Get("max_words"))
+		req.UseCache, _ = strconv.ParseBool(query.Get("use_cache"))
+		req.MaxTokens, _ = strconv.Atoi(query.Get("max_tokens"))
+		req.Strategy = query.Get("strategy")
+		req.Mode = query.Get("mode")
+		req.BeamWidth, _ = strconv.Atoi(query.Get("beam_width"))
+		req.LengthNormalize, _ = strconv.ParseBool(query.Get("length_normalize"))
+		if temperature, err := strconv.ParseFloat(query.Get("temperature"), 64); err == nil {
+			req.Temperature = &temperature
+		}
+		if seed, err := strconv.ParseInt(query.Get("seed"), 10, 64); err == nil {
+			req.Seed = &seed
+		}
+		if stop := query.Get("stop"); stop != "" {
+			req.Stop = strings.Split(stop, ",")
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			decodeError(w, r, err)
+			return
+		}
+	default:
+		log.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if err := validateGeneration(req); err != nil {
+		log.Warn("Invalid request", "error", err)
+		writeError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("Streaming not supported by response writer")
+		writeError(w, r, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	log.Info("Received predict stream request",
+		"text_length", len(req.Text),
+		"max_words", req.MaxWords,
+		"use_cache", req.UseCache)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sse := &sseWriter{w: w, flusher: flusher}
+
+	// Cancelled when the client disconnects, which stops the walk
+	ctx := r.Context()
+
+	done, err := h.StreamReply(ctx, req, func(token string) error {
+		return sse.send("token", StreamTokenEvent{Token: token})
+	})
+	if ctx.Err() != nil {
+		log.Info("Predict stream cancelled by client")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to stream reply", "error", err)
+		sse.send("error", map[string]string{"error": "Failed to generate reply"})
+		return
+	}
+
+	sse.send("done", done)
+	metrics.ReplyLength.Observe(float64(len(strings.Fields(done.Reply))))
+
+	log.Info("Predict stream succeeded",
+		"response_length", len(done.Reply),
+		"stop_reason", done.StopReason)
+}
+
+// StreamReply generates a reply for req, calling emit for every token as soon as it
+// is produced. It is shared by the SSE endpoint and other streaming frontends.
+// Brains that can't stream, and beam search, only produce the whole reply; it is
+// then emitted word by word once generated, so frontends see the same events.
+func (h *Handler) StreamReply(ctx context.Context, req RequestPayload, emit func(token string) error) (StreamDoneEvent, error) {
+	h.configureCache(req.UseCache)
+
+	_, span := tracing.Start(ctx, "extractCodeMetadata")
+	filetype, processedText := extractCodeMetadata(req.Text)
+	span.End()
+
+	var reply strings.Builder
+	words := 0
+	limited := false
+	stop := newStopper(processedText, filetype, req)
+	stopReason := ""
+	send := func(token string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if req.MaxWords > 0 && strings.TrimSpace(token) != "" {
+			if words >= req.MaxWords {
+				limited = true
+				return errMaxWords
+			}
+			words++
+		}
+		keep, reason := stop.push(token)
+		if keep != "" {
+			reply.WriteString(keep)
+			if err := emit(keep); err != nil {
+				return err
+			}
+		}
+		if reason != "" {
+			stopReason = reason
+			return errStopCondition
+		}
+		return nil
+	}
+
+	sampling, _ := newSampling(req)
+	attemptCtx, span := tracing.Start(ctx, "reply attempt",
+		attribute.String("strategy", req.Strategy),
+		attribute.String("mode", req.Mode))
+	result, streamed, err := h.replyStream(attemptCtx, processedText, sampling, req, send)
+	tracing.End(span, err)
+	if err != nil && !stoppedEarly(err) {
+		return StreamDoneEvent{}, err
+	}
+	if !streamed {
+		full, fullResult, err := h.reply(ctx, processedText, sampling, req)
+		if err != nil {
+			return StreamDoneEvent{}, err
+		}
+		result = fullResult
+		for _, token := range strings.SplitAfter(full, " ") {
+			if token == "" {
+				continue
+			}
+			if err := send(token); err != nil {
+				result.StopReason = db.StopCancelled
+				break
+			}
+		}
+	}
+
+	finishReason := string(result.StopReason)
+	if limited {
+		finishReason = StopReasonMaxWords
+	}
+	if stopReason != "" {
+		finishReason = stopReason
+	}
+
+	if err := ctx.Err(); err != nil {
+		return StreamDoneEvent{}, err
+	}
+
+	// Post-processing may append closing brackets; send them as a last token.
+	// Streamed tokens can't be taken back, so cuts are not applied.
+	text := strings.TrimSpace(reply.String())
+	if processed := postProcessCodeReply(processedText, text, filetype); strings.HasPrefix(processed, text) && len(processed) > len(text) {
+		suffix := processed[len(text):]
+		if err := emit(suffix); err != nil {
+			return StreamDoneEvent{}, err
+		}
+		text = processed
+	}
+
+	return StreamDoneEvent{
+		Reply:      text,
+		Score:      result.Score,
+		StopReason: finishReason,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/models"
+)
+
+// AdminTemplates lists, adds and removes code templates.
+//
+//	GET    /admin/templates?language=go           lists templates
+//	POST   /admin/templates                       adds or replaces a template
+//	DELETE /admin/templates?language=go&name=todo removes an added template
+func (h *Handler) AdminTemplates(w http.ResponseWriter, r *http.Request) {
+	log := Logger(r.Context())
+
+	store := h.templateStore()
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(store.List(r.URL.Query().Get("language")))
+
+	case http.MethodPost:
+		var tmpl models.Template
+		if err := json.NewDecoder(r.Body).Decode(&tmpl); err != nil {
+			decodeError(w, r, err)
+			return
+		}
+
+		if err := tmpl.Validate(); err != nil {
+			log.Warn("Invalid template", "error", err)
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := store.Add(tmpl); err != nil {
+			log.Error("Failed to add template", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Failed to add template")
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		log.Info("Added template", "language", tmpl.Language, "name", tmpl.Name)
+
+	case http.MethodDelete:
+		query := r.URL.Query()
+		err := store.Remove(query.Get("language"), query.Get("name"))
+		switch {
+		case errors.Is(err, models.ErrTemplateNotFound):
+			writeError(w, r, http.StatusNotFound, err.Error())
+			return
+		case errors.Is(err, models.ErrTemplateReadOnly):
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			log.Error("Failed to remove template", "error", err)
+			writeError(w, r, http.StatusInternalServerError, "Failed to remove template")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		log.Info("Removed template", "language", query.Get("language"), "name", query.Get("name"))
+
+	default:
+		log.Warn("Method not allowed", "method", r.Method, "path", r.URL.Path)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
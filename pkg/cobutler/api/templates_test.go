@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/models"
+)
+
+func TestAdminTemplates(t *testing.T) {
+	handler := &Handler{
+		Brain: &mockBrain{},
+	}
+
+	// Add a template that replaces its trigger
+	tmpl := models.Template{Language: "go", Name: "todo", Triggers: []string{"todo"}, Body: "// TODO: ${1:task}"}
+	jsonData, err := json.Marshal(tmpl)
+	if err != nil {
+		t.Fatalf("Failed to marshal template: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.AdminTemplates(rec, httptest.NewRequest(http.MethodPost, "/admin/templates", bytes.NewBuffer(jsonData)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rec.Code)
+	}
+
+	// Predictions use it straight away
+	jsonData, _ = json.Marshal(RequestPayload{Text: "// FILETYPE: go\nx := 1\ntodo"})
+	rec = httptest.NewRecorder()
+	handler.Predict(rec, httptest.NewRequest(http.MethodPost, "/predict", bytes.NewBuffer(jsonData)))
+
+	var resp ResponsePayload
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Reply != "// TODO: task" || resp.Replace != len("todo") {
+		t.Errorf("Expected the todo template replacing its trigger, got %q (replace=%d)", resp.Reply, resp.Replace)
+	}
+
+	// It is listed next to the built-in templates
+	rec = httptest.NewRecorder()
+	handler.AdminTemplates(rec, httptest.NewRequest(http.MethodGet, "/admin/templates?language=go", nil))
+	var templates []models.Template
+	if err := json.NewDecoder(rec.Body).Decode(&templates); err != nil {
+		t.Fatalf("Failed to decode templates: %v", err)
+	}
+	found := false
+	for _, listed := range templates {
+		found = found || (listed.Name == "todo" && listed.Source == models.SourceAdded)
+	}
+	if !found {
+		t.Errorf("Expected the added template in %d listed templates", len(templates))
+	}
+
+	// Added templates can be removed, built-in ones can't
+	rec = httptest.NewRecorder()
+	handler.AdminTemplates(rec, httptest.NewRequest(http.MethodDelete, "/admin/templates?language=go&name=todo", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.AdminTemplates(rec, httptest.NewRequest(http.MethodDelete, "/admin/templates?language=go&name=if", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, rec.Code)
+	}
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// StopToken means a beam search sequence reached one of its stop tokens
+const StopToken StopReason = "stop_token"
+
+// BeamOptions configures a beam search
+type BeamOptions struct {
+	// Width is how many partial sequences are kept, and how many edges are
+	// expanded from each of them
+	Width int
+	// MaxLength is the most edges a sequence may have
+	MaxLength int
+	// EndID finishes a sequence when it is reached
+	EndID int
+	// StopTokens finish a sequence once an edge adds one of them
+	StopTokens map[int]bool
+	// LengthNormalize ranks sequences by their mean edge log-probability instead
+	// of the total, so longer sequences aren't penalized for having more edges
+	LengthNormalize bool
+}
+
+// BeamResult is the best sequence found by a beam search
+type BeamResult struct {
+	EdgeIDs []int
+	// LogProb is the sum of the log-probabilities of the sequence's edges
+	LogProb    float64
+	StopReason StopReason
+}
+
+// beamEdge is an edge a sequence can be extended with
+type beamEdge struct {
+	ID       int
+	TargetID int
+	TokenID  int
+	LogProb  float64
+}
+
+// beamSequence is a partial sequence kept by the search
+type beamSequence struct {
+	edgeIDs []int
+	node    int
+	logProb float64
+	reason  StopReason
+}
+
+// score ranks sequences by their log-probability, or by their mean edge
+// log-probability when normalized. Empty sequences rank last.
+func (s beamSequence) score(normalize bool) float64 {
+	if len(s.edgeIDs) == 0 {
+		return math.Inf(-1)
+	}
+	if normalize {
+		return s.logProb / float64(len(s.edgeIDs))
+	}
+	return s.logProb
+}
+
+// SearchBeam finds the most likely sequence of edges from startID. Each step
+// extends every unfinished sequence with the top edges by count, scored by the
+// log of their share of the node's outgoing count, and keeps the opts.Width
+// sequences with the highest log-probability. Sequences finish at opts.EndID, a
+// stop token or a node without edges. Every edge lowers the log-probability, so
+// shorter sequences are favoured unless opts.LengthNormalize is set.
+func (g *Graph) SearchBeam(ctx context.Context, startID int, opts BeamOptions) (BeamResult, error) {
+	if opts.Width < 1 {
+		opts.Width = 1
+	}
+
+	beams := []beamSequence{{node: startID}}
+	for i := 0; i < opts.MaxLength; i++ {
+		if ctx.Err() != nil {
+			return BeamResult{}, ctx.Err()
+		}
+
+		var candidates []beamSequence
+		extended := false
+		for _, beam := range beams {
+			if beam.reason != "" {
+				candidates = append(candidates, beam)
+				continue
+			}
+
+			edges, err := g.topEdges(ctx, beam.node, opts.Width)
+			if err != nil {
+				return BeamResult{}, err
+			}
+			if len(edges) == 0 {
+				beam.reason = StopDeadEnd
+				candidates = append(candidates, beam)
+				continue
+			}
+
+			for _, e := range edges {
+				next := beamSequence{
+					edgeIDs: append(append([]int(nil), beam.edgeIDs...), e.ID),
+					node:    e.TargetID,
+					logProb: beam.logProb + e.LogProb,
+				}
+				switch {
+				case e.TargetID == opts.EndID:
+					next.reason = StopEnd
+				case opts.StopTokens[e.TokenID]:
+					next.reason = StopToken
+				}
+				candidates = append(candidates, next)
+				extended = true
+			}
+		}
+
+		// Stable so ties keep the order of the most frequent edges
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return candidates[a].score(opts.LengthNormalize) > candidates[b].score(opts.LengthNormalize)
+		})
+		if len(candidates) > opts.Width {
+			candidates = candidates[:opts.Width]
+		}
+		beams = candidates
+
+		if !extended {
+			break
+		}
+	}
+
+	best := beams[0]
+	if best.reason == "" {
+		best.reason = StopMaxLength
+	}
+	observeWalk(best.edgeIDs, best.reason)
+	return BeamResult{EdgeIDs: best.edgeIDs, LogProb: best.logProb, StopReason: best.reason}, nil
+}
+
+// topEdges returns up to limit forward edges from nodeID by descending count,
+// with their log-probability among all of the node's edges. Self-loops are skipped.
+func (g *Graph) topEdges(ctx context.Context, nodeID, limit int) ([]beamEdge, error) {
+	defer g.observeContext(ctx, "SearchBeam")()
+
+	// The token an edge adds is the last one of its next node
+	query := fmt.Sprintf(`
+		SELECT edges.id, edges.next_node, nodes.token%d_id, edges.count,
+			SUM(edges.count) OVER ()
+		FROM edges
+		JOIN nodes ON nodes.id = edges.next_node
+		WHERE edges.prev_node = ? AND edges.next_node != edges.prev_node
+		ORDER BY edges.count DESC, edges.id
+		LIMIT ?
+	`, g.order-1)
+	rows, err := g.Reader.QueryContext(ctx, query, nodeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query edges: %w", err)
+	}
+	defer rows.Close()
+
+	var edges []beamEdge
+	for rows.Next() {
+		var e beamEdge
+		var count, total int
+		if err := rows.Scan(&e.ID, &e.TargetID, &e.TokenID, &count, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan edge: %w", err)
+		}
+		e.LogProb = math.Log(float64(max(count, 1)) / float64(max(total, 1)))
+		edges = append(edges, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating edge rows: %w", err)
+	}
+
+	return edges, nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSearchBeam(t *testing.T) {
+	// From node 1 both branches are equally likely, but only the branch through
+	// node 3 continues with certainty to the end at node 9
+	g := newTestGraph(t, 1, singleTokenNodes(9), [][3]int{
+		{1, 2, 5}, // edge 1
+		{1, 3, 5}, // edge 2
+		{2, 4, 1}, // edge 3
+		{2, 5, 1}, // edge 4
+		{3, 6, 10},
+		{6, 9, 1},
+		{4, 9, 1},
+	})
+
+	tests := []struct {
+		name       string
+		opts       BeamOptions
+		wantEdges  []int
+		wantReason StopReason
+	}{
+		{
+			name:       "greedy",
+			opts:       BeamOptions{Width: 1, MaxLength: 10, EndID: 9},
+			wantEdges:  []int{1, 3, 7},
+			wantReason: StopEnd,
+		},
+		{
+			name:       "beam finds the likelier branch",
+			opts:       BeamOptions{Width: 2, MaxLength: 10, EndID: 9},
+			wantEdges:  []int{2, 5, 6},
+			wantReason: StopEnd,
+		},
+		{
+			name:       "stop token",
+			opts:       BeamOptions{Width: 2, MaxLength: 10, EndID: 9, StopTokens: map[int]bool{6: true}},
+			wantEdges:  []int{2, 5},
+			wantReason: StopToken,
+		},
+		{
+			name:       "max length",
+			opts:       BeamOptions{Width: 2, MaxLength: 1, EndID: 9},
+			wantEdges:  []int{1},
+			wantReason: StopMaxLength,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := g.SearchBeam(context.Background(), 1, tt.opts)
+			if err != nil {
+				t.Fatalf("SearchBeam failed: %v", err)
+			}
+			if !reflect.DeepEqual(result.EdgeIDs, tt.wantEdges) || result.StopReason != tt.wantReason {
+				t.Errorf("SearchBeam = %v, %q; want %v, %q", result.EdgeIDs, result.StopReason, tt.wantEdges, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestSearchBeamLengthNormalize(t *testing.T) {
+	// Ending right away has probability 0.4, while the longer path through nodes
+	// 2 and 3 has 0.3 in total but a higher probability per edge
+	g := newTestGraph(t, 1, singleTokenNodes(9), [][3]int{
+		{1, 9, 2}, // edge 1
+		{1, 2, 3}, // edge 2
+		{2, 3, 1}, // edge 3
+		{2, 4, 1}, // edge 4
+		{3, 9, 1}, // edge 5
+	})
+
+	tests := []struct {
+		name      string
+		normalize bool
+		wantEdges []int
+	}{
+		{name: "total log-probability", wantEdges: []int{1}},
+		{name: "length normalized", normalize: true, wantEdges: []int{2, 3, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := BeamOptions{Width: 2, MaxLength: 10, EndID: 9, LengthNormalize: tt.normalize}
+			result, err := g.SearchBeam(context.Background(), 1, opts)
+			if err != nil {
+				t.Fatalf("SearchBeam failed: %v", err)
+			}
+			if !reflect.DeepEqual(result.EdgeIDs, tt.wantEdges) || result.StopReason != StopEnd {
+				t.Errorf("SearchBeam = %v, %q; want %v, %q", result.EdgeIDs, result.StopReason, tt.wantEdges, StopEnd)
+			}
+		})
+	}
+}
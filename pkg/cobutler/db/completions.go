@@ -0,0 +1,141 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EnsureCompletionsTable creates the table used to remember accepted completions.
+// Like the other completion writes it is committed before it returns, so the
+// reader pool sees it.
+func (g *Graph) EnsureCompletionsTable() error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS completions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			context_hash TEXT NOT NULL,
+			completion TEXT NOT NULL,
+			hits INTEGER NOT NULL DEFAULT 1,
+			created_at INTEGER NOT NULL,
+			last_used INTEGER NOT NULL,
+			UNIQUE (context_hash, completion)
+		)`,
+		"CREATE INDEX IF NOT EXISTS completions_last_used ON completions (last_used)",
+	}
+
+	return g.Batch(func() error {
+		for _, statement := range statements {
+			if _, err := g.Conn.Exec(statement); err != nil {
+				return fmt.Errorf("failed to create completions table: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// RememberCompletion records a completion for a context hash, incrementing its hit count
+// if it has been remembered before. It is a single upsert, so it goes through the
+// writer without reading first, and is committed before it returns.
+func (g *Graph) RememberCompletion(contextHash, completion string, now time.Time) error {
+	defer g.observe("RememberCompletion")()
+
+	return g.Batch(func() error {
+		_, err := g.Conn.Exec(`
+			INSERT INTO completions (context_hash, completion, hits, created_at, last_used)
+			VALUES (?, ?, 1, ?, ?)
+			ON CONFLICT (context_hash, completion)
+			DO UPDATE SET hits = hits + 1, last_used = excluded.last_used
+		`, contextHash, completion, now.Unix(), now.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to remember completion: %w", err)
+		}
+		return nil
+	})
+}
+
+// LookupCompletion returns the ID and text of the most frequently remembered
+// completion for a context hash that has been used since notBefore, or an ID of
+// 0 when there is none. It reads from the reader pool, so it doesn't mark the
+// completion as used; callers batch that with TouchCompletions.
+func (g *Graph) LookupCompletion(contextHash string, notBefore time.Time) (int64, string, error) {
+	defer g.observe("LookupCompletion")()
+
+	var id int64
+	var completion string
+	err := g.Reader.QueryRow(`
+		SELECT id, completion FROM completions
+		WHERE context_hash = ? AND last_used >= ?
+		ORDER BY hits DESC, last_used DESC
+		LIMIT 1
+	`, contextHash, notBefore.Unix()).Scan(&id, &completion)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to look up completion: %w", err)
+	}
+
+	return id, completion, nil
+}
+
+// TouchCompletions marks the completions with the given IDs as used at now, so
+// recalled completions stay alive as long as they keep being used
+func (g *Graph) TouchCompletions(ids []int64, now time.Time) error {
+	defer g.observe("TouchCompletions")()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, now.Unix())
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+
+	query := fmt.Sprintf("UPDATE completions SET last_used = ? WHERE id IN (%s)", strings.Join(placeholders, ", "))
+	return g.Batch(func() error {
+		if _, err := g.Conn.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to touch completions: %w", err)
+		}
+		return nil
+	})
+}
+
+// PruneCompletions deletes completions not used since notBefore and keeps at most
+// maxEntries of the most recently used ones. A maxEntries of 0 disables the cap.
+// Both deletes are committed together.
+func (g *Graph) PruneCompletions(notBefore time.Time, maxEntries int) (int64, error) {
+	defer g.observe("PruneCompletions")()
+
+	var deleted int64
+	err := g.Batch(func() error {
+		result, err := g.Conn.Exec("DELETE FROM completions WHERE last_used < ?", notBefore.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to prune expired completions: %w", err)
+		}
+		deleted, _ = result.RowsAffected()
+
+		if maxEntries > 0 {
+			result, err = g.Conn.Exec(`
+				DELETE FROM completions WHERE id NOT IN (
+					SELECT id FROM completions ORDER BY last_used DESC, hits DESC LIMIT ?
+				)
+			`, maxEntries)
+			if err != nil {
+				return fmt.Errorf("failed to cap completions: %w", err)
+			}
+			capped, _ := result.RowsAffected()
+			deleted += capped
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
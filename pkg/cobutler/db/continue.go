@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// EndNode returns the node made only of the end token, which marks where learned
+// text ended, or 0 if nothing has been learned
+func (g *Graph) EndNode(ctx context.Context) (int, error) {
+	defer g.observeContext(ctx, "EndNode")()
+
+	endToken, err := g.GetTokenByText(ctx, "", false)
+	if err != nil || endToken == 0 {
+		return 0, err
+	}
+
+	tokens := make([]int, g.order)
+	for i := range tokens {
+		tokens[i] = endToken
+	}
+	return g.GetNodeByTokens(ctx, tokens, false)
+}
+
+// SearchContinuation walks forward from the node that best continues tokenIDs,
+// the tokens at the end of a prompt. When no node ends with all of the last
+// order tokens, shorter suffixes are tried. A context with no match at all is
+// a dead end.
+func (g *Graph) SearchContinuation(ctx context.Context, sampling Sampling, tokenIDs []int, endID int, step StepFunc) ([]int, StopReason, error) {
+	done := g.observeContext(ctx, "SearchContinuation")
+	nodeID, err := g.findNodeContainingContext(ctx, tokenIDs)
+	done()
+	if err != nil {
+		return nil, "", err
+	}
+	if nodeID == 0 {
+		observeWalk(nil, StopDeadEnd)
+		return nil, StopDeadEnd, nil
+	}
+
+	return g.SearchRandomWalkContext(ctx, sampling, nodeID, endID, true, step)
+}
+
+// GetNextTextByEdge returns the token an edge adds when walking forward, the last
+// token of its next node, and whether a space comes before it
+func (g *Graph) GetNextTextByEdge(ctx context.Context, edgeID int) (string, bool, error) {
+	defer g.observeContext(ctx, "GetNextTextByEdge")()
+
+	var text string
+	var hasSpace int
+
+	query := fmt.Sprintf(`
+		SELECT tokens.text, edges.has_space
+		FROM edges
+		JOIN nodes ON nodes.id = edges.next_node
+		JOIN tokens ON tokens.id = nodes.token%d_id
+		WHERE edges.id = ?
+	`, g.order-1)
+	if err := g.Reader.QueryRowContext(ctx, query, edgeID).Scan(&text, &hasSpace); err != nil {
+		return "", false, fmt.Errorf("failed to get edge text: %w", err)
+	}
+
+	return text, hasSpace == 1, nil
+}
+
+// GetPrevNodeByEdge returns the node an edge leaves from, where a walk that went
+// backward along it ended up
+func (g *Graph) GetPrevNodeByEdge(ctx context.Context, edgeID int) (int, error) {
+	defer g.observeContext(ctx, "GetPrevNodeByEdge")()
+
+	var nodeID int
+	if err := g.Reader.QueryRowContext(ctx, "SELECT prev_node FROM edges WHERE id = ?", edgeID).Scan(&nodeID); err != nil {
+		return 0, fmt.Errorf("failed to get edge node: %w", err)
+	}
+	return nodeID, nil
+}
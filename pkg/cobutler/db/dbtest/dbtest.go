@@ -0,0 +1,95 @@
+// Package dbtest creates brain databases for tests. It only writes the SQLite
+// file, so the db package's own tests can use it too; open the result with
+// db.NewGraph.
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Brain describes the contents of a test brain
+type Brain struct {
+	Order int
+	// Tokens maps token IDs to their text. Tokens used by nodes but missing here
+	// are named "t<id>"; the empty text is the end token.
+	Tokens map[int]string
+	// Nodes holds the token IDs of each node; node i+1 is Nodes[i]
+	Nodes [][]int
+	// Edges are {prev node, next node, count}, all learned with a space before
+	// their token; edge i+1 is Edges[i]
+	Edges [][3]int
+}
+
+// Create writes brain to a new database in a temporary directory and returns its path
+func Create(t testing.TB, brain Brain) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "brain.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer conn.Close()
+
+	columns := make([]string, brain.Order)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("token%d_id", i)
+	}
+	schema := []string{
+		"CREATE TABLE info (attribute TEXT PRIMARY KEY, text TEXT NOT NULL)",
+		"CREATE TABLE tokens (id INTEGER PRIMARY KEY, text TEXT NOT NULL, is_word INTEGER NOT NULL)",
+		fmt.Sprintf("CREATE TABLE nodes (id INTEGER PRIMARY KEY, count INTEGER NOT NULL, %s INTEGER NOT NULL)",
+			strings.Join(columns, " INTEGER NOT NULL, ")),
+		"CREATE TABLE edges (id INTEGER PRIMARY KEY, prev_node INTEGER NOT NULL, next_node INTEGER NOT NULL, has_space INTEGER NOT NULL, count INTEGER NOT NULL)",
+		fmt.Sprintf("INSERT INTO info (attribute, text) VALUES ('order', '%d')", brain.Order),
+	}
+	for _, stmt := range schema {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatalf("Failed to create schema: %v", err)
+		}
+	}
+
+	tokens := make(map[int]string, len(brain.Tokens))
+	for id, text := range brain.Tokens {
+		tokens[id] = text
+	}
+
+	insertNode := fmt.Sprintf("INSERT INTO nodes (count, %s) VALUES (0%s)",
+		strings.Join(columns, ", "), strings.Repeat(", ?", brain.Order))
+	for _, node := range brain.Nodes {
+		args := make([]interface{}, len(node))
+		for i, token := range node {
+			args[i] = token
+			if _, ok := tokens[token]; !ok {
+				tokens[token] = fmt.Sprintf("t%d", token)
+			}
+		}
+		if _, err := conn.Exec(insertNode, args...); err != nil {
+			t.Fatalf("Failed to insert node: %v", err)
+		}
+	}
+
+	for id, text := range tokens {
+		isWord := 0
+		if text != "" {
+			isWord = 1
+		}
+		if _, err := conn.Exec("INSERT INTO tokens (id, text, is_word) VALUES (?, ?, ?)", id, text, isWord); err != nil {
+			t.Fatalf("Failed to insert token: %v", err)
+		}
+	}
+
+	for _, e := range brain.Edges {
+		if _, err := conn.Exec("INSERT INTO edges (prev_node, next_node, has_space, count) VALUES (?, ?, 1, ?)", e[0], e[1], e[2]); err != nil {
+			t.Fatalf("Failed to insert edge: %v", err)
+		}
+	}
+
+	return path
+}
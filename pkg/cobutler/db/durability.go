@@ -0,0 +1,211 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+)
+
+// Durability trades write speed for how much a crash or power loss can lose
+type Durability string
+
+// Durability profiles accepted by ParseDurability
+const (
+	// DurabilityFast never syncs to disk. A crash loses nothing, but a power loss
+	// can lose recent commits or corrupt the database.
+	DurabilityFast Durability = "fast"
+	// DurabilityNormal syncs at checkpoints. A power loss can lose the commits
+	// since the last checkpoint but doesn't corrupt the database.
+	DurabilityNormal Durability = "normal"
+	// DurabilityFull syncs every commit, so nothing committed is lost
+	DurabilityFull Durability = "full"
+)
+
+// DefaultCheckpointInterval is how often the WAL is checkpointed by default
+const DefaultCheckpointInterval = 5 * time.Minute
+
+// ErrCorrupt is returned by NewGraph when the database fails its integrity check
+// or isn't a database at all
+var ErrCorrupt = errors.New("brain database is corrupt")
+
+// ErrCheckpointBusy is returned by Checkpoint when readers or an uncommitted
+// write kept it from copying the whole WAL
+var ErrCheckpointBusy = errors.New("checkpoint blocked by readers or an open write")
+
+// checkpointBusyTimeout is how long a checkpoint waits for readers and writers,
+// during which it holds off new writes
+const checkpointBusyTimeout = 100 * time.Millisecond
+
+// GraphOptions configures how NewGraph opens a database
+type GraphOptions struct {
+	Durability Durability
+	// CheckpointInterval is how often the WAL is copied into the database file.
+	// Zero leaves checkpoints to SQLite.
+	CheckpointInterval time.Duration
+	// SkipIntegrityCheck skips PRAGMA quick_check when opening, which reads the
+	// whole database
+	SkipIntegrityCheck bool
+	// ReadOnly opens the database without writing to it, for commands that only
+	// inspect a brain. It skips the integrity check, migrations and checkpoints.
+	ReadOnly bool
+}
+
+// DefaultGraphOptions returns the options brains are opened with unless
+// configured otherwise
+func DefaultGraphOptions() GraphOptions {
+	return GraphOptions{
+		Durability:         DurabilityNormal,
+		CheckpointInterval: DefaultCheckpointInterval,
+	}
+}
+
+// ParseDurability parses a durability profile, defaulting to normal when empty
+func ParseDurability(s string) (Durability, error) {
+	switch d := Durability(strings.ToLower(s)); d {
+	case "":
+		return DurabilityNormal, nil
+	case DurabilityFast, DurabilityNormal, DurabilityFull:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown durability %q, expected fast, normal or full", s)
+	}
+}
+
+// synchronous returns the value of PRAGMA synchronous for the profile
+func (d Durability) synchronous() (string, error) {
+	switch d {
+	case DurabilityFast:
+		return "OFF", nil
+	case DurabilityNormal, "":
+		return "NORMAL", nil
+	case DurabilityFull:
+		return "FULL", nil
+	default:
+		return "", fmt.Errorf("unknown durability %q", d)
+	}
+}
+
+// mmapSize returns the value of PRAGMA mmap_size for the profile. Full
+// durability reads through the page cache only, so a stray write into mapped
+// memory can't reach the file.
+func (d Durability) mmapSize() int64 {
+	switch d {
+	case DurabilityFast:
+		return 30000000000
+	case DurabilityFull:
+		return 0
+	default:
+		return 256 << 20
+	}
+}
+
+// quickCheck runs PRAGMA quick_check, returning ErrCorrupt with the problems found
+func quickCheck(conn *sql.DB, dbPath string) error {
+	rows, err := conn.Query("PRAGMA quick_check")
+	if err != nil {
+		return corruptError(dbPath, err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to read integrity check: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return corruptError(dbPath, err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s: %s", ErrCorrupt, dbPath, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// corruptError wraps err in ErrCorrupt when SQLite reports the database as
+// corrupt or not a database, and otherwise as a failed integrity check
+func corruptError(dbPath string, err error) error {
+	if isCorrupt(err) {
+		return fmt.Errorf("%w: %s: %v", ErrCorrupt, dbPath, err)
+	}
+	return fmt.Errorf("failed to check database integrity: %w", err)
+}
+
+// isCorrupt reports whether err is SQLite finding a corrupt database or a file
+// that isn't a database
+func isCorrupt(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrCorrupt || sqliteErr.Code == sqlite3.ErrNotADB
+}
+
+// openCheckpointer opens the connection checkpoints run on. It is separate from
+// the writer, whose connection usually has a transaction open.
+func openCheckpointer(dbPath string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s?_busy_timeout=%d", dbPath, checkpointBusyTimeout.Milliseconds())
+	conn, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint connection: %w", err)
+	}
+	conn.SetMaxOpenConns(1)
+	return conn, nil
+}
+
+// Checkpoint copies committed pages from the WAL into the database file and
+// truncates the WAL. It returns ErrCheckpointBusy when readers or an uncommitted
+// write keep it from finishing; the pages it did copy stay copied.
+func (g *Graph) Checkpoint() error {
+	defer g.observe("Checkpoint")()
+
+	if g.checkpointer == nil {
+		return fmt.Errorf("cannot checkpoint a read-only graph")
+	}
+
+	var busy, walPages, checkpointed int
+	err := g.checkpointer.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &walPages, &checkpointed)
+	if err != nil {
+		metrics.Checkpoints.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to checkpoint: %w", err)
+	}
+	if busy != 0 {
+		metrics.Checkpoints.WithLabelValues("busy").Inc()
+		return fmt.Errorf("%w: %d of %d pages copied", ErrCheckpointBusy, checkpointed, walPages)
+	}
+	metrics.Checkpoints.WithLabelValues("ok").Inc()
+	return nil
+}
+
+// checkpointEvery checkpoints the WAL every interval until stop is closed.
+// Blocked checkpoints are logged and retried next time.
+func (g *Graph) checkpointEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := g.Checkpoint()
+			if errors.Is(err, ErrCheckpointBusy) {
+				slog.Info("Skipped WAL checkpoint", "database", g.path, "reason", err)
+			} else if err != nil {
+				slog.Warn("Failed to checkpoint WAL", "database", g.path, "error", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDurability(t *testing.T) {
+	g := newTestGraph(t, 1, singleTokenNodes(2), [][3]int{{1, 2, 1}})
+	g.Close()
+
+	tests := []struct {
+		name        string
+		durability  string
+		synchronous int
+		mmapSize    int64
+	}{
+		{name: "fast", durability: "fast", synchronous: 0, mmapSize: 30000000000},
+		{name: "default", durability: "", synchronous: 1, mmapSize: 256 << 20},
+		{name: "full", durability: "FULL", synchronous: 2, mmapSize: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			durability, err := ParseDurability(tt.durability)
+			if err != nil {
+				t.Fatalf("ParseDurability failed: %v", err)
+			}
+			g, err := NewGraph(g.path, GraphOptions{Durability: durability})
+			if err != nil {
+				t.Fatalf("Failed to open graph: %v", err)
+			}
+			defer g.Close()
+
+			var synchronous int
+			var mmapSize int64
+			if err := g.Conn.QueryRow("PRAGMA synchronous").Scan(&synchronous); err != nil {
+				t.Fatalf("Failed to read synchronous: %v", err)
+			}
+			// mmap_size is capped by SQLITE_MAX_MMAP_SIZE at compile time, so it
+			// is only checked to be off for full durability
+			if err := g.Conn.QueryRow("PRAGMA mmap_size").Scan(&mmapSize); err != nil {
+				t.Fatalf("Failed to read mmap_size: %v", err)
+			}
+			if synchronous != tt.synchronous {
+				t.Errorf("Expected synchronous %d, got %d", tt.synchronous, synchronous)
+			}
+			if (mmapSize == 0) != (tt.mmapSize == 0) {
+				t.Errorf("Expected mmap_size %d, got %d", tt.mmapSize, mmapSize)
+			}
+
+			if err := g.Checkpoint(); err != nil {
+				t.Errorf("Checkpoint failed: %v", err)
+			}
+		})
+	}
+
+	if _, err := ParseDurability("sometimes"); err == nil {
+		t.Error("Expected an unknown durability to fail")
+	}
+}
+
+func TestNewGraphCorrupt(t *testing.T) {
+	t.Run("not a database", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "brain.db")
+		if err := os.WriteFile(path, []byte("this is not a database, just some text that is long enough"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewGraph(path, GraphOptions{}); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Expected ErrCorrupt, got %v", err)
+		}
+	})
+
+	t.Run("damaged pages", func(t *testing.T) {
+		g := newTestGraph(t, 1, singleTokenNodes(200), [][3]int{{1, 2, 1}})
+		if err := g.Checkpoint(); err != nil {
+			t.Fatalf("Checkpoint failed: %v", err)
+		}
+		g.Close()
+
+		// Overwrite everything after the header page
+		data, err := os.ReadFile(g.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 4096; i < len(data); i++ {
+			data[i] = 0xff
+		}
+		if err := os.WriteFile(g.path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewGraph(g.path, GraphOptions{}); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Expected ErrCorrupt, got %v", err)
+		}
+	})
+}
+
+func TestCheckpointTruncatesWAL(t *testing.T) {
+	g := newTestGraph(t, 1, singleTokenNodes(2), nil)
+
+	// The writer keeps a transaction open between commits, like a brain does
+	for i := 0; i < 200; i++ {
+		if err := g.AddEdge(1, 2, true); err != nil {
+			t.Fatalf("AddEdge failed: %v", err)
+		}
+		if err := g.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	}
+
+	walSize := func() int64 {
+		info, err := os.Stat(g.path + "-wal")
+		if err != nil {
+			t.Fatalf("Failed to stat WAL: %v", err)
+		}
+		return info.Size()
+	}
+	if walSize() == 0 {
+		t.Fatal("Expected the commits to grow the WAL")
+	}
+
+	if err := g.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if size := walSize(); size != 0 {
+		t.Errorf("Expected the checkpoint to truncate the WAL, got %d bytes", size)
+	}
+
+	// Uncommitted writes block a full checkpoint instead of failing silently
+	if err := g.AddEdge(1, 2, true); err != nil {
+		t.Fatalf("AddEdge failed: %v", err)
+	}
+	if err := g.Checkpoint(); !errors.Is(err, ErrCheckpointBusy) {
+		t.Errorf("Expected ErrCheckpointBusy with an open write, got %v", err)
+	}
+}
+
+func TestReadOnlyGraph(t *testing.T) {
+	g := newTestGraph(t, 1, singleTokenNodes(2), [][3]int{{1, 2, 1}})
+	g.Close()
+
+	ro, err := NewGraph(g.path, GraphOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to open read-only graph: %v", err)
+	}
+	defer ro.Close()
+
+	if _, err := ro.Stats(StatsTop); err != nil {
+		t.Errorf("Stats failed: %v", err)
+	}
+	if _, err := ro.Conn.Exec("DELETE FROM edges"); err == nil {
+		t.Error("Expected a read-only graph to reject writes")
+	}
+}
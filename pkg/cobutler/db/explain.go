@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownToken is returned when looking up a token that was never learned
+var ErrUnknownToken = errors.New("unknown token")
+
+// Step is an edge of a walk with the tokens of the nodes it joins
+type Step struct {
+	EdgeID int      `json:"edge_id"`
+	From   []string `json:"from"`
+	To     []string `json:"to"`
+	Count  int64    `json:"count"`
+	// Alternatives are the edges a walk could have taken from From, its most
+	// frequent ones by descending count, with the token each would add
+	Alternatives []Alternative `json:"alternatives"`
+}
+
+// Alternative is an edge that could have been taken from a node
+type Alternative struct {
+	EdgeID int    `json:"edge_id"`
+	Token  string `json:"token"`
+	Count  int64  `json:"count"`
+}
+
+// Neighbors are the tokens learned directly after and before a token
+type Neighbors struct {
+	Token        string      `json:"token"`
+	Successors   []Frequency `json:"successors"`
+	Predecessors []Frequency `json:"predecessors"`
+}
+
+// ExplainWalk describes each edge of a walk, as returned by SearchRandomWalk.
+// The end token has no text, so it shows up as an empty token.
+func (g *Graph) ExplainWalk(ctx context.Context, edgeIDs []int) ([]Step, error) {
+	defer g.observeContext(ctx, "ExplainWalk")()
+
+	steps := make([]Step, 0, len(edgeIDs))
+	for _, edgeID := range edgeIDs {
+		step := Step{EdgeID: edgeID}
+		var prevNode, nextNode int
+		err := g.Reader.QueryRowContext(ctx, "SELECT prev_node, next_node, count FROM edges WHERE id = ?", edgeID).
+			Scan(&prevNode, &nextNode, &step.Count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get edge %d: %w", edgeID, err)
+		}
+
+		if step.From, err = g.GetNodeTokens(ctx, prevNode); err != nil {
+			return nil, err
+		}
+		if step.To, err = g.GetNodeTokens(ctx, nextNode); err != nil {
+			return nil, err
+		}
+		if step.Alternatives, err = g.alternatives(ctx, prevNode); err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// GetNodeTokens returns the text of a node's tokens
+func (g *Graph) GetNodeTokens(ctx context.Context, nodeID int) ([]string, error) {
+	defer g.observeContext(ctx, "GetNodeTokens")()
+
+	columns := make([]string, g.order)
+	joins := make([]string, g.order)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("t%d.text", i)
+		joins[i] = fmt.Sprintf("JOIN tokens t%d ON t%d.id = nodes.token%d_id", i, i, i)
+	}
+	query := fmt.Sprintf("SELECT %s FROM nodes %s WHERE nodes.id = ?",
+		strings.Join(columns, ", "), strings.Join(joins, " "))
+
+	tokens := make([]string, g.order)
+	dest := make([]interface{}, g.order)
+	for i := range tokens {
+		dest[i] = &tokens[i]
+	}
+	if err := g.Reader.QueryRowContext(ctx, query, nodeID).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to get node %d: %w", nodeID, err)
+	}
+	return tokens, nil
+}
+
+// alternatives returns the edges a walk samples from when leaving nodeID, the
+// maxWalkEdges most frequent ones, by descending count
+func (g *Graph) alternatives(ctx context.Context, nodeID int) ([]Alternative, error) {
+	query := fmt.Sprintf(`
+		SELECT edges.id, tokens.text, edges.count
+		FROM edges
+		JOIN nodes ON nodes.id = edges.next_node
+		JOIN tokens ON tokens.id = nodes.token%d_id
+		WHERE edges.prev_node = ? AND edges.next_node != edges.prev_node
+		ORDER BY edges.count DESC, edges.id
+		LIMIT ?
+	`, g.order-1)
+	rows, err := g.Reader.QueryContext(ctx, query, nodeID, maxWalkEdges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alternatives: %w", err)
+	}
+	defer rows.Close()
+
+	var alternatives []Alternative
+	for rows.Next() {
+		var a Alternative
+		if err := rows.Scan(&a.EdgeID, &a.Token, &a.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan alternative: %w", err)
+		}
+		alternatives = append(alternatives, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating alternative rows: %w", err)
+	}
+
+	return alternatives, nil
+}
+
+// TokenNeighbors returns up to limit tokens learned directly after and before
+// text, by the total count of the edges between them. An empty neighbor is the
+// start or end of learned text.
+func (g *Graph) TokenNeighbors(ctx context.Context, text string, limit int) (Neighbors, error) {
+	defer g.observeContext(ctx, "TokenNeighbors")()
+
+	tokenID, err := g.GetTokenByText(ctx, text, false)
+	if err != nil {
+		return Neighbors{}, err
+	}
+	if tokenID == 0 {
+		return Neighbors{}, fmt.Errorf("%w %q", ErrUnknownToken, text)
+	}
+
+	// An edge joins the last token of its previous node to the last token of
+	// its next node
+	last := g.order - 1
+	neighbors := Neighbors{Token: text}
+	neighbors.Successors, err = g.frequencies(ctx, fmt.Sprintf(`
+		SELECT tokens.text, SUM(edges.count) AS total
+		FROM edges
+		JOIN nodes prev ON prev.id = edges.prev_node
+		JOIN nodes next ON next.id = edges.next_node
+		JOIN tokens ON tokens.id = next.token%d_id
+		WHERE prev.token%d_id = ?
+		GROUP BY tokens.id
+		ORDER BY total DESC, tokens.id
+		LIMIT ?
+	`, last, last), tokenID, limit)
+	if err != nil {
+		return Neighbors{}, err
+	}
+
+	neighbors.Predecessors, err = g.frequencies(ctx, fmt.Sprintf(`
+		SELECT tokens.text, SUM(edges.count) AS total
+		FROM edges
+		JOIN nodes prev ON prev.id = edges.prev_node
+		JOIN nodes next ON next.id = edges.next_node
+		JOIN tokens ON tokens.id = prev.token%d_id
+		WHERE next.token%d_id = ?
+		GROUP BY tokens.id
+		ORDER BY total DESC, tokens.id
+		LIMIT ?
+	`, last, last), tokenID, limit)
+	if err != nil {
+		return Neighbors{}, err
+	}
+
+	return neighbors, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExplainWalk(t *testing.T) {
+	g := newTestGraph(t, 2, [][]int{{1, 2}, {2, 3}, {2, 4}}, [][3]int{
+		{1, 2, 3}, // edge 1
+		{1, 3, 5}, // edge 2
+		{2, 3, 1}, // edge 3
+	})
+
+	steps, err := g.ExplainWalk(context.Background(), []int{1})
+	if err != nil {
+		t.Fatalf("ExplainWalk failed: %v", err)
+	}
+
+	want := []Step{{
+		EdgeID: 1,
+		From:   []string{"t1", "t2"},
+		To:     []string{"t2", "t3"},
+		Count:  3,
+		Alternatives: []Alternative{
+			{EdgeID: 2, Token: "t4", Count: 5},
+			{EdgeID: 1, Token: "t3", Count: 3},
+		},
+	}}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("ExplainWalk = %+v, want %+v", steps, want)
+	}
+}
+
+func TestExplainWalkCapsAlternatives(t *testing.T) {
+	// Node 1 is a hub with more edges than a walk chooses from
+	hubEdges := maxWalkEdges + 8
+	var edges [][3]int
+	for i := 0; i < hubEdges; i++ {
+		edges = append(edges, [3]int{1, i + 2, hubEdges - i})
+	}
+	g := newTestGraph(t, 1, singleTokenNodes(hubEdges+1), edges)
+
+	steps, err := g.ExplainWalk(context.Background(), []int{1})
+	if err != nil {
+		t.Fatalf("ExplainWalk failed: %v", err)
+	}
+	alternatives := steps[0].Alternatives
+	if len(alternatives) != maxWalkEdges {
+		t.Fatalf("Expected %d alternatives, got %d", maxWalkEdges, len(alternatives))
+	}
+	if last := alternatives[len(alternatives)-1]; last.EdgeID != maxWalkEdges {
+		t.Errorf("Expected the most frequent edges, ending with edge %d, got %d", maxWalkEdges, last.EdgeID)
+	}
+}
+
+func TestTokenNeighbors(t *testing.T) {
+	g := newTestGraph(t, 2, [][]int{{1, 2}, {2, 3}, {2, 4}}, [][3]int{
+		{1, 2, 3},
+		{1, 3, 5},
+		{2, 3, 1},
+	})
+
+	neighbors, err := g.TokenNeighbors(context.Background(), "t4", 10)
+	if err != nil {
+		t.Fatalf("TokenNeighbors failed: %v", err)
+	}
+	want := Neighbors{
+		Token:        "t4",
+		Successors:   []Frequency{},
+		Predecessors: []Frequency{{Text: "t2", Count: 5}, {Text: "t3", Count: 1}},
+	}
+	if !reflect.DeepEqual(neighbors, want) {
+		t.Errorf("TokenNeighbors = %+v, want %+v", neighbors, want)
+	}
+
+	if _, err := g.TokenNeighbors(context.Background(), "missing", 10); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Expected ErrUnknownToken, got %v", err)
+	}
+	// Lookups stop with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.TokenNeighbors(ctx, "t4", 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled lookup to fail with context.Canceled, got %v", err)
+	}
+	if _, err := g.ExplainWalk(ctx, []int{1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled explanation to fail with context.Canceled, got %v", err)
+	}
+}
@@ -1,19 +1,40 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"math"
 	"math/rand"
+	"runtime"
 	"strings"
-	"time"
+	"sync"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/tracing"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // Graph represents the SQLite database used to store the brain data
 type Graph struct {
-	Conn  *sql.DB
-	order int
+	// Conn is the single connection writes go through. Reads that must see
+	// uncommitted writes, like lookups while learning, use it too.
+	Conn *sql.DB
+	// Reader is a pool of read-only connections for generating replies. In WAL
+	// mode its reads run alongside each other and alongside writes, seeing the
+	// brain as of the last commit.
+	Reader *sql.DB
+	order  int
+	path   string
+	// checkpointer runs WAL checkpoints outside the writer's open transaction;
+	// it is nil for read-only graphs
+	checkpointer *sql.DB
+	// stopCheckpoints stops the periodic WAL checkpoints
+	stopCheckpoints func()
+	// batchMu keeps batches from committing or rolling back each other's writes
+	batchMu sync.Mutex
 }
 
 // Order returns the order of the graph
@@ -21,10 +42,19 @@ func (g *Graph) Order() int {
 	return g.order
 }
 
-// NewGraph creates a new Graph with the specified SQLite database
-func NewGraph(dbPath string) (*Graph, error) {
+// NewGraph creates a new Graph with the specified SQLite database. It returns
+// ErrCorrupt when the database fails its integrity check.
+func NewGraph(dbPath string, opts GraphOptions) (*Graph, error) {
+	synchronous, err := opts.Durability.synchronous()
+	if err != nil {
+		return nil, err
+	}
+
 	// Append SQLite performance flags to the DSN
-	dsn := dbPath + "?_journal=WAL&_synchronous=OFF&_locking_mode=NORMAL&_cache_size=10000&_busy_timeout=5000"
+	dsn := dbPath + "?_journal=WAL&_synchronous=" + synchronous + "&_locking_mode=NORMAL&_cache_size=10000&_busy_timeout=5000"
+	if opts.ReadOnly {
+		dsn = "file:" + dbPath + "?mode=ro&_cache_size=10000&_busy_timeout=5000"
+	}
 
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
@@ -33,25 +63,43 @@ func NewGraph(dbPath string) (*Graph, error) {
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
+		db.Close()
+		if isCorrupt(err) {
+			return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, dbPath, err)
+		}
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	if !opts.ReadOnly && !opts.SkipIntegrityCheck {
+		if err := quickCheck(db, dbPath); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
 	// Retrieve the brain order from the database info table
 	var order int
 	err = db.QueryRow("SELECT text FROM info WHERE attribute = 'order'").Scan(&order)
 	if err != nil {
+		db.Close()
+		if isCorrupt(err) {
+			return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, dbPath, err)
+		}
 		return nil, fmt.Errorf("failed to get brain order: %w", err)
 	}
 
-	// Set more pragmas for better performance
+	// Set more pragmas for performance, as far as the durability allows
 	pragmas := []string{
 		"PRAGMA cache_size=10000",
-		"PRAGMA synchronous=OFF",
+		"PRAGMA synchronous=" + synchronous,
 		"PRAGMA journal_mode=WAL",
 		"PRAGMA temp_store=MEMORY",
-		"PRAGMA mmap_size=30000000000",
+		fmt.Sprintf("PRAGMA mmap_size=%d", opts.Durability.mmapSize()),
 		"PRAGMA page_size=4096",
 	}
+	if opts.ReadOnly {
+		pragmas = []string{"PRAGMA cache_size=10000", "PRAGMA temp_store=MEMORY"}
+	}
 
 	for _, pragma := range pragmas {
 		if _, err := db.Exec(pragma); err != nil {
@@ -64,23 +112,78 @@ func NewGraph(dbPath string) (*Graph, error) {
 	db.SetMaxOpenConns(1) // SQLite can only handle one writer at a time
 	db.SetMaxIdleConns(1)
 
-	rand.Seed(time.Now().UnixNano())
-
 	graph := &Graph{
-		Conn:  db,
-		order: order,
+		Conn:            db,
+		order:           order,
+		path:            dbPath,
+		stopCheckpoints: func() {},
+	}
+
+	if !opts.ReadOnly {
+		if err := graph.migrate(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	// Readers are opened after the writer has switched the database to WAL
+	reader, err := openReader(dbPath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	graph.Reader = reader
+
+	if !opts.ReadOnly {
+		if graph.checkpointer, err = openCheckpointer(dbPath); err != nil {
+			graph.Close()
+			return nil, err
+		}
+		if opts.CheckpointInterval > 0 {
+			stop := make(chan struct{})
+			graph.stopCheckpoints = sync.OnceFunc(func() { close(stop) })
+			go graph.checkpointEvery(opts.CheckpointInterval, stop)
+		}
 	}
 
 	return graph, nil
 }
 
-// Close closes the database connection
+// openReader opens a pool of read-only connections, one per CPU
+func openReader(dbPath string) (*sql.DB, error) {
+	dsn := "file:" + dbPath + "?mode=ro&_cache_size=10000&_busy_timeout=5000"
+
+	reader, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open read-only database: %w", err)
+	}
+	if err := reader.Ping(); err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to connect to read-only database: %w", err)
+	}
+
+	reader.SetMaxOpenConns(runtime.NumCPU())
+	reader.SetMaxIdleConns(runtime.NumCPU())
+	return reader, nil
+}
+
+// Close stops checkpointing and closes the reader pool and the writer connection
 func (g *Graph) Close() error {
-	return g.Conn.Close()
+	g.stopCheckpoints()
+	if g.checkpointer != nil {
+		g.checkpointer.Close()
+	}
+	readerErr := g.Reader.Close()
+	if err := g.Conn.Close(); err != nil {
+		return err
+	}
+	return readerErr
 }
 
 // Commit commits the current transaction or starts one if none exists
 func (g *Graph) Commit() error {
+	defer g.observe("Commit")()
+
 	// Explicitly try to BEGIN a transaction first
 	// If it fails because one is active, that's ok
 	g.Conn.Exec("BEGIN")
@@ -96,8 +199,35 @@ func (g *Graph) Commit() error {
 	return err
 }
 
+// Batch runs fn in a transaction of its own so its writes are committed together,
+// with a single sync. Writes made before the batch are committed first. If fn
+// fails, every write it made is rolled back.
+func (g *Graph) Batch(fn func() error) error {
+	defer g.observe("Batch")()
+
+	g.batchMu.Lock()
+	defer g.batchMu.Unlock()
+
+	if err := g.Commit(); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		if _, rbErr := g.Conn.Exec("ROLLBACK"); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		// Leave a transaction open for the next writes, as Commit does
+		g.Conn.Exec("BEGIN")
+		return err
+	}
+
+	return g.Commit()
+}
+
 // BeginTransaction begins a new transaction if one isn't already active
 func (g *Graph) BeginTransaction() error {
+	defer g.observe("BeginTransaction")()
+
 	// Check if a transaction is already active by attempting a no-op update
 	var inTransaction bool
 	err := g.Conn.QueryRow("SELECT 1 FROM sqlite_master LIMIT 0").Scan()
@@ -117,9 +247,17 @@ func (g *Graph) BeginTransaction() error {
 }
 
 // GetTokenByText gets a token ID by its text, optionally creating it if it doesn't exist
-func (g *Graph) GetTokenByText(text string, create bool) (int, error) {
+func (g *Graph) GetTokenByText(ctx context.Context, text string, create bool) (int, error) {
+	defer g.observeContext(ctx, "GetTokenByText")()
+
+	// Lookups while learning must see the tokens created in the open transaction
+	conn := g.Reader
+	if create {
+		conn = g.Conn
+	}
+
 	var id int
-	err := g.Conn.QueryRow("SELECT id FROM tokens WHERE text = ?", text).Scan(&id)
+	err := conn.QueryRowContext(ctx, "SELECT id FROM tokens WHERE text = ?", text).Scan(&id)
 	if err == nil {
 		return id, nil
 	}
@@ -139,7 +277,7 @@ func (g *Graph) GetTokenByText(text string, create bool) (int, error) {
 		}
 	}
 
-	result, err := g.Conn.Exec("INSERT INTO tokens (text, is_word) VALUES (?, ?)", text, isWord)
+	result, err := g.Conn.ExecContext(ctx, "INSERT INTO tokens (text, is_word) VALUES (?, ?)", text, isWord)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert token: %w", err)
 	}
@@ -152,12 +290,21 @@ func (g *Graph) GetTokenByText(text string, create bool) (int, error) {
 	return int(lastID), nil
 }
 
-// GetNodeByTokens gets a node ID for the specified token IDs
-func (g *Graph) GetNodeByTokens(tokens []int) (int, error) {
+// GetNodeByTokens gets a node ID for the specified token IDs, optionally creating
+// it if it doesn't exist. Without create a missing node has ID 0.
+func (g *Graph) GetNodeByTokens(ctx context.Context, tokens []int, create bool) (int, error) {
+	defer g.observeContext(ctx, "GetNodeByTokens")()
+
 	if len(tokens) != g.order {
 		return 0, fmt.Errorf("expected %d tokens, got %d", g.order, len(tokens))
 	}
 
+	// Lookups while learning must see the nodes created in the open transaction
+	conn := g.Reader
+	if create {
+		conn = g.Conn
+	}
+
 	// Build the query dynamically based on the order
 	var conditions []string
 	args := make([]interface{}, 0, g.order)
@@ -168,13 +315,16 @@ func (g *Graph) GetNodeByTokens(tokens []int) (int, error) {
 
 	query := fmt.Sprintf("SELECT id FROM nodes WHERE %s", strings.Join(conditions, " AND "))
 	var id int
-	err := g.Conn.QueryRow(query, args...).Scan(&id)
+	err := conn.QueryRowContext(ctx, query, args...).Scan(&id)
 	if err == nil {
 		return id, nil
 	}
 	if err != sql.ErrNoRows {
 		return 0, fmt.Errorf("failed to get node: %w", err)
 	}
+	if !create {
+		return 0, nil
+	}
 
 	// Node not found, create it
 	columns := make([]string, 0, g.order)
@@ -203,6 +353,8 @@ func (g *Graph) GetNodeByTokens(tokens []int) (int, error) {
 
 // AddEdge adds an edge between two nodes or increments its count if it already exists
 func (g *Graph) AddEdge(prevNode, nextNode int, hasSpace bool) error {
+	defer g.observe("AddEdge")()
+
 	hasSpaceInt := 0
 	if hasSpace {
 		hasSpaceInt = 1
@@ -234,22 +386,81 @@ func (g *Graph) AddEdge(prevNode, nextNode int, hasSpace bool) error {
 	return nil
 }
 
-// GetRandomNodeWithToken returns a random node containing the specified token
-func (g *Graph) GetRandomNodeWithToken(tokenID int) (int, error) {
-	var count int
-	err := g.Conn.QueryRow("SELECT COUNT(*) FROM nodes WHERE token0_id = ?", tokenID).Scan(&count)
+// AdjustEdgeCount adds delta to the count of an existing edge, used to reinforce
+// accepted completions or penalize rejected ones. Counts never drop below 1 so a
+// penalized edge stays reachable. The change is committed before it returns.
+func (g *Graph) AdjustEdgeCount(prevNode, nextNode int, hasSpace bool, delta int) error {
+	defer g.observe("AdjustEdgeCount")()
+
+	return g.Batch(func() error {
+		return g.adjustEdgeCount(prevNode, nextNode, hasSpace, delta)
+	})
+}
+
+// adjustEdgeCount is AdjustEdgeCount in the open transaction
+func (g *Graph) adjustEdgeCount(prevNode, nextNode int, hasSpace bool, delta int) error {
+	hasSpaceInt := 0
+	if hasSpace {
+		hasSpaceInt = 1
+	}
+
+	_, err := g.Conn.Exec(
+		"UPDATE edges SET count = MAX(1, count + ?) WHERE prev_node = ? AND next_node = ? AND has_space = ?",
+		delta, prevNode, nextNode, hasSpaceInt)
 	if err != nil {
-		return 0, fmt.Errorf("failed to count nodes: %w", err)
+		return fmt.Errorf("failed to adjust edge: %w", err)
 	}
 
-	if count == 0 {
+	return nil
+}
+
+// Reinforce adds delta to the count of every edge in edgeIDs, the edges a walk
+// took to produce a completion, like AdjustEdgeCount. The changes are committed
+// together, so walks see them once it returns. Edges forgotten since the walk
+// are skipped.
+func (g *Graph) Reinforce(edgeIDs []int, delta int) error {
+	defer g.observe("Reinforce")()
+
+	return g.Batch(func() error {
+		for _, edgeID := range edgeIDs {
+			var prevNode, nextNode, hasSpace int
+			err := g.Conn.QueryRow("SELECT prev_node, next_node, has_space FROM edges WHERE id = ?", edgeID).
+				Scan(&prevNode, &nextNode, &hasSpace)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get edge: %w", err)
+			}
+
+			if err := g.adjustEdgeCount(prevNode, nextNode, hasSpace == 1, delta); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRandomNodeWithToken returns a random node starting with the specified token,
+// chosen with rng, or 0 if there is none. It picks a random ID between the
+// token's first and last node and takes the next node from there, which only
+// reads the index rather than counting the nodes; nodes after a gap in the IDs
+// are picked more often.
+func (g *Graph) GetRandomNodeWithToken(ctx context.Context, rng *rand.Rand, tokenID int) (int, error) {
+	defer g.observeContext(ctx, "GetRandomNodeWithToken")()
+
+	var first, last sql.NullInt64
+	err := g.Reader.QueryRowContext(ctx, "SELECT MIN(id), MAX(id) FROM nodes WHERE token0_id = ?", tokenID).Scan(&first, &last)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get node range: %w", err)
+	}
+	if !first.Valid {
 		return 0, nil
 	}
 
-	// Select a random node
-	offset := rand.Intn(count)
+	target := first.Int64 + rng.Int63n(last.Int64-first.Int64+1)
 	var nodeID int
-	err = g.Conn.QueryRow("SELECT id FROM nodes WHERE token0_id = ? LIMIT 1 OFFSET ?", tokenID, offset).Scan(&nodeID)
+	err = g.Reader.QueryRowContext(ctx, "SELECT id FROM nodes WHERE token0_id = ? AND id >= ? ORDER BY id LIMIT 1", tokenID, target).Scan(&nodeID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get random node: %w", err)
 	}
@@ -257,22 +468,29 @@ func (g *Graph) GetRandomNodeWithToken(tokenID int) (int, error) {
 	return nodeID, nil
 }
 
-// GetRandomToken returns a random token ID
-func (g *Graph) GetRandomToken() (int, error) {
-	var count int
-	err := g.Conn.QueryRow("SELECT COUNT(*) FROM tokens WHERE text != ''").Scan(&count)
-	if err != nil {
-		return 0, fmt.Errorf("failed to count tokens: %w", err)
-	}
+// GetRandomToken returns a random token ID chosen with rng, skipping the end
+// token. Like GetRandomNodeWithToken it picks a random ID and takes the next
+// token from there, wrapping around to the first.
+func (g *Graph) GetRandomToken(ctx context.Context, rng *rand.Rand) (int, error) {
+	defer g.observeContext(ctx, "GetRandomToken")()
 
-	if count == 0 {
+	var last sql.NullInt64
+	if err := g.Reader.QueryRowContext(ctx, "SELECT MAX(id) FROM tokens").Scan(&last); err != nil {
+		return 0, fmt.Errorf("failed to get token range: %w", err)
+	}
+	if !last.Valid {
 		return 0, fmt.Errorf("no tokens in database")
 	}
 
-	// Select a random token
-	offset := rand.Intn(count)
+	target := 1 + rng.Int63n(last.Int64)
 	var tokenID int
-	err = g.Conn.QueryRow("SELECT id FROM tokens WHERE text != '' LIMIT 1 OFFSET ?", offset).Scan(&tokenID)
+	err := g.Reader.QueryRowContext(ctx, "SELECT id FROM tokens WHERE id >= ? AND text != '' ORDER BY id LIMIT 1", target).Scan(&tokenID)
+	if err == sql.ErrNoRows {
+		err = g.Reader.QueryRowContext(ctx, "SELECT id FROM tokens WHERE text != '' ORDER BY id LIMIT 1").Scan(&tokenID)
+	}
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no tokens in database")
+	}
 	if err != nil {
 		return 0, fmt.Errorf("failed to get random token: %w", err)
 	}
@@ -282,11 +500,13 @@ func (g *Graph) GetRandomToken() (int, error) {
 
 // GetTextByEdge returns the text and space info for a given edge
 func (g *Graph) GetTextByEdge(edgeID int) (string, bool, error) {
+	defer g.observe("GetTextByEdge")()
+
 	// Get the next node ID for this edge
 	var nextNodeID int
 	var hasSpace int
 
-	err := g.Conn.QueryRow(`
+	err := g.Reader.QueryRow(`
 		SELECT next_node, has_space 
 		FROM edges
 		WHERE id = ?
@@ -298,7 +518,7 @@ func (g *Graph) GetTextByEdge(edgeID int) (string, bool, error) {
 
 	// Get the token ID for this node
 	var tokenID int
-	err = g.Conn.QueryRow(`
+	err = g.Reader.QueryRow(`
 		SELECT token0_id FROM nodes
 		WHERE id = ?
 	`, nextNodeID).Scan(&tokenID)
@@ -309,7 +529,7 @@ func (g *Graph) GetTextByEdge(edgeID int) (string, bool, error) {
 
 	// Get the token text
 	var text string
-	err = g.Conn.QueryRow(`
+	err = g.Reader.QueryRow(`
 		SELECT text FROM tokens
 		WHERE id = ?
 	`, tokenID).Scan(&text)
@@ -322,7 +542,9 @@ func (g *Graph) GetTextByEdge(edgeID int) (string, bool, error) {
 }
 
 // GetWordTokens returns the token IDs in the node that are actual words
-func (g *Graph) GetWordTokens(tokenIDs []int) ([]int, error) {
+func (g *Graph) GetWordTokens(ctx context.Context, tokenIDs []int) ([]int, error) {
+	defer g.observeContext(ctx, "GetWordTokens")()
+
 	if len(tokenIDs) == 0 {
 		return nil, nil
 	}
@@ -337,7 +559,7 @@ func (g *Graph) GetWordTokens(tokenIDs []int) ([]int, error) {
 
 	// Build and execute the query
 	query := fmt.Sprintf("SELECT id FROM tokens WHERE id IN (%s) AND is_word = 1", strings.Join(placeholders, ", "))
-	rows, err := g.Conn.Query(query, args...)
+	rows, err := g.Reader.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query word tokens: %w", err)
 	}
@@ -359,94 +581,204 @@ func (g *Graph) GetWordTokens(tokenIDs []int) ([]int, error) {
 	return result, nil
 }
 
+// StopReason describes why a walk over the graph ended
+type StopReason string
+
+const (
+	// StopEnd means the walk reached the requested end node
+	StopEnd StopReason = "end"
+	// StopDeadEnd means the current node had no usable edges
+	StopDeadEnd StopReason = "dead_end"
+	// StopMaxLength means the walk hit its depth limit
+	StopMaxLength StopReason = "max_length"
+	// StopCancelled means the context was cancelled or the step callback stopped the walk
+	StopCancelled StopReason = "cancelled"
+)
+
+// StepFunc is called with every edge chosen during a walk; returning an error stops the walk
+type StepFunc func(edgeID int) error
+
+// Sampling controls how a walk chooses between edges
+type Sampling struct {
+	// Rand is the source of the walk's random choices, so the same source and
+	// graph give the same walk
+	Rand *rand.Rand
+	// Temperature scales edge counts before sampling. At 1 edges are chosen in
+	// proportion to their count, higher values flatten the choice and 0 always
+	// takes the most frequent edge.
+	Temperature float64
+}
+
 // SearchRandomWalk performs a random walk from startID to endID in the specified direction
-func (g *Graph) SearchRandomWalk(startID, endID int, direction bool) ([]int, error) {
+func (g *Graph) SearchRandomWalk(sampling Sampling, startID, endID int, direction bool) ([]int, error) {
+	edgeIDs, _, err := g.SearchRandomWalkContext(context.Background(), sampling, startID, endID, direction, nil)
+	return edgeIDs, err
+}
+
+// SearchRandomWalkContext performs a random walk like SearchRandomWalk, calling step as soon
+// as each edge is chosen so callers can emit tokens while the walk is still running.
+// The walk stops early when ctx is cancelled or step returns an error.
+func (g *Graph) SearchRandomWalkContext(ctx context.Context, sampling Sampling, startID, endID int, direction bool, step StepFunc) ([]int, StopReason, error) {
+	ctx, span := tracing.Start(ctx, "SearchRandomWalk",
+		attribute.Int("start_node", startID),
+		attribute.Bool("forward", direction))
+	edgeIDs, reason, err := g.searchRandomWalk(ctx, sampling, startID, endID, direction, step)
+	if err == nil {
+		observeWalk(edgeIDs, reason)
+		span.SetAttributes(attribute.Int("edges", len(edgeIDs)), attribute.String("stop_reason", string(reason)))
+	}
+	tracing.End(span, err)
+	return edgeIDs, reason, err
+}
+
+// observeWalk records the depth of a finished walk and whether it hit a dead end
+func observeWalk(edgeIDs []int, reason StopReason) {
+	metrics.WalkDepth.Observe(float64(len(edgeIDs)))
+	if reason == StopDeadEnd {
+		metrics.DeadEnds.Inc()
+	}
+}
+
+// searchRandomWalk performs the walk for SearchRandomWalkContext
+func (g *Graph) searchRandomWalk(ctx context.Context, sampling Sampling, startID, endID int, direction bool, step StepFunc) ([]int, StopReason, error) {
 	var edgeIDs []int
 	currentID := startID
 	maxLength := 15 // Limit depth for better performance (down from 100)
 
 	for i := 0; i < maxLength; i++ {
-		// Build a more efficient query with LIMIT to reduce processing time
+		if ctx.Err() != nil {
+			return edgeIDs, StopCancelled, nil
+		}
+
+		// Edges are read in a stable order so the choice only depends on rng
 		query := ""
 		if direction {
 			// Forward direction (prev_node -> next_node)
-			query = "SELECT id, next_node FROM edges WHERE prev_node = ? ORDER BY RANDOM() LIMIT 5"
+			query = `SELECT id, next_node, count FROM edges
+				WHERE prev_node = ? AND next_node != prev_node
+				ORDER BY count DESC, id LIMIT ?`
 		} else {
 			// Backward direction (next_node -> prev_node)
-			query = "SELECT id, prev_node FROM edges WHERE next_node = ? ORDER BY RANDOM() LIMIT 5"
+			query = `SELECT id, prev_node, count FROM edges
+				WHERE next_node = ? AND next_node != prev_node
+				ORDER BY count DESC, id LIMIT ?`
 		}
 
 		// Execute the query
-		rows, err := g.Conn.Query(query, currentID)
+		done := g.observeContext(ctx, "SearchRandomWalk")
+		rows, err := g.Reader.QueryContext(ctx, query, currentID, maxWalkEdges)
 		if err != nil {
-			return nil, fmt.Errorf("failed to query edges: %w", err)
+			if ctx.Err() != nil {
+				return edgeIDs, StopCancelled, nil
+			}
+			return nil, "", fmt.Errorf("failed to query edges: %w", err)
 		}
 
 		// Collect edges
-		var edges []struct {
-			ID       int
-			TargetID int
-		}
+		var edges []walkEdge
 
 		for rows.Next() {
-			var id, targetID int
-			if err := rows.Scan(&id, &targetID); err != nil {
+			var e walkEdge
+			if err := rows.Scan(&e.ID, &e.TargetID, &e.Count); err != nil {
 				rows.Close()
-				return nil, fmt.Errorf("failed to scan edge: %w", err)
-			}
-
-			// Skip self-loops
-			if targetID == currentID {
-				continue
+				return nil, "", fmt.Errorf("failed to scan edge: %w", err)
 			}
 
-			edges = append(edges, struct {
-				ID       int
-				TargetID int
-			}{
-				ID:       id,
-				TargetID: targetID,
-			})
+			edges = append(edges, e)
 		}
 		rows.Close()
+		done()
 
 		if err := rows.Err(); err != nil {
-			return nil, fmt.Errorf("error iterating edge rows: %w", err)
+			if ctx.Err() != nil {
+				return edgeIDs, StopCancelled, nil
+			}
+			return nil, "", fmt.Errorf("error iterating edge rows: %w", err)
 		}
 
 		if len(edges) == 0 {
-			break // Dead end
+			return edgeIDs, StopDeadEnd, nil
 		}
 
-		// Choose first edge for speed
-		chosenEdge := edges[0]
-		if len(edges) > 1 {
-			// If we have multiple choices, pick a random one
-			chosenEdge = edges[rand.Intn(len(edges))]
-		}
+		chosenEdge := chooseEdge(edges, sampling)
 
 		// Add the chosen edge to the path
 		edgeIDs = append(edgeIDs, chosenEdge.ID)
 		currentID = chosenEdge.TargetID
 
+		if step != nil {
+			if err := step(chosenEdge.ID); err != nil {
+				return edgeIDs, StopCancelled, nil
+			}
+		}
+
 		// Check if we've reached the end
 		if currentID == endID {
-			break
+			return edgeIDs, StopEnd, nil
+		}
+	}
+
+	return edgeIDs, StopMaxLength, nil
+}
+
+// maxWalkEdges is how many of a node's most frequent edges a walk samples from,
+// so a step from a hub node doesn't read all of its edges
+const maxWalkEdges = 32
+
+// walkEdge is an edge a walk can take from its current node
+type walkEdge struct {
+	ID       int
+	TargetID int
+	Count    int
+}
+
+// chooseEdge samples an edge with probability proportional to its count raised
+// to 1/temperature. Weights are computed relative to the largest count so high
+// counts and low temperatures don't overflow. Ties at temperature 0 go to the
+// oldest edge.
+func chooseEdge(edges []walkEdge, sampling Sampling) walkEdge {
+	best := edges[0]
+	for _, e := range edges[1:] {
+		if e.Count > best.Count {
+			best = e
 		}
 	}
+	if len(edges) == 1 || sampling.Temperature <= 0 {
+		return best
+	}
+
+	weights := make([]float64, len(edges))
+	total := 0.0
+	maxLog := math.Log(float64(max(best.Count, 1)))
+	for i, e := range edges {
+		weights[i] = math.Exp((math.Log(float64(max(e.Count, 1))) - maxLog) / sampling.Temperature)
+		total += weights[i]
+	}
 
-	return edgeIDs, nil
+	r := sampling.Rand.Float64() * total
+	for i, w := range weights {
+		r -= w
+		if r < 0 {
+			return edges[i]
+		}
+	}
+	return edges[len(edges)-1]
 }
 
 // FindEdgesForContext finds edges that match a given context of token IDs
 func (g *Graph) FindEdgesForContext(tokenIDs []int) ([]int, error) {
-	if len(tokenIDs) < 2 {
+	defer g.observe("FindEdgesForContext")()
+
+	if len(tokenIDs) == 0 {
 		return nil, fmt.Errorf("context too short")
 	}
 
-	// Get node IDs that contain the token context
-	nodeID, err := g.findNodeContainingContext(tokenIDs)
-	if err != nil || nodeID == 0 {
+	// Get the node that best continues the context
+	nodeID, err := g.findNodeContainingContext(context.Background(), tokenIDs)
+	if err != nil {
+		return nil, err
+	}
+	if nodeID == 0 {
 		return nil, fmt.Errorf("no matching context found")
 	}
 
@@ -459,54 +791,46 @@ func (g *Graph) FindEdgesForContext(tokenIDs []int) ([]int, error) {
 	return edges, nil
 }
 
-// findNodeContainingContext looks for a node containing a sequence of tokens
-func (g *Graph) findNodeContainingContext(tokenIDs []int) (int, error) {
-	// For exact match of our order, use GetNodeByTokens
-	if len(tokenIDs) == g.order {
-		return g.GetNodeByTokens(tokenIDs)
-	}
-
-	// For partial matches, we need a custom query
-	// This looks for nodes where the last N tokens match the first N tokens of our context
-	// where N is min(len(tokenIDs), g.order)
-
-	// Build the match query
-	matchLength := min(len(tokenIDs), g.order)
-	matchIDs := tokenIDs[0:matchLength]
-
-	// Convert token IDs to string for SQL
-	tokenStr := make([]string, len(matchIDs))
-	for i, id := range matchIDs {
-		tokenStr[i] = fmt.Sprintf("%d", id)
-	}
-
-	// Build query to find nodes with matching token sequences
-	// This is a simplified version that adapts to the schema
-	query := fmt.Sprintf(`
-		SELECT id FROM nodes WHERE id IN (
-			SELECT nodes.id FROM nodes
-			WHERE token0_id IN (%s)
-			LIMIT 20
-		)
-		LIMIT 1
-	`, strings.Join(tokenStr, ","))
+// findNodeContainingContext finds the node that best continues a context of
+// token IDs. It looks for nodes whose last k tokens equal the last k tokens of
+// the context, starting with the largest k up to the order and backing off to
+// shorter suffixes, like stupid backoff in n-gram models. Only nodes with
+// outgoing edges match, and among several the most frequent one wins.
+func (g *Graph) findNodeContainingContext(ctx context.Context, tokenIDs []int) (int, error) {
+	for k := min(len(tokenIDs), g.order); k > 0; k-- {
+		suffix := tokenIDs[len(tokenIDs)-k:]
+
+		conditions := make([]string, k)
+		args := make([]interface{}, k)
+		for i, id := range suffix {
+			conditions[i] = fmt.Sprintf("token%d_id = ?", g.order-k+i)
+			args[i] = id
+		}
 
-	var nodeID int
-	err := g.Conn.QueryRow(query).Scan(&nodeID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, nil
+		query := fmt.Sprintf(`
+			SELECT id FROM nodes
+			WHERE %s AND EXISTS (SELECT 1 FROM edges WHERE edges.prev_node = nodes.id)
+			ORDER BY count DESC, id
+			LIMIT 1
+		`, strings.Join(conditions, " AND "))
+
+		var nodeID int
+		err := g.Reader.QueryRowContext(ctx, query, args...).Scan(&nodeID)
+		if err == nil {
+			return nodeID, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, fmt.Errorf("failed to match context: %w", err)
 		}
-		return 0, err
 	}
 
-	return nodeID, nil
+	return 0, nil
 }
 
 // findEdgesFromNode gets edges that follow from the given node
 func (g *Graph) findEdgesFromNode(nodeID int) ([]int, error) {
 	// Query for edges that start from this node based on schema
-	rows, err := g.Conn.Query(`
+	rows, err := g.Reader.Query(`
 		SELECT id FROM edges 
 		WHERE prev_node = ?
 		ORDER BY count DESC
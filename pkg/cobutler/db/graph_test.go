@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db/dbtest"
+)
+
+func TestChooseEdge(t *testing.T) {
+	edges := []walkEdge{
+		{ID: 1, TargetID: 10, Count: 1},
+		{ID: 2, TargetID: 20, Count: 8},
+		{ID: 3, TargetID: 30, Count: 1},
+	}
+
+	// Temperature 0 is greedy
+	for i := 0; i < 10; i++ {
+		sampling := Sampling{Rand: rand.New(rand.NewSource(int64(i)))}
+		if got := chooseEdge(edges, sampling); got.ID != 2 {
+			t.Fatalf("Expected the most frequent edge at temperature 0, got %d", got.ID)
+		}
+	}
+
+	share := func(temperature float64) float64 {
+		sampling := Sampling{Rand: rand.New(rand.NewSource(1)), Temperature: temperature}
+		hits := 0
+		const draws = 10000
+		for i := 0; i < draws; i++ {
+			if chooseEdge(edges, sampling).ID == 2 {
+				hits++
+			}
+		}
+		return float64(hits) / draws
+	}
+
+	// At temperature 1 the frequent edge is taken in proportion to its count
+	if got := share(1); got < 0.75 || got > 0.85 {
+		t.Errorf("Expected the frequent edge about 80%% of the time at temperature 1, got %.2f", got)
+	}
+
+	// Higher temperatures flatten the choice
+	if cold, hot := share(0.5), share(4); hot >= cold {
+		t.Errorf("Expected temperature 4 to flatten the choice, got %.2f vs %.2f at 0.5", hot, cold)
+	}
+}
+
+// newTestGraph opens a graph of the given order over a temporary database.
+// Node i+1 holds the tokens nodes[i], token n has the text "t<n>" and each edge
+// is a {prev, next, count} triple.
+func newTestGraph(t *testing.T, order int, nodes [][]int, edges [][3]int) *Graph {
+	t.Helper()
+
+	path := dbtest.Create(t, dbtest.Brain{Order: order, Nodes: nodes, Edges: edges})
+	g, err := NewGraph(path, GraphOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open graph: %v", err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+// singleTokenNodes returns n nodes of order 1 where node i holds token i
+func singleTokenNodes(n int) [][]int {
+	nodes := make([][]int, n)
+	for i := range nodes {
+		nodes[i] = []int{i + 1}
+	}
+	return nodes
+}
+
+func TestFindNodeContainingContext(t *testing.T) {
+	g := newTestGraph(t, 2, [][]int{
+		{1, 2}, // node 1
+		{3, 2}, // node 2, without edges
+		{2, 4}, // node 3
+		{5, 6}, // node 4, without edges
+		{7, 2}, // node 5
+	}, [][3]int{
+		{1, 3, 1},
+		{5, 3, 1},
+		{3, 1, 1},
+	})
+	if _, err := g.Conn.Exec("UPDATE nodes SET count = 3 WHERE id = 5"); err != nil {
+		t.Fatalf("Failed to update node count: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		context []int
+		want    int
+	}{
+		{name: "full suffix", context: []int{9, 1, 2}, want: 1},
+		{name: "backs off past nodes without edges", context: []int{3, 2}, want: 5},
+		{name: "single token", context: []int{4}, want: 3},
+		{name: "no match", context: []int{8, 6}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.findNodeContainingContext(context.Background(), tt.context)
+			if err != nil {
+				t.Fatalf("findNodeContainingContext failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("findNodeContainingContext(%v) = %d, want %d", tt.context, got, tt.want)
+			}
+		})
+	}
+
+	// The suffix lookups are served by indexes
+	var id, parent, unused int
+	var plan string
+	query := "EXPLAIN QUERY PLAN SELECT id FROM nodes WHERE token1_id = 2"
+	if err := g.Conn.QueryRow(query).Scan(&id, &parent, &unused, &plan); err != nil {
+		t.Fatalf("Failed to explain query: %v", err)
+	}
+	if !strings.Contains(plan, "nodes_context_suffix1") {
+		t.Errorf("Expected the suffix index to be used, got plan %q", plan)
+	}
+}
+
+func TestReaderRunsAlongsideWriter(t *testing.T) {
+	g := newTestGraph(t, 1, singleTokenNodes(3), [][3]int{{1, 2, 1}})
+
+	// An open write transaction doesn't block readers, which see the last commit
+	if _, err := g.Conn.Exec("BEGIN"); err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	defer g.Conn.Exec("ROLLBACK")
+	if err := g.AddEdge(2, 3, true); err != nil {
+		t.Fatalf("AddEdge failed: %v", err)
+	}
+
+	edges, err := g.findEdgesFromNode(2)
+	if err != nil {
+		t.Fatalf("findEdgesFromNode failed: %v", err)
+	}
+	if len(edges) != 0 {
+		t.Errorf("Expected readers not to see uncommitted edges, got %v", edges)
+	}
+	if text, _, err := g.GetTextByEdge(1); err != nil || text != "t2" {
+		t.Errorf("GetTextByEdge(1) = %q, %v, want t2", text, err)
+	}
+
+	// Lookups that create tokens see the writer's uncommitted tokens
+	created, err := g.GetTokenByText(context.Background(), "new", true)
+	if err != nil {
+		t.Fatalf("GetTokenByText failed: %v", err)
+	}
+	if id, err := g.GetTokenByText(context.Background(), "new", true); err != nil || id != created {
+		t.Errorf("GetTokenByText(new) = %d, %v, want %d", id, err, created)
+	}
+
+	// Node lookups without create read the last commit
+	node, err := g.GetNodeByTokens(context.Background(), []int{created}, true)
+	if err != nil {
+		t.Fatalf("GetNodeByTokens failed: %v", err)
+	}
+	if id, err := g.GetNodeByTokens(context.Background(), []int{created}, true); err != nil || id != node {
+		t.Errorf("GetNodeByTokens(create) = %d, %v, want %d", id, err, node)
+	}
+	if id, err := g.GetNodeByTokens(context.Background(), []int{created}, false); err != nil || id != 0 {
+		t.Errorf("GetNodeByTokens = %d, %v, want the uncommitted node to be unseen", id, err)
+	}
+	if id, err := g.GetNodeByTokens(context.Background(), []int{2}, false); err != nil || id != 2 {
+		t.Errorf("GetNodeByTokens([2]) = %d, %v, want 2", id, err)
+	}
+
+	if _, err := g.Reader.Exec("DELETE FROM edges"); err == nil {
+		t.Error("Expected the reader to be read-only")
+	}
+}
+
+func TestReinforce(t *testing.T) {
+	g := newTestGraph(t, 1, singleTokenNodes(3), [][3]int{{1, 2, 3}, {2, 3, 2}})
+
+	count := func(edgeID int) int {
+		t.Helper()
+		var count int
+		// Walks read through the reader, so reinforcement must be committed
+		if err := g.Reader.QueryRow("SELECT count FROM edges WHERE id = ?", edgeID).Scan(&count); err != nil {
+			t.Fatalf("Failed to read edge count: %v", err)
+		}
+		return count
+	}
+
+	// Edges that no longer exist are skipped
+	if err := g.Reinforce([]int{1, 2, 99}, 2); err != nil {
+		t.Fatalf("Reinforce failed: %v", err)
+	}
+	if got := []int{count(1), count(2)}; got[0] != 5 || got[1] != 4 {
+		t.Errorf("Expected counts [5 4] after reinforcing, got %v", got)
+	}
+
+	// Penalized edges stay reachable
+	if err := g.Reinforce([]int{2}, -10); err != nil {
+		t.Fatalf("Reinforce failed: %v", err)
+	}
+	if got := count(2); got != 1 {
+		t.Errorf("Expected a penalized count of 1, got %d", got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	g := newTestGraph(t, 1, singleTokenNodes(3), nil)
+
+	edges := func() int {
+		t.Helper()
+		var count int
+		if err := g.Reader.QueryRow("SELECT COUNT(*) FROM edges").Scan(&count); err != nil {
+			t.Fatalf("Failed to count edges: %v", err)
+		}
+		return count
+	}
+
+	// A failed batch keeps none of its writes
+	failed := errors.New("failed")
+	err := g.Batch(func() error {
+		if err := g.AddEdge(1, 2, true); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Expected the batch's error, got %v", err)
+	}
+	if got := edges(); got != 0 {
+		t.Errorf("Expected a failed batch to be rolled back, got %d edges", got)
+	}
+
+	// A successful batch is committed, so readers see it
+	err = g.Batch(func() error {
+		if err := g.AddEdge(1, 2, true); err != nil {
+			return err
+		}
+		return g.AddEdge(2, 3, true)
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if got := edges(); got != 2 {
+		t.Errorf("Expected 2 committed edges, got %d", got)
+	}
+}
+
+func TestSearchRandomWalkCapsEdges(t *testing.T) {
+	// Node 1 is a hub with an edge to each other node; the rarest ones are past the cap
+	hubEdges := maxWalkEdges + 8
+	var edges [][3]int
+	for i := 0; i < hubEdges; i++ {
+		edges = append(edges, [3]int{1, i + 2, hubEdges - i})
+	}
+	g := newTestGraph(t, 1, singleTokenNodes(hubEdges+1), edges)
+
+	// At a high temperature every edge is about as likely, so uncapped walks
+	// would take the rare ones
+	for seed := int64(0); seed < 200; seed++ {
+		sampling := Sampling{Rand: rand.New(rand.NewSource(seed)), Temperature: 100}
+		edgeIDs, err := g.SearchRandomWalk(sampling, 1, 0, true)
+		if err != nil {
+			t.Fatalf("SearchRandomWalk failed: %v", err)
+		}
+		if len(edgeIDs) != 1 || edgeIDs[0] > maxWalkEdges {
+			t.Fatalf("Expected one of the %d most frequent edges, got %v", maxWalkEdges, edgeIDs)
+		}
+	}
+}
+
+func TestGetRandomNodeWithToken(t *testing.T) {
+	// Nodes 1, 3 and 6 start with token 7, the others with the end token 8, which
+	// has the highest ID so picking it wraps around
+	path := dbtest.Create(t, dbtest.Brain{
+		Order:  2,
+		Tokens: map[int]string{8: ""},
+		Nodes:  [][]int{{7, 1}, {8, 1}, {7, 2}, {8, 2}, {8, 3}, {7, 3}},
+	})
+	g, err := NewGraph(path, GraphOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open graph: %v", err)
+	}
+	defer g.Close()
+
+	picked := map[int]bool{}
+	for seed := int64(0); seed < 100; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		nodeID, err := g.GetRandomNodeWithToken(context.Background(), rng, 7)
+		if err != nil {
+			t.Fatalf("GetRandomNodeWithToken failed: %v", err)
+		}
+		picked[nodeID] = true
+
+		tokenID, err := g.GetRandomToken(context.Background(), rng)
+		if err != nil {
+			t.Fatalf("GetRandomToken failed: %v", err)
+		}
+		if tokenID == 8 {
+			t.Fatal("Expected GetRandomToken to skip the end token")
+		}
+	}
+	if len(picked) != 3 || !picked[1] || !picked[3] || !picked[6] {
+		t.Errorf("Expected nodes 1, 3 and 6 to be picked, got %v", picked)
+	}
+
+	if nodeID, err := g.GetRandomNodeWithToken(context.Background(), rand.New(rand.NewSource(1)), 99); err != nil || nodeID != 0 {
+		t.Errorf("GetRandomNodeWithToken(99) = %d, %v, want 0", nodeID, err)
+	}
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// schemaVersionAttribute is the info table attribute holding the version of
+// cobutler's additions to the cobe schema
+const schemaVersionAttribute = "cobutler_schema_version"
+
+// migration brings a brain's schema to version
+type migration struct {
+	version int
+	name    string
+	apply   func(tx *sql.Tx, order int) error
+}
+
+// migrations are applied in order to brains whose schema version is older
+var migrations = []migration{
+	{version: 1, name: "node indexes", apply: createNodeIndexes},
+}
+
+// migrate applies the migrations the brain hasn't had yet, each in a transaction
+// together with the version it brings the schema to
+func (g *Graph) migrate() error {
+	var text string
+	err := g.Conn.QueryRow("SELECT text FROM info WHERE attribute = ?", schemaVersionAttribute).Scan(&text)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	version := 0
+	if err == nil {
+		if version, err = strconv.Atoi(text); err != nil {
+			return fmt.Errorf("invalid schema version %q: %w", text, err)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := g.applyMigration(m); err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d (%s): %w", m.version, m.name, err)
+		}
+		slog.Info("Migrated brain schema", "database", g.path, "version", m.version, "migration", m.name)
+	}
+	return nil
+}
+
+// applyMigration applies m and records its version in one transaction
+func (g *Graph) applyMigration(m migration) error {
+	tx, err := g.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.apply(tx, g.order); err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT OR REPLACE INTO info (attribute, text) VALUES (?, ?)",
+		schemaVersionAttribute, strconv.Itoa(m.version))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createNodeIndexes creates the indexes findNodeContainingContext needs to match
+// each suffix of a node's tokens, from the last token alone up to all of them,
+// and the one GetRandomNodeWithToken needs to find a token's nodes by ID
+func createNodeIndexes(tx *sql.Tx, order int) error {
+	// Order 1 brains get the token index as their one suffix index
+	if order > 1 {
+		if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS nodes_token0 ON nodes (token0_id)"); err != nil {
+			return fmt.Errorf("failed to create token index: %w", err)
+		}
+	}
+
+	for k := 1; k <= order; k++ {
+		columns := make([]string, k)
+		for i := range columns {
+			columns[i] = fmt.Sprintf("token%d_id", order-k+i)
+		}
+
+		stmt := fmt.Sprintf("CREATE INDEX IF NOT EXISTS nodes_context_suffix%d ON nodes (%s)",
+			k, strings.Join(columns, ", "))
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create context index: %w", err)
+		}
+	}
+	return nil
+}
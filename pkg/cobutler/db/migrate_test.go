@@ -0,0 +1,52 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db/dbtest"
+)
+
+func TestMigrate(t *testing.T) {
+	path := dbtest.Create(t, dbtest.Brain{Order: 2})
+
+	open := func() *Graph {
+		t.Helper()
+		g, err := NewGraph(path, GraphOptions{})
+		if err != nil {
+			t.Fatalf("Failed to open graph: %v", err)
+		}
+		return g
+	}
+	hasIndex := func(g *Graph, name string) bool {
+		t.Helper()
+		var count int
+		err := g.Conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", name).Scan(&count)
+		if err != nil {
+			t.Fatalf("Failed to look up index: %v", err)
+		}
+		return count == 1
+	}
+
+	g := open()
+	for _, name := range []string{"nodes_token0", "nodes_context_suffix1", "nodes_context_suffix2"} {
+		if !hasIndex(g, name) {
+			t.Errorf("Expected the first open to create index %s", name)
+		}
+	}
+	var version string
+	if err := g.Conn.QueryRow("SELECT text FROM info WHERE attribute = ?", schemaVersionAttribute).Scan(&version); err != nil || version != "1" {
+		t.Errorf("Expected schema version 1, got %q, %v", version, err)
+	}
+
+	// Migrated brains aren't migrated again
+	if _, err := g.Conn.Exec("DROP INDEX nodes_context_suffix1"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	g.Close()
+
+	g = open()
+	defer g.Close()
+	if hasIndex(g, "nodes_context_suffix1") {
+		t.Error("Expected a migrated brain to skip its migrations")
+	}
+}
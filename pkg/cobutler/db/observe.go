@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/tracing"
+)
+
+// observe starts a span for a Graph method that has no context of its own. The
+// returned function ends it and records the method's latency; it is meant to be
+// deferred at the top of the method.
+func (g *Graph) observe(method string) func() {
+	return g.observeContext(context.Background(), method)
+}
+
+// observeContext is observe for methods that have a context of their own
+func (g *Graph) observeContext(ctx context.Context, method string) func() {
+	start := time.Now()
+	_, span := tracing.Start(ctx, "sqlite "+method,
+		attribute.String("db.system.name", "sqlite"),
+		attribute.String("db.operation.name", method))
+	return func() {
+		span.End()
+		metrics.ObserveQuery(method, start)
+	}
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// StatsTop is how many of the most frequent tokens and n-grams brains report
+const StatsTop = 10
+
+// Stats summarizes the size and contents of a graph
+type Stats struct {
+	Order int `json:"order"`
+	// Tokenizer is the tokenizer the brain was created with, if recorded
+	Tokenizer string `json:"tokenizer,omitempty"`
+	Tokens    int64  `json:"tokens"`
+	Nodes     int64  `json:"nodes"`
+	Edges     int64  `json:"edges"`
+	// EdgeWeight is the sum of all edge counts, how many transitions were learned
+	EdgeWeight int64 `json:"edge_weight"`
+	// TopTokens are the most frequently learned tokens
+	TopTokens []Frequency `json:"top_tokens"`
+	// TopNgrams are the most frequently learned nodes, each order tokens long
+	TopNgrams []Frequency `json:"top_ngrams"`
+	// FileSize and WALSize are the sizes in bytes of the database file and its
+	// write-ahead log
+	FileSize int64 `json:"file_size"`
+	WALSize  int64 `json:"wal_size"`
+}
+
+// Frequency is a token or n-gram with the total count of the edges leading to it
+type Frequency struct {
+	Text  string `json:"text"`
+	Count int64  `json:"count"`
+}
+
+// Size is the number of tokens, nodes and edges in a graph
+type Size struct {
+	Tokens int64 `json:"tokens"`
+	Nodes  int64 `json:"nodes"`
+	Edges  int64 `json:"edges"`
+}
+
+// Size counts the tokens, nodes and edges of the graph without the frequency
+// queries of Stats
+func (g *Graph) Size() (Size, error) {
+	defer g.observe("Size")()
+
+	var size Size
+	err := g.Reader.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM tokens),
+			(SELECT COUNT(*) FROM nodes),
+			(SELECT COUNT(*) FROM edges)
+	`).Scan(&size.Tokens, &size.Nodes, &size.Edges)
+	if err != nil {
+		return Size{}, fmt.Errorf("failed to count graph: %w", err)
+	}
+	return size, nil
+}
+
+// Stats reports the size of the graph along with its topN most frequent tokens
+// and n-grams
+func (g *Graph) Stats(topN int) (Stats, error) {
+	defer g.observe("Stats")()
+
+	stats := Stats{Order: g.order}
+
+	err := g.Reader.QueryRow("SELECT text FROM info WHERE attribute = 'tokenizer'").Scan(&stats.Tokenizer)
+	if err != nil && err != sql.ErrNoRows {
+		return Stats{}, fmt.Errorf("failed to get tokenizer: %w", err)
+	}
+
+	err = g.Reader.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM tokens),
+			(SELECT COUNT(*) FROM nodes),
+			(SELECT COUNT(*) FROM edges),
+			(SELECT COALESCE(SUM(count), 0) FROM edges)
+	`).Scan(&stats.Tokens, &stats.Nodes, &stats.Edges, &stats.EdgeWeight)
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to count graph: %w", err)
+	}
+
+	// A token's frequency is the weight of the edges that add it, those into a
+	// node ending with it
+	stats.TopTokens, err = g.frequencies(context.Background(), fmt.Sprintf(`
+		SELECT tokens.text, SUM(edges.count) AS total
+		FROM edges
+		JOIN nodes ON nodes.id = edges.next_node
+		JOIN tokens ON tokens.id = nodes.token%d_id
+		WHERE tokens.text != ''
+		GROUP BY tokens.id
+		ORDER BY total DESC, tokens.id
+		LIMIT ?
+	`, g.order-1), topN)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	columns := make([]string, g.order)
+	joins := make([]string, g.order)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("t%d.text", i)
+		joins[i] = fmt.Sprintf("JOIN tokens t%d ON t%d.id = nodes.token%d_id", i, i, i)
+	}
+	stats.TopNgrams, err = g.frequencies(context.Background(), fmt.Sprintf(`
+		SELECT %s, SUM(edges.count) AS total
+		FROM edges
+		JOIN nodes ON nodes.id = edges.next_node
+		%s
+		GROUP BY nodes.id
+		ORDER BY total DESC, nodes.id
+		LIMIT ?
+	`, strings.Join(columns, " || ' ' || "), strings.Join(joins, "\n")), topN)
+	if err != nil {
+		return Stats{}, err
+	}
+	// The end token has no text, so n-grams at the start or end of learned text
+	// have extra separators
+	for i := range stats.TopNgrams {
+		stats.TopNgrams[i].Text = strings.Trim(stats.TopNgrams[i].Text, " ")
+	}
+
+	stats.FileSize = fileSize(g.path)
+	stats.WALSize = fileSize(g.path + "-wal")
+
+	return stats, nil
+}
+
+// frequencies runs a query returning text and count rows
+func (g *Graph) frequencies(ctx context.Context, query string, args ...interface{}) ([]Frequency, error) {
+	rows, err := g.Reader.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query frequencies: %w", err)
+	}
+	defer rows.Close()
+
+	frequencies := []Frequency{}
+	for rows.Next() {
+		var f Frequency
+		if err := rows.Scan(&f.Text, &f.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan frequency: %w", err)
+		}
+		frequencies = append(frequencies, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating frequency rows: %w", err)
+	}
+
+	return frequencies, nil
+}
+
+// fileSize returns the size of the file at path, or 0 if it doesn't exist
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
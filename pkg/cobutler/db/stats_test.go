@@ -0,0 +1,46 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	g := newTestGraph(t, 2, [][]int{{1, 2}, {2, 3}, {2, 4}}, [][3]int{
+		{1, 2, 3},
+		{1, 3, 5},
+		{2, 3, 1},
+	})
+
+	stats, err := g.Stats(2)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+
+	if stats.Order != 2 || stats.Tokens != 4 || stats.Nodes != 3 || stats.Edges != 3 || stats.EdgeWeight != 9 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+	wantTokens := []Frequency{{Text: "t4", Count: 6}, {Text: "t3", Count: 3}}
+	if !reflect.DeepEqual(stats.TopTokens, wantTokens) {
+		t.Errorf("TopTokens = %v, want %v", stats.TopTokens, wantTokens)
+	}
+	wantNgrams := []Frequency{{Text: "t2 t4", Count: 6}, {Text: "t2 t3", Count: 3}}
+	if !reflect.DeepEqual(stats.TopNgrams, wantNgrams) {
+		t.Errorf("TopNgrams = %v, want %v", stats.TopNgrams, wantNgrams)
+	}
+	if stats.FileSize == 0 {
+		t.Error("Expected a database file size")
+	}
+}
+
+func TestSize(t *testing.T) {
+	g := newTestGraph(t, 1, singleTokenNodes(3), [][3]int{{1, 2, 4}, {2, 3, 1}})
+
+	size, err := g.Size()
+	if err != nil {
+		t.Fatalf("Size failed: %v", err)
+	}
+	if size != (Size{Tokens: 3, Nodes: 3, Edges: 2}) {
+		t.Errorf("Unexpected size: %+v", size)
+	}
+}
@@ -0,0 +1,66 @@
+// Package httputil holds the HTTP helpers shared by the API, metrics and tracing
+// middleware
+package httputil
+
+import "net/http"
+
+// Recorder wraps a response to remember its status code, its size and whether
+// its headers were sent
+type Recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+// NewRecorder wraps w in a Recorder
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Status returns the status code written, or 200 when none was written yet
+func (r *Recorder) Status() int {
+	return r.status
+}
+
+// Bytes returns the number of body bytes written
+func (r *Recorder) Bytes() int {
+	return r.bytes
+}
+
+// WroteHeader reports whether the headers were sent, after which the status
+// can't change
+func (r *Recorder) WroteHeader() bool {
+	return r.wroteHeader
+}
+
+// WriteHeader records the status code before writing it
+func (r *Recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes written; the first write sends the headers
+func (r *Recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder; flushing sends the
+// headers
+func (r *Recorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		r.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped response for http.ResponseController
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
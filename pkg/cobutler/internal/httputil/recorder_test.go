@@ -0,0 +1,35 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder(httptest.NewRecorder())
+	if rec.Status() != http.StatusOK || rec.WroteHeader() {
+		t.Fatalf("Expected an unwritten 200, got %d (wrote header %v)", rec.Status(), rec.WroteHeader())
+	}
+
+	rec.WriteHeader(http.StatusTeapot)
+	rec.Write([]byte("short and stout"))
+	// Later status codes are ignored by the server and not recorded
+	rec.WriteHeader(http.StatusInternalServerError)
+
+	if rec.Status() != http.StatusTeapot || rec.Bytes() != 15 || !rec.WroteHeader() {
+		t.Errorf("Expected 418 with 15 bytes, got %d with %d bytes", rec.Status(), rec.Bytes())
+	}
+
+	// Writing or flushing a body sends the headers too
+	for name, write := range map[string]func(*Recorder){
+		"write": func(r *Recorder) { r.Write([]byte("body")) },
+		"flush": func(r *Recorder) { r.Flush() },
+	} {
+		rec := NewRecorder(httptest.NewRecorder())
+		write(rec)
+		if !rec.WroteHeader() || rec.Status() != http.StatusOK {
+			t.Errorf("Expected %s to send a 200, got %d (wrote header %v)", name, rec.Status(), rec.WroteHeader())
+		}
+	}
+}
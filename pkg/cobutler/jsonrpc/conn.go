@@ -0,0 +1,143 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Standard JSON-RPC 2.0 error codes, the LSP request cancelled code and the
+// server error codes used for authentication and rate limits
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeRequestCancelled = -32800
+	CodeUnauthorized     = -32001
+	CodeForbidden        = -32002
+	CodeRateLimited      = -32003
+)
+
+// Request is an incoming JSON-RPC request or notification
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// IsNotification reports whether the request expects no response
+func (r *Request) IsNotification() bool {
+	return len(r.ID) == 0
+}
+
+// Error is a JSON-RPC error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// NewError creates a new Error with the given code and message
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Conn reads and writes JSON-RPC messages framed with Content-Length headers,
+// the same framing used by the Language Server Protocol
+type Conn struct {
+	reader *bufio.Reader
+	writer io.Writer
+	mu     sync.Mutex
+}
+
+// NewConn creates a new Conn reading from r and writing to w
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{
+		reader: bufio.NewReader(r),
+		writer: w,
+	}
+}
+
+// Read reads the next request from the connection
+func (c *Conn) Read() (*Request, error) {
+	headers, err := textproto.NewReader(c.reader).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length header: %q", headers.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return nil, fmt.Errorf("failed to read message body: %w", err)
+	}
+
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, NewError(CodeParseError, err.Error())
+	}
+
+	return &req, nil
+}
+
+// Reply sends a successful response for the request with the given ID
+func (c *Conn) Reply(id json.RawMessage, result interface{}) error {
+	return c.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	})
+}
+
+// ReplyError sends an error response for the request with the given ID
+func (c *Conn) ReplyError(id json.RawMessage, rpcErr *Error) error {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return c.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   rpcErr,
+	})
+}
+
+// Notify sends a notification to the other side
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+// write encodes and sends a single framed message
+func (c *Conn) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.writer.Write(body)
+	return err
+}
@@ -0,0 +1,130 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// frame wraps body in a Content-Length header
+func frame(body string) string {
+	return "Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+}
+
+func TestConnRead(t *testing.T) {
+	first := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"a":1}}`
+	second := `{"jsonrpc":"2.0","method":"initialized"}`
+	input := frame(first) + "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n" + frame(second)
+
+	// Messages split across reads of one byte still come out whole
+	conn := NewConn(iotest.OneByteReader(strings.NewReader(input)), io.Discard)
+
+	req, err := conn.Read()
+	if err != nil {
+		t.Fatalf("Failed to read the first message: %v", err)
+	}
+	if req.Method != "initialize" || string(req.ID) != "1" || string(req.Params) != `{"a":1}` || req.IsNotification() {
+		t.Errorf("Expected request 1 to initialize, got %+v", req)
+	}
+
+	req, err = conn.Read()
+	if err != nil {
+		t.Fatalf("Failed to read the second message: %v", err)
+	}
+	if req.Method != "initialized" || !req.IsNotification() {
+		t.Errorf("Expected an initialized notification, got %+v", req)
+	}
+
+	if _, err := conn.Read(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected EOF after the last message, got %v", err)
+	}
+}
+
+func TestConnReadErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		parseErr  bool
+		wantError string
+	}{
+		{
+			name:      "missing length",
+			input:     "Content-Type: application/json\r\n\r\n{}",
+			wantError: "invalid Content-Length",
+		},
+		{
+			name:      "non-numeric length",
+			input:     "Content-Length: ten\r\n\r\n{}",
+			wantError: "invalid Content-Length",
+		},
+		{
+			name:      "negative length",
+			input:     "Content-Length: -1\r\n\r\n{}",
+			wantError: "invalid Content-Length",
+		},
+		{
+			name:      "malformed header",
+			input:     "not a header\r\n\r\n{}",
+			wantError: "malformed MIME header",
+		},
+		{
+			name:      "truncated body",
+			input:     "Content-Length: 10\r\n\r\n{}",
+			wantError: "failed to read message body",
+		},
+		{
+			name:     "invalid json",
+			input:    frame("{not json"),
+			parseErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewConn(strings.NewReader(tt.input), io.Discard).Read()
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+
+			var rpcErr *Error
+			if tt.parseErr {
+				if !errors.As(err, &rpcErr) || rpcErr.Code != CodeParseError {
+					t.Errorf("Expected a parse error, got %v", err)
+				}
+				return
+			}
+			if errors.As(err, &rpcErr) {
+				t.Errorf("Expected a framing error rather than a JSON-RPC error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestConnWrite(t *testing.T) {
+	var out bytes.Buffer
+	conn := NewConn(strings.NewReader(""), &out)
+
+	if err := conn.Reply([]byte("1"), map[string]int{"n": 1}); err != nil {
+		t.Fatalf("Reply failed: %v", err)
+	}
+	if err := conn.ReplyError(nil, NewError(CodeInvalidRequest, "bad")); err != nil {
+		t.Fatalf("ReplyError failed: %v", err)
+	}
+	if err := conn.Notify("window/logMessage", map[string]string{"message": "hi"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	want := frame(`{"id":1,"jsonrpc":"2.0","result":{"n":1}}`) +
+		frame(`{"error":{"code":-32600,"message":"bad"},"id":null,"jsonrpc":"2.0"}`) +
+		frame(`{"jsonrpc":"2.0","method":"window/logMessage","params":{"message":"hi"}}`)
+	if out.String() != want {
+		t.Errorf("Expected framed messages\n%q\ngot\n%q", want, out.String())
+	}
+}
@@ -0,0 +1,132 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// contextLines is how many lines before the cursor are sent to the brain,
+// matching the context window used by the editor plugin
+const contextLines = 15
+
+// document is an open text document tracked by the server
+type document struct {
+	uri        string
+	languageID string
+	version    int
+	text       string
+	// learnedText is the text learned from so far, used to learn only what changed
+	learnedText string
+}
+
+// offset converts an LSP position to a byte offset in the document
+func (d *document) offset(pos Position) (int, error) {
+	if pos.Line < 0 || pos.Character < 0 {
+		return 0, fmt.Errorf("invalid position %d:%d", pos.Line, pos.Character)
+	}
+
+	// Find the start of the line
+	start := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(d.text[start:], '\n')
+		if next < 0 {
+			return 0, fmt.Errorf("line %d out of range", pos.Line)
+		}
+		start += next + 1
+	}
+
+	// Walk the line counting UTF-16 code units
+	offset := start
+	units := 0
+	for units < pos.Character && offset < len(d.text) {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+
+	return offset, nil
+}
+
+// applyChange applies a full or incremental content change
+func (d *document) applyChange(change TextDocumentContentChangeEvent) error {
+	if change.Range == nil {
+		d.text = change.Text
+		return nil
+	}
+
+	start, err := d.offset(change.Range.Start)
+	if err != nil {
+		return err
+	}
+	end, err := d.offset(change.Range.End)
+	if err != nil {
+		return err
+	}
+	if end < start {
+		return fmt.Errorf("invalid range: end before start")
+	}
+
+	d.text = d.text[:start] + change.Text + d.text[end:]
+	return nil
+}
+
+// contextBefore returns the trailing lines of the document up to the position
+func (d *document) contextBefore(pos Position) (string, error) {
+	offset, err := d.offset(pos)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(d.text[:offset], "\n")
+	if len(lines) > contextLines+1 {
+		lines = lines[len(lines)-contextLines-1:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// learnLines returns the lines added since the document was last learned from
+// and marks them as learned. The line at activeLine is still being typed, so it
+// is left to be learned once finished; -1 learns every line.
+func (d *document) learnLines(activeLine int) []string {
+	text := d.text
+	if activeLine >= 0 {
+		lines := strings.Split(text, "\n")
+		if activeLine < len(lines) {
+			lines = append(lines[:activeLine:activeLine], lines[activeLine+1:]...)
+		}
+		text = strings.Join(lines, "\n")
+	}
+
+	added := d.addedLines(text)
+	d.learnedText = text
+	return added
+}
+
+// addedLines returns the non-blank lines of text that were not present when the
+// document was last learned from
+func (d *document) addedLines(text string) []string {
+	seen := make(map[string]int)
+	for _, line := range strings.Split(d.learnedText, "\n") {
+		seen[strings.TrimSpace(line)]++
+	}
+
+	var added []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if seen[trimmed] > 0 {
+			seen[trimmed]--
+			continue
+		}
+		added = append(added, trimmed)
+	}
+
+	return added
+}
@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDocumentApplyChange(t *testing.T) {
+	doc := &document{text: "local å = 1\nprint(x)\n"}
+
+	// Replace "x" on the second line
+	err := doc.applyChange(TextDocumentContentChangeEvent{
+		Range: &Range{Start: Position{Line: 1, Character: 6}, End: Position{Line: 1, Character: 7}},
+		Text:  "å",
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply change: %v", err)
+	}
+
+	// Characters are counted in UTF-16 code units, so "å" is one character
+	err = doc.applyChange(TextDocumentContentChangeEvent{
+		Range: &Range{Start: Position{Line: 0, Character: 10}, End: Position{Line: 0, Character: 11}},
+		Text:  "2",
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply change: %v", err)
+	}
+
+	expected := "local å = 2\nprint(å)\n"
+	if doc.text != expected {
+		t.Errorf("Expected text %q, got %q", expected, doc.text)
+	}
+
+	// Lines past the end of the document are rejected
+	err = doc.applyChange(TextDocumentContentChangeEvent{
+		Range: &Range{Start: Position{Line: 5}, End: Position{Line: 5}},
+		Text:  "x",
+	})
+	if err == nil {
+		t.Error("Expected error for out of range change")
+	}
+}
+
+func TestDocumentAddedLines(t *testing.T) {
+	doc := &document{
+		learnedText: "a := 1\nb := 2\n",
+		text:        "a := 1\n\nb := 2\nc := a + b\nb := 2\n",
+	}
+
+	expected := []string{"c := a + b", "b := 2"}
+	if added := doc.addedLines(doc.text); !reflect.DeepEqual(added, expected) {
+		t.Errorf("Expected added lines %q, got %q", expected, added)
+	}
+}
+
+func TestDocumentLearnLines(t *testing.T) {
+	doc := &document{learnedText: "a := 1\n", text: "a := 1\nb := 2\nc :"}
+
+	// The line being typed waits until it is finished
+	if added := doc.learnLines(2); !reflect.DeepEqual(added, []string{"b := 2"}) {
+		t.Errorf("Expected to learn %q, got %q", []string{"b := 2"}, added)
+	}
+
+	doc.text = "a := 1\nb := 2\nc := 3\n"
+	if added := doc.learnLines(3); !reflect.DeepEqual(added, []string{"c := 3"}) {
+		t.Errorf("Expected to learn %q, got %q", []string{"c := 3"}, added)
+	}
+	if added := doc.learnLines(-1); len(added) != 0 {
+		t.Errorf("Expected nothing left to learn, got %q", added)
+	}
+}
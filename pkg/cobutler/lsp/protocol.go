@@ -0,0 +1,160 @@
+package lsp
+
+import "encoding/json"
+
+// This file contains the subset of Language Server Protocol types used by the server
+
+// Position is a zero-based line and UTF-16 character offset in a document
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span between two positions in a document
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// TextDocumentIdentifier identifies a document by URI
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// VersionedTextDocumentIdentifier identifies a version of a document by URI
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+// TextDocumentItem is a document sent with textDocument/didOpen
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+// DidOpenTextDocumentParams are the parameters of textDocument/didOpen
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// TextDocumentContentChangeEvent is a full or incremental document change.
+// A nil Range replaces the whole document.
+type TextDocumentContentChangeEvent struct {
+	Range *Range `json:"range,omitempty"`
+	Text  string `json:"text"`
+}
+
+// DidChangeTextDocumentParams are the parameters of textDocument/didChange
+type DidChangeTextDocumentParams struct {
+	TextDocument   VersionedTextDocumentIdentifier  `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+// DidSaveTextDocumentParams are the parameters of textDocument/didSave
+type DidSaveTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Text         *string                `json:"text,omitempty"`
+}
+
+// DidCloseTextDocumentParams are the parameters of textDocument/didClose
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// TextDocumentPositionParams identify a position in a document
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// CancelParams are the parameters of $/cancelRequest
+type CancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// Completion item kinds
+const (
+	CompletionItemKindText    = 1
+	CompletionItemKindSnippet = 15
+)
+
+// InsertTextFormatSnippet marks insert text that uses snippet syntax
+const InsertTextFormatSnippet = 2
+
+// CompletionItem is a single entry in a completion list
+type CompletionItem struct {
+	Label            string    `json:"label"`
+	Kind             int       `json:"kind,omitempty"`
+	Detail           string    `json:"detail,omitempty"`
+	FilterText       string    `json:"filterText,omitempty"`
+	InsertText       string    `json:"insertText,omitempty"`
+	InsertTextFormat int       `json:"insertTextFormat,omitempty"`
+	TextEdit         *TextEdit `json:"textEdit,omitempty"`
+}
+
+// TextEdit replaces a range of a document with new text
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// CompletionList is the result of textDocument/completion
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+// InlineCompletionItem is a single ghost text suggestion
+type InlineCompletionItem struct {
+	InsertText string `json:"insertText"`
+	Range      *Range `json:"range,omitempty"`
+}
+
+// InlineCompletionList is the result of textDocument/inlineCompletion
+type InlineCompletionList struct {
+	Items []InlineCompletionItem `json:"items"`
+}
+
+// Text document sync kinds
+const (
+	TextDocumentSyncFull        = 1
+	TextDocumentSyncIncremental = 2
+)
+
+// ServerCapabilities advertises what the server supports
+type ServerCapabilities struct {
+	TextDocumentSync         TextDocumentSyncOptions `json:"textDocumentSync"`
+	CompletionProvider       *CompletionOptions      `json:"completionProvider,omitempty"`
+	InlineCompletionProvider bool                    `json:"inlineCompletionProvider,omitempty"`
+}
+
+// TextDocumentSyncOptions describe how documents are synchronized
+type TextDocumentSyncOptions struct {
+	OpenClose bool        `json:"openClose"`
+	Change    int         `json:"change"`
+	Save      SaveOptions `json:"save"`
+}
+
+// SaveOptions describe save notifications
+type SaveOptions struct {
+	IncludeText bool `json:"includeText"`
+}
+
+// CompletionOptions describe completion support
+type CompletionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+}
+
+// ServerInfo identifies the server
+type ServerInfo struct {
+	Name string `json:"name"`
+}
+
+// InitializeResult is the result of initialize
+type InitializeResult struct {
+	Capabilities ServerCapabilities `json:"capabilities"`
+	ServerInfo   ServerInfo         `json:"serverInfo"`
+}
@@ -0,0 +1,403 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/jsonrpc"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/models"
+)
+
+// lspClient is the client the language server's learning counts as in rate
+// limits; it serves a single editor
+const lspClient = "lsp"
+
+// Server is a Language Server Protocol frontend that serves completions from a brain
+type Server struct {
+	handler *api.Handler
+	conn    *jsonrpc.Conn
+	// limits are the learn rate limits, if any
+	limits *api.RateLimiter
+
+	mu       sync.Mutex
+	docs     map[string]*document
+	pending  map[string]context.CancelFunc
+	shutdown bool
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a new LSP server backed by the given handler
+func NewServer(handler *api.Handler) *Server {
+	return &Server{
+		handler: handler,
+		docs:    make(map[string]*document),
+		pending: make(map[string]context.CancelFunc),
+	}
+}
+
+// RateLimit applies the learn rate limits and quota of limits to the lines
+// learned from documents. It must be called before Serve.
+func (s *Server) RateLimit(limits *api.RateLimiter) {
+	s.limits = limits
+}
+
+// Serve speaks LSP over r and w until the client sends exit or closes the stream
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = jsonrpc.NewConn(r, w)
+	defer s.wg.Wait()
+
+	for {
+		req, err := s.conn.Read()
+		if err != nil {
+			var rpcErr *jsonrpc.Error
+			if errors.As(err, &rpcErr) {
+				s.conn.ReplyError(nil, rpcErr)
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+
+		if req.Method == "exit" {
+			s.cancelAll()
+			return nil
+		}
+		s.dispatch(req)
+	}
+}
+
+// dispatch handles a single request or notification. Document notifications are
+// applied in order; completions run in the background so they can be cancelled.
+func (s *Server) dispatch(req *jsonrpc.Request) {
+	var result interface{}
+	var err error
+
+	s.mu.Lock()
+	shutdown := s.shutdown
+	s.mu.Unlock()
+	if shutdown && !req.IsNotification() {
+		s.respond(req.ID, nil, jsonrpc.NewError(jsonrpc.CodeInvalidRequest, "server is shutting down"))
+		return
+	}
+
+	switch req.Method {
+	case "initialize":
+		result = InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync: TextDocumentSyncOptions{
+					OpenClose: true,
+					Change:    TextDocumentSyncIncremental,
+					Save:      SaveOptions{IncludeText: false},
+				},
+				CompletionProvider:       &CompletionOptions{},
+				InlineCompletionProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "cobutler"},
+		}
+	case "initialized":
+	case "shutdown":
+		s.mu.Lock()
+		s.shutdown = true
+		s.mu.Unlock()
+		s.cancelAll()
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			s.didOpen(params)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			err = s.didChange(params)
+		}
+	case "textDocument/didSave":
+		var params DidSaveTextDocumentParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			err = s.didSave(params)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			s.mu.Lock()
+			delete(s.docs, params.TextDocument.URI)
+			s.mu.Unlock()
+		}
+	case "textDocument/completion", "textDocument/inlineCompletion":
+		var params TextDocumentPositionParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			s.complete(req, params)
+			return
+		}
+	case "$/cancelRequest":
+		var params CancelParams
+		if err = decodeParams(req.Params, &params); err == nil {
+			s.cancel(string(params.ID))
+		}
+	default:
+		if strings.HasPrefix(req.Method, "$/") {
+			// Optional protocol notifications can be ignored
+			return
+		}
+		err = jsonrpc.NewError(jsonrpc.CodeMethodNotFound, fmt.Sprintf("method not found: %s", req.Method))
+	}
+
+	if req.IsNotification() {
+		if err != nil {
+			slog.Warn("LSP notification failed", "method", req.Method, "error", err)
+		}
+		return
+	}
+	s.respond(req.ID, result, err)
+}
+
+// respond sends a result or converts err into a JSON-RPC error
+func (s *Server) respond(id json.RawMessage, result interface{}, err error) {
+	if err == nil {
+		s.conn.Reply(id, result)
+		return
+	}
+
+	var rpcErr *jsonrpc.Error
+	if !errors.As(err, &rpcErr) {
+		rpcErr = jsonrpc.NewError(jsonrpc.CodeInternalError, err.Error())
+	}
+	s.conn.ReplyError(id, rpcErr)
+}
+
+// didOpen starts tracking a document
+func (s *Server) didOpen(params DidOpenTextDocumentParams) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := params.TextDocument
+	s.docs[item.URI] = &document{
+		uri:         item.URI,
+		languageID:  item.LanguageID,
+		version:     item.Version,
+		text:        item.Text,
+		learnedText: item.Text,
+	}
+}
+
+// didChange applies content changes to a tracked document and learns the lines
+// they finished. The line the last change ends on is still being typed; after a
+// full document change it isn't known, so learning waits for the next save.
+func (s *Server) didChange(params DidChangeTextDocumentParams) error {
+	s.mu.Lock()
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("document not open: %s", params.TextDocument.URI)
+	}
+
+	activeLine := -1
+	for _, change := range params.ContentChanges {
+		if err := doc.applyChange(change); err != nil {
+			s.mu.Unlock()
+			return jsonrpc.NewError(jsonrpc.CodeInvalidParams, err.Error())
+		}
+		activeLine = -1
+		if change.Range != nil {
+			activeLine = change.Range.Start.Line + strings.Count(change.Text, "\n")
+		}
+	}
+	doc.version = params.TextDocument.Version
+
+	var added []string
+	if activeLine >= 0 {
+		added = doc.learnLines(activeLine)
+	}
+	s.mu.Unlock()
+
+	return s.learn(params.TextDocument.URI, added)
+}
+
+// didSave learns from the lines added since the document was last learned from
+func (s *Server) didSave(params DidSaveTextDocumentParams) error {
+	s.mu.Lock()
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("document not open: %s", params.TextDocument.URI)
+	}
+	if params.Text != nil {
+		doc.text = *params.Text
+	}
+	added := doc.learnLines(-1)
+	s.mu.Unlock()
+
+	return s.learn(params.TextDocument.URI, added)
+}
+
+// learn trains the brain with lines added to the document at uri. They are
+// learned as one text, like a /learn request, so the learn queue takes them in
+// a single write rather than the read loop waiting on one per line.
+func (s *Server) learn(uri string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	text := strings.Join(lines, "\n")
+	if s.limits != nil {
+		if retryAfter, ok := s.limits.Allow(lspClient, api.ScopeLearn, int64(len(text))); !ok {
+			metrics.RateLimited.WithLabelValues(api.ScopeLearn).Inc()
+			return fmt.Errorf("not learning from %s: rate limited, retry after %s", uri, retryAfter.Round(time.Second))
+		}
+	}
+
+	queued, err := s.handler.LearnText(context.Background(), text, "")
+	if err != nil {
+		return fmt.Errorf("failed to learn from %s: %w", uri, err)
+	}
+
+	slog.Info("Learned from document", "uri", uri, "lines", len(lines), "queued", queued)
+	return nil
+}
+
+// complete generates a completion in the background for the given position
+func (s *Server) complete(req *jsonrpc.Request, params TextDocumentPositionParams) {
+	s.mu.Lock()
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		s.mu.Unlock()
+		s.respond(req.ID, nil, fmt.Errorf("document not open: %s", params.TextDocument.URI))
+		return
+	}
+	filetype := doc.languageID
+	text, err := doc.contextBefore(params.Position)
+	if err != nil {
+		s.mu.Unlock()
+		s.respond(req.ID, nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	key := string(req.ID)
+	s.pending[key] = cancel
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.cancel(key)
+
+		if snippet, ok := s.handler.FindSnippet(text, filetype); ok {
+			s.respondSnippet(req, params, snippet)
+			return
+		}
+
+		completion, err := s.handler.GenerateReply(ctx, filetype, strings.TrimSpace(text), api.RequestPayload{Mode: api.ModeContinue})
+		if errors.Is(err, context.Canceled) {
+			s.respond(req.ID, nil, jsonrpc.NewError(jsonrpc.CodeRequestCancelled, "request cancelled"))
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to generate completion", "error", err)
+			s.respond(req.ID, nil, err)
+			return
+		}
+		reply := completion.Reply
+
+		if req.Method == "textDocument/inlineCompletion" {
+			var items []InlineCompletionItem
+			if reply != "" {
+				items = append(items, InlineCompletionItem{
+					InsertText: reply,
+					Range:      &Range{Start: params.Position, End: params.Position},
+				})
+			}
+			s.respond(req.ID, InlineCompletionList{Items: items}, nil)
+			return
+		}
+
+		items := []CompletionItem{}
+		if reply != "" {
+			label, _, _ := strings.Cut(reply, "\n")
+			items = append(items, CompletionItem{
+				Label:      label,
+				Kind:       CompletionItemKindText,
+				Detail:     "cobutler",
+				InsertText: reply,
+			})
+		}
+		// Replies are random walks, so ask the client to query again on every keystroke
+		s.respond(req.ID, CompletionList{IsIncomplete: true, Items: items}, nil)
+	}()
+}
+
+// respondSnippet answers a completion request with a code template. Inline
+// completions get the plain text since ghost text can't hold tab stops.
+func (s *Server) respondSnippet(req *jsonrpc.Request, params TextDocumentPositionParams, snippet models.Snippet) {
+	// Templates that don't start with their trigger replace it along with any
+	// spaces typed after it, all on the cursor line
+	replaced := Range{Start: params.Position, End: params.Position}
+	if snippet.Replace > 0 {
+		spaces := snippet.Replace - len(snippet.Trigger)
+		replaced.Start.Character -= len(utf16.Encode([]rune(snippet.Trigger))) + spaces
+		// The context may hold less of the line than the template replaces
+		replaced.Start.Character = max(replaced.Start.Character, 0)
+	}
+
+	if req.Method == "textDocument/inlineCompletion" {
+		s.respond(req.ID, InlineCompletionList{Items: []InlineCompletionItem{{
+			InsertText: snippet.Text,
+			Range:      &replaced,
+		}}}, nil)
+		return
+	}
+
+	label, _, _ := strings.Cut(strings.TrimSpace(snippet.Text), "\n")
+	s.respond(req.ID, CompletionList{Items: []CompletionItem{{
+		Label:            label,
+		Kind:             CompletionItemKindSnippet,
+		Detail:           "cobutler " + snippet.Name + " template",
+		FilterText:       snippet.Trigger,
+		InsertTextFormat: InsertTextFormatSnippet,
+		TextEdit:         &TextEdit{Range: replaced, NewText: snippet.Body},
+	}}}, nil)
+}
+
+// cancel cancels the pending request with the given ID
+func (s *Server) cancel(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cancel, ok := s.pending[key]; ok {
+		cancel()
+		delete(s.pending, key)
+	}
+}
+
+// cancelAll cancels every pending request
+func (s *Server) cancelAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, cancel := range s.pending {
+		cancel()
+		delete(s.pending, key)
+	}
+}
+
+// decodeParams unmarshals request parameters, reporting invalid params on failure
+func decodeParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return jsonrpc.NewError(jsonrpc.CodeInvalidParams, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+)
+
+// learningBrain replies with a fixed completion and records what it learns
+type learningBrain struct {
+	mu      sync.Mutex
+	learned []string
+}
+
+func (b *learningBrain) Reply(text string) (string, error) {
+	return "world", nil
+}
+
+func (b *learningBrain) Learn(text string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.learned = append(b.learned, text)
+	return nil
+}
+
+func (b *learningBrain) RememberCompletion(context, completion string) {}
+
+func (b *learningBrain) EnableCache() {}
+
+func (b *learningBrain) DisableCache() {}
+
+func (b *learningBrain) Close() error {
+	return nil
+}
+
+func (b *learningBrain) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.learned...)
+}
+
+// testClient speaks LSP to a server over pipes
+type testClient struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	nextID int
+}
+
+// response is a JSON-RPC response read by the test client
+type response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *testClient) send(msg map[string]interface{}) {
+	c.t.Helper()
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatalf("Failed to encode message: %v", err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatalf("Failed to send message: %v", err)
+	}
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.send(map[string]interface{}{"method": method, "params": params})
+}
+
+// call sends a request and returns its response
+func (c *testClient) call(method string, params interface{}) response {
+	c.t.Helper()
+	c.nextID++
+	c.send(map[string]interface{}{"id": c.nextID, "method": method, "params": params})
+
+	headers, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("Failed to read response headers: %v", err)
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("Invalid Content-Length %q", headers.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		c.t.Fatalf("Failed to read response body: %v", err)
+	}
+
+	var resp response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		c.t.Fatalf("Failed to decode response %s: %v", body, err)
+	}
+	if resp.ID != c.nextID {
+		c.t.Fatalf("Expected response to request %d, got %d", c.nextID, resp.ID)
+	}
+	return resp
+}
+
+func TestServerSession(t *testing.T) {
+	brain := &learningBrain{}
+	server := NewServer(&api.Handler{Brain: brain})
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(serverR, serverW)
+		serverW.Close()
+	}()
+	client := &testClient{t: t, w: clientW, r: bufio.NewReader(clientR)}
+
+	resp := client.call("initialize", map[string]interface{}{})
+	if resp.Error != nil {
+		t.Fatalf("Failed to initialize: %s", resp.Error.Message)
+	}
+	var init InitializeResult
+	if err := json.Unmarshal(resp.Result, &init); err != nil {
+		t.Fatalf("Failed to decode initialize result: %v", err)
+	}
+	if init.ServerInfo.Name == "" {
+		t.Error("Expected server info in initialize result")
+	}
+	client.notify("initialized", map[string]interface{}{})
+
+	uri := "file:///notes.txt"
+	client.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "plaintext", "version": 1, "text": "first line\n"},
+	})
+
+	// Typing a second line and starting a third finishes the second
+	client.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]interface{}{{
+			"range": map[string]interface{}{
+				"start": map[string]interface{}{"line": 1, "character": 0},
+				"end":   map[string]interface{}{"line": 1, "character": 0},
+			},
+			"text": "second line\nhello",
+		}},
+	})
+
+	resp = client.call("textDocument/completion", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": 2, "character": 5},
+	})
+	if resp.Error != nil {
+		t.Fatalf("Failed to complete: %s", resp.Error.Message)
+	}
+	var list CompletionList
+	if err := json.Unmarshal(resp.Result, &list); err != nil {
+		t.Fatalf("Failed to decode completion list: %v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].InsertText == "" {
+		t.Errorf("Expected one completion, got %+v", list.Items)
+	}
+
+	// Notifications are handled in order, so the change was applied before the completion
+	if learned := brain.lines(); len(learned) != 1 || learned[0] != "second line" {
+		t.Errorf("Expected the finished line to be learned, got %q", learned)
+	}
+	server.mu.Lock()
+	version := server.docs[uri].version
+	server.mu.Unlock()
+	if version != 2 {
+		t.Errorf("Expected document version 2, got %d", version)
+	}
+
+	if resp := client.call("shutdown", nil); resp.Error != nil {
+		t.Fatalf("Failed to shut down: %s", resp.Error.Message)
+	}
+	resp = client.call("textDocument/completion", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": 2, "character": 5},
+	})
+	if resp.Error == nil {
+		t.Error("Expected requests after shutdown to fail")
+	}
+
+	client.notify("exit", nil)
+	if err := <-served; err != nil {
+		t.Errorf("Expected Serve to return nil on exit, got %v", err)
+	}
+}
+
+func TestServerLearnQueued(t *testing.T) {
+	brain := &learningBrain{}
+	queue := api.NewLearnQueue(brain, api.LearnQueueConfig{})
+	server := NewServer(&api.Handler{Brain: brain, Queue: queue})
+
+	uri := "file:///notes.txt"
+	server.didOpen(DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: "first line\n"}})
+
+	text := "first line\nsecond line\nthird line\n"
+	if err := server.didSave(DidSaveTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}, Text: &text}); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if err := queue.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close the learn queue: %v", err)
+	}
+
+	// The saved lines go through the queue as one text
+	if learned := brain.lines(); len(learned) != 1 || learned[0] != "second line\nthird line" {
+		t.Errorf("Expected the added lines to be learned as one text, got %q", learned)
+	}
+}
+
+func TestServerLearnRateLimited(t *testing.T) {
+	brain := &learningBrain{}
+	server := NewServer(&api.Handler{Brain: brain})
+	server.RateLimit(api.NewRateLimiter(api.RateLimitConfig{LearnBytesPerDay: 5}))
+
+	uri := "file:///notes.txt"
+	server.didOpen(DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri}})
+
+	text := "more than five bytes\n"
+	if err := server.didSave(DidSaveTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}, Text: &text}); err == nil {
+		t.Error("Expected learning over the quota to fail")
+	}
+	if learned := brain.lines(); len(learned) != 0 {
+		t.Errorf("Expected nothing to be learned over the quota, got %q", learned)
+	}
+}
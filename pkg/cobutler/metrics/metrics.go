@@ -0,0 +1,296 @@
+// Package metrics exposes server and brain internals in the Prometheus
+// exposition format. Collectors are package level so the database, API and brain
+// can record to them without passing a registry around.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/internal/httputil"
+)
+
+// Registry holds all cobutler metrics along with the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RequestDuration observes the latency of HTTP requests per endpoint
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cobutler_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by endpoint, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "method", "code"})
+
+	// ReplyLength observes the number of words in generated replies
+	ReplyLength = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cobutler_reply_length_words",
+		Help:    "Number of words in generated replies.",
+		Buckets: []float64{0, 1, 2, 3, 5, 8, 13, 21, 34, 55},
+	})
+
+	// Candidates counts the candidate replies generated before one is returned
+	Candidates = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cobutler_reply_candidates_total",
+		Help: "Candidate replies generated.",
+	})
+
+	// WalkDepth observes the number of edges taken by walks over the graph
+	WalkDepth = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cobutler_walk_depth_edges",
+		Help:    "Number of edges taken by walks over the graph.",
+		Buckets: []float64{0, 1, 2, 3, 5, 8, 10, 15, 20},
+	})
+
+	// DeadEnds counts walks that stopped at a node without usable edges
+	DeadEnds = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cobutler_walk_dead_ends_total",
+		Help: "Walks that stopped at a node without usable edges.",
+	})
+
+	// QueryDuration observes the latency of SQLite queries per Graph method
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cobutler_sqlite_query_duration_seconds",
+		Help:    "Latency of SQLite queries by Graph method.",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"method"})
+
+	// RateLimited counts requests rejected by rate limits or quotas per scope
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cobutler_rate_limited_requests_total",
+		Help: "Requests rejected by rate limits or quotas by scope.",
+	}, []string{"scope"})
+
+	// LearnQueueDepth is the number of texts waiting to be learned per namespace,
+	// which is empty for the default brain
+	LearnQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cobutler_learn_queue_depth",
+		Help: "Texts waiting in the learn queue.",
+	}, []string{"namespace"})
+
+	// LearnBatchSize observes the number of texts learned per batch
+	LearnBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cobutler_learn_batch_size_texts",
+		Help:    "Number of texts learned per batch.",
+		Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128},
+	})
+
+	// Checkpoints counts WAL checkpoints by result: "ok", "busy" when readers or
+	// an open write kept it from finishing, or "error"
+	Checkpoints = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cobutler_wal_checkpoints_total",
+		Help: "WAL checkpoints by result.",
+	}, []string{"result"})
+
+	// Feedback counts feedback on completions by outcome: "accepted", "rejected"
+	// or "partial"
+	Feedback = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cobutler_feedback_total",
+		Help: "Feedback on completions by outcome.",
+	}, []string{"outcome"})
+
+	// FeedbackAcceptanceRate is the share of completions with feedback that were
+	// accepted in full or in part
+	FeedbackAcceptanceRate = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cobutler_feedback_acceptance_rate",
+		Help: "Share of completions with feedback that were accepted in full or in part.",
+	}, feedbackCounts.rate)
+
+	// CacheLookups counts cache lookups by cache and result, "hit" or "miss"
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cobutler_cache_lookups_total",
+		Help: "Cache lookups by cache and result.",
+	}, []string{"cache", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestDuration,
+		ReplyLength,
+		Candidates,
+		WalkDepth,
+		DeadEnds,
+		QueryDuration,
+		CacheLookups,
+		RateLimited,
+		LearnQueueDepth,
+		LearnBatchSize,
+		Checkpoints,
+		Feedback,
+		FeedbackAcceptanceRate,
+		brainSize,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveQuery records the latency of a Graph method started at start. It is
+// meant to be deferred at the top of the method.
+func ObserveQuery(method string, start time.Time) {
+	QueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCache records a cache lookup
+func ObserveCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// feedbackCounts counts feedback for FeedbackAcceptanceRate across all brains
+var feedbackCounts feedbackCounter
+
+// feedbackCounter counts how many completions with feedback were accepted
+type feedbackCounter struct {
+	mu       sync.Mutex
+	accepted int64
+	total    int64
+}
+
+// rate returns the share of accepted completions, or 0 before any feedback
+func (c *feedbackCounter) rate() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.total == 0 {
+		return 0
+	}
+	return float64(c.accepted) / float64(c.total)
+}
+
+// ObserveFeedback records feedback on a completion with the given outcome.
+// Partial acceptances count as accepted for the acceptance rate.
+func ObserveFeedback(outcome string, accepted bool) {
+	Feedback.WithLabelValues(outcome).Inc()
+
+	feedbackCounts.mu.Lock()
+	defer feedbackCounts.mu.Unlock()
+	feedbackCounts.total++
+	if accepted {
+		feedbackCounts.accepted++
+	}
+}
+
+// Instrument wraps an HTTP handler to record its latency under endpoint
+func Instrument(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httputil.NewRecorder(w)
+		next(recorder, r)
+		RequestDuration.WithLabelValues(endpoint, r.Method, strconv.Itoa(recorder.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// BrainSize is the number of tokens, nodes and edges in a brain
+type BrainSize struct {
+	Tokens int64
+	Nodes  int64
+	Edges  int64
+}
+
+// BrainSizeTTL is how long a brain size read for a scrape is reused
+const BrainSizeTTL = 30 * time.Second
+
+// brainSizeCollector reports the brain size gauges of each namespace, read when
+// metrics are scraped and cached for BrainSizeTTL
+type brainSizeCollector struct {
+	mu      sync.Mutex
+	sources map[string]*brainSizeSource
+	now     func() time.Time
+
+	tokens *prometheus.Desc
+	nodes  *prometheus.Desc
+	edges  *prometheus.Desc
+}
+
+// brainSizeSource reads the size of one namespace's brain
+type brainSizeSource struct {
+	size   func() (BrainSize, error)
+	cached BrainSize
+	readAt time.Time
+}
+
+var brainSize = &brainSizeCollector{
+	sources: make(map[string]*brainSizeSource),
+	now:     time.Now,
+	tokens:  prometheus.NewDesc("cobutler_brain_tokens", "Number of tokens in the brain.", []string{"namespace"}, nil),
+	nodes:   prometheus.NewDesc("cobutler_brain_nodes", "Number of nodes in the brain.", []string{"namespace"}, nil),
+	edges:   prometheus.NewDesc("cobutler_brain_edges", "Number of edges in the brain.", []string{"namespace"}, nil),
+}
+
+// SetBrainSize sets the function read for the brain size gauges of namespace,
+// which is empty for the default brain, on every scrape. A nil size stops
+// reporting the namespace.
+func SetBrainSize(namespace string, size func() (BrainSize, error)) {
+	brainSize.mu.Lock()
+	defer brainSize.mu.Unlock()
+	if size == nil {
+		delete(brainSize.sources, namespace)
+		return
+	}
+	brainSize.sources[namespace] = &brainSizeSource{size: size}
+}
+
+// Describe sends the descriptors of the brain size gauges
+func (c *brainSizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.tokens
+	ch <- c.nodes
+	ch <- c.edges
+}
+
+// Collect reports the size of each namespace's brain, reading it again once the
+// cached size is older than BrainSizeTTL. Namespaces are left out until
+// SetBrainSize is called for them or when reading their size fails.
+func (c *brainSizeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	namespaces := make([]string, 0, len(c.sources))
+	for namespace := range c.sources {
+		namespaces = append(namespaces, namespace)
+	}
+	c.mu.Unlock()
+
+	for _, namespace := range namespaces {
+		s, ok := c.read(namespace)
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.GaugeValue, float64(s.Tokens), namespace)
+		ch <- prometheus.MustNewConstMetric(c.nodes, prometheus.GaugeValue, float64(s.Nodes), namespace)
+		ch <- prometheus.MustNewConstMetric(c.edges, prometheus.GaugeValue, float64(s.Edges), namespace)
+	}
+}
+
+// read returns the cached size of namespace's brain, or reads it when the cache
+// is stale. Concurrent scrapes wait for a single read.
+func (c *brainSizeCollector) read(namespace string) (BrainSize, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	source, ok := c.sources[namespace]
+	if !ok {
+		return BrainSize{}, false
+	}
+	now := c.now()
+	if !source.readAt.IsZero() && now.Sub(source.readAt) < BrainSizeTTL {
+		return source.cached, true
+	}
+
+	s, err := source.size()
+	if err != nil {
+		return BrainSize{}, false
+	}
+	source.cached, source.readAt = s, now
+	return s, true
+}
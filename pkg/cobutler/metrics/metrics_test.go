@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrument(t *testing.T) {
+	handler := Instrument("/test", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/test", nil))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := `cobutler_http_request_duration_seconds_count{code="400",endpoint="/test",method="POST"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("Expected metrics to contain %q", want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	SetBrainSize("", func() (BrainSize, error) {
+		return BrainSize{Tokens: 3, Nodes: 4, Edges: 5}, nil
+	})
+	defer SetBrainSize("", nil)
+	SetBrainSize("team", func() (BrainSize, error) {
+		return BrainSize{Tokens: 1, Nodes: 1, Edges: 2}, nil
+	})
+	defer SetBrainSize("team", nil)
+	ObserveQuery("GetTokenByText", time.Now())
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`cobutler_brain_edges{namespace=""} 5`,
+		`cobutler_brain_edges{namespace="team"} 2`,
+		`cobutler_sqlite_query_duration_seconds_count{method="GetTokenByText"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestBrainSizeCached(t *testing.T) {
+	reads := 0
+	SetBrainSize("", func() (BrainSize, error) {
+		reads++
+		return BrainSize{Tokens: int64(reads)}, nil
+	})
+	defer SetBrainSize("", nil)
+
+	now := time.Now()
+	brainSize.now = func() time.Time { return now }
+	defer func() { brainSize.now = time.Now }()
+
+	for i := 0; i < 3; i++ {
+		brainSize.read("")
+	}
+	if reads != 1 {
+		t.Errorf("Expected scrapes within the TTL to share one read, got %d reads", reads)
+	}
+
+	now = now.Add(BrainSizeTTL)
+	if s, _ := brainSize.read(""); reads != 2 || s.Tokens != 2 {
+		t.Errorf("Expected a stale size to be read again, got %d reads and %d tokens", reads, s.Tokens)
+	}
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// Brain learns, replies to and continues text over a cobe brain database. It is
+// what the server and gRPC API serve, and it can take feedback on its replies
+// and report its size and neighbors.
+type Brain struct {
+	*Learner
+	*Replier
+	*Continuer
+	graph *db.Graph
+}
+
+// NewBrain opens the brain database at path with opts. A database that fails
+// its integrity check is reported as db.ErrCorrupt.
+func NewBrain(path string, opts db.GraphOptions) (*Brain, error) {
+	graph, err := db.NewGraph(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizer := NewCobeTokenizer()
+	return &Brain{
+		Learner:   NewLearner(graph, tokenizer),
+		Replier:   NewReplier(graph, tokenizer),
+		Continuer: NewContinuer(graph, tokenizer),
+		graph:     graph,
+	}, nil
+}
+
+// Graph returns the graph the brain is stored in
+func (b *Brain) Graph() *db.Graph {
+	return b.graph
+}
+
+// Reply returns a reply to text, sampled in proportion to how often each edge
+// was learned
+func (b *Brain) Reply(text string) (string, error) {
+	sampling := db.Sampling{Rand: rand.New(rand.NewSource(time.Now().UnixNano())), Temperature: 1}
+	return b.ReplySample(text, sampling)
+}
+
+// RememberCompletion does nothing. Completions are remembered by a
+// CompletionMemory over the brain's Graph.
+func (b *Brain) RememberCompletion(context, completion string) {}
+
+// EnableCache does nothing; the brain reads through SQLite's page cache
+func (b *Brain) EnableCache() {}
+
+// DisableCache does nothing; the brain reads through SQLite's page cache
+func (b *Brain) DisableCache() {}
+
+// Reinforce adds delta to the count of each edge of an accepted or rejected reply
+func (b *Brain) Reinforce(edgeIDs []int, delta int) error {
+	return b.graph.Reinforce(edgeIDs, delta)
+}
+
+// Size counts the brain's tokens, nodes and edges
+func (b *Brain) Size() (db.Size, error) {
+	return b.graph.Size()
+}
+
+// Stats reports the brain's size with its db.StatsTop tokens and n-grams
+func (b *Brain) Stats() (db.Stats, error) {
+	return b.graph.Stats(db.StatsTop)
+}
+
+// TokenNeighbors lists the most frequent successors and predecessors of a token
+func (b *Brain) TokenNeighbors(ctx context.Context, text string, limit int) (db.Neighbors, error) {
+	return b.graph.TokenNeighbors(ctx, text, limit)
+}
+
+// Close closes the brain's database
+func (b *Brain) Close() error {
+	return b.graph.Close()
+}
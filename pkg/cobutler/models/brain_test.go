@@ -0,0 +1,60 @@
+package models_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db/dbtest"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/models"
+)
+
+// Brain serves the API with its sampling, continuing, feedback and stats
+var (
+	_ api.Brain           = (*models.Brain)(nil)
+	_ api.BatchLearner    = (*models.Brain)(nil)
+	_ api.SamplingBrain   = (*models.Brain)(nil)
+	_ api.ContinuingBrain = (*models.Brain)(nil)
+	_ api.FeedbackBrain   = (*models.Brain)(nil)
+	_ api.SizeBrain       = (*models.Brain)(nil)
+	_ api.StatsBrain      = (*models.Brain)(nil)
+	_ api.GraphBrain      = (*models.Brain)(nil)
+)
+
+func TestBrain(t *testing.T) {
+	brain, err := models.NewBrain(dbtest.Create(t, dbtest.Brain{Order: 2}), db.GraphOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open brain: %v", err)
+	}
+	defer brain.Close()
+
+	if err := brain.Learn("the quick brown fox"); err != nil {
+		t.Fatalf("Learn failed: %v", err)
+	}
+
+	reply, err := brain.Reply("quick")
+	if err != nil {
+		t.Fatalf("Reply failed: %v", err)
+	}
+	if reply != "the quick brown fox" {
+		t.Errorf("Expected the learned text as the only reply, got %q", reply)
+	}
+	if got, err := brain.Continue("the quick"); err != nil || got != " brown fox" {
+		t.Errorf("Continue(the quick) = %q, %v, want \" brown fox\"", got, err)
+	}
+
+	size, err := brain.Size()
+	if err != nil {
+		t.Fatalf("Size failed: %v", err)
+	}
+	if size.Edges == 0 || brain.Graph().Order() != 2 {
+		t.Errorf("Expected an order 2 brain with learned edges, got %+v", size)
+	}
+}
+
+func TestNewBrainMissing(t *testing.T) {
+	if _, err := models.NewBrain(filepath.Join(t.TempDir(), "missing", "brain.db"), db.GraphOptions{}); err == nil {
+		t.Error("Expected opening a missing brain to fail")
+	}
+}
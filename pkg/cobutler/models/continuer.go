@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// Continuer completes text from its end. Unlike a reply, which walks both ways
+// from a random pivot word, a continuation walks only forward from the node
+// matching the last tokens of the prefix, so it suits completing what is being typed.
+type Continuer struct {
+	graph     *db.Graph
+	tokenizer Tokenizer
+}
+
+// NewContinuer creates a Continuer over the graph, splitting prefixes with tokenizer
+func NewContinuer(graph *db.Graph, tokenizer Tokenizer) *Continuer {
+	return &Continuer{graph: graph, tokenizer: tokenizer}
+}
+
+// Continue returns a continuation of prefix, sampled in proportion to how often
+// each edge was learned
+func (c *Continuer) Continue(prefix string) (string, error) {
+	var reply strings.Builder
+	sampling := db.Sampling{Rand: rand.New(rand.NewSource(time.Now().UnixNano())), Temperature: 1}
+	_, _, err := c.ContinueSample(context.Background(), prefix, sampling, func(token string) error {
+		reply.WriteString(token)
+		return nil
+	})
+	return reply.String(), err
+}
+
+// ContinueSample continues prefix with the given sampling, calling emit with each
+// token as the walk chooses it. Tokens include the space before them. It returns
+// the edges the walk took so the completion can be reinforced later. The walk
+// stops when emit returns an error, which is reported as db.StopCancelled.
+func (c *Continuer) ContinueSample(ctx context.Context, prefix string, sampling db.Sampling, emit func(token string) error) ([]int, db.StopReason, error) {
+	tokenIDs, err := c.tokenIDs(ctx, prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tokenIDs) == 0 {
+		return nil, db.StopDeadEnd, nil
+	}
+
+	endID, err := c.graph.EndNode(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The walk reports a failed step as cancelled, so lookup errors are kept here
+	var lookupErr error
+	edgeIDs, reason, err := c.graph.SearchContinuation(ctx, sampling, tokenIDs, endID, func(edgeID int) error {
+		text, hasSpace, err := c.graph.GetNextTextByEdge(ctx, edgeID)
+		if err != nil {
+			lookupErr = err
+			return err
+		}
+		// The end token has no text
+		if text == "" {
+			return nil
+		}
+		if hasSpace {
+			text = " " + text
+		}
+		return emit(text)
+	})
+	if lookupErr != nil {
+		return nil, "", lookupErr
+	}
+	return edgeIDs, reason, err
+}
+
+// tokenIDs splits prefix into tokens and looks up their IDs. Spaces are kept on
+// edges rather than as tokens, and tokens never learned get ID 0 so they don't
+// match any node.
+func (c *Continuer) tokenIDs(ctx context.Context, prefix string) ([]int, error) {
+	var ids []int
+	for _, token := range c.tokenizer.Split(prefix) {
+		if strings.TrimSpace(token) == "" {
+			continue
+		}
+		id, err := c.graph.GetTokenByText(ctx, token, false)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db/dbtest"
+)
+
+// quickBrownFox is an order 2 brain that has learned "the quick brown fox"
+var quickBrownFox = dbtest.Brain{
+	Order:  2,
+	Tokens: map[int]string{1: "", 2: "the", 3: "quick", 4: "brown", 5: "fox"},
+	// The end node, then one node per pair of tokens
+	Nodes: [][]int{{1, 1}, {1, 2}, {2, 3}, {3, 4}, {4, 5}},
+	Edges: [][3]int{{1, 2, 1}, {2, 3, 1}, {3, 4, 1}, {4, 5, 1}, {5, 1, 1}},
+}
+
+func TestContinuer(t *testing.T) {
+	continuer := NewContinuer(newTestGraph(t, quickBrownFox), NewCobeTokenizer())
+
+	tests := []struct {
+		name       string
+		prefix     string
+		want       string
+		wantReason db.StopReason
+	}{
+		{name: "exact context", prefix: "the quick", want: " brown fox", wantReason: db.StopEnd},
+		{name: "backs off past unseen tokens", prefix: "a quick", want: " brown fox", wantReason: db.StopEnd},
+		{name: "single token", prefix: "brown", want: " fox", wantReason: db.StopEnd},
+		{name: "unseen last token", prefix: "the cat", want: "", wantReason: db.StopDeadEnd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			sampling := db.Sampling{Rand: rand.New(rand.NewSource(1)), Temperature: 1}
+			edgeIDs, reason, err := continuer.ContinueSample(context.Background(), tt.prefix, sampling, func(token string) error {
+				got += token
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ContinueSample failed: %v", err)
+			}
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("ContinueSample(%q) = %q, %q; want %q, %q", tt.prefix, got, reason, tt.want, tt.wantReason)
+			}
+			// Every emitted token and the end token come from an edge of the walk
+			if want := len(strings.Fields(tt.want)); want > 0 && len(edgeIDs) != want+1 {
+				t.Errorf("Expected %d walk edges, got %v", want+1, edgeIDs)
+			}
+		})
+	}
+
+	if got, err := continuer.Continue("the quick"); err != nil || got != " brown fox" {
+		t.Errorf("Continue = %q, %v; want %q", got, err, " brown fox")
+	}
+}
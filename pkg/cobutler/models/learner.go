@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// Learner learns text into a graph the way cobe does. Each run of order tokens
+// becomes a node, padded with end tokens on both sides, and consecutive nodes are
+// linked by edges recording whether a space came before the new token.
+type Learner struct {
+	graph     *db.Graph
+	tokenizer Tokenizer
+}
+
+// NewLearner creates a Learner writing to graph, splitting texts with tokenizer
+func NewLearner(graph *db.Graph, tokenizer Tokenizer) *Learner {
+	return &Learner{graph: graph, tokenizer: tokenizer}
+}
+
+// Learn learns text in a transaction of its own
+func (l *Learner) Learn(text string) error {
+	return l.LearnBatch([]string{text})
+}
+
+// LearnBatch learns texts in a single transaction. If any text fails none of
+// the batch is kept, so the caller can retry the texts one at a time.
+func (l *Learner) LearnBatch(texts []string) error {
+	return l.graph.Batch(func() error {
+		for _, text := range texts {
+			if err := l.learn(text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// learn adds the nodes and edges of text to the open transaction. Texts with
+// fewer words than the graph's order are too short to learn.
+func (l *Learner) learn(text string) error {
+	ctx := context.Background()
+	order := l.graph.Order()
+
+	endToken, err := l.graph.GetTokenByText(ctx, "", true)
+	if err != nil {
+		return err
+	}
+
+	// Spaces are kept on the edges rather than as tokens
+	var tokenIDs []int
+	var spaces []bool
+	space := false
+	for _, token := range l.tokenizer.Split(text) {
+		if strings.TrimSpace(token) == "" {
+			space = true
+			continue
+		}
+		id, err := l.graph.GetTokenByText(ctx, token, true)
+		if err != nil {
+			return err
+		}
+		tokenIDs = append(tokenIDs, id)
+		spaces = append(spaces, space)
+		space = false
+	}
+	if len(tokenIDs) < order {
+		return nil
+	}
+
+	chain := make([]int, 0, len(tokenIDs)+2*order)
+	chainSpaces := make([]bool, 0, cap(chain))
+	for i := 0; i < order; i++ {
+		chain = append(chain, endToken)
+		chainSpaces = append(chainSpaces, false)
+	}
+	chain = append(chain, tokenIDs...)
+	chainSpaces = append(chainSpaces, spaces...)
+	for i := 0; i < order; i++ {
+		chain = append(chain, endToken)
+		chainSpaces = append(chainSpaces, false)
+	}
+
+	prevNode, err := l.graph.GetNodeByTokens(ctx, chain[:order], true)
+	if err != nil {
+		return err
+	}
+	for i := 1; i+order <= len(chain); i++ {
+		nextNode, err := l.graph.GetNodeByTokens(ctx, chain[i:i+order], true)
+		if err != nil {
+			return err
+		}
+		if err := l.graph.AddEdge(prevNode, nextNode, chainSpaces[i+order-1]); err != nil {
+			return err
+		}
+		prevNode = nextNode
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db/dbtest"
+)
+
+func TestLearnerLearnBatch(t *testing.T) {
+	graph := newTestGraph(t, dbtest.Brain{Order: 2})
+	learner := NewLearner(graph, NewCobeTokenizer())
+
+	if err := learner.LearnBatch([]string{"the quick brown fox", "fox", "the quick brown fox"}); err != nil {
+		t.Fatalf("LearnBatch failed: %v", err)
+	}
+
+	// The batch is committed, so continuations read from it
+	continuer := NewContinuer(graph, NewCobeTokenizer())
+	if got, err := continuer.Continue("the quick"); err != nil || got != " brown fox" {
+		t.Errorf("Continue(the quick) = %q, %v, want \" brown fox\"", got, err)
+	}
+
+	// Learning the same text twice counts its edges twice, and short texts are skipped
+	var edges, counted int
+	if err := graph.Reader.QueryRow("SELECT COUNT(*), SUM(count) FROM edges").Scan(&edges, &counted); err != nil {
+		t.Fatalf("Failed to count edges: %v", err)
+	}
+	if edges != 6 || counted != 12 {
+		t.Errorf("Expected 6 edges learned twice each, got %d edges with counts totalling %d", edges, counted)
+	}
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+const (
+	// DefaultCompletionTTL is how long an unused completion is remembered
+	DefaultCompletionTTL = 30 * 24 * time.Hour
+	// DefaultMaxCompletions caps how many completions are remembered
+	DefaultMaxCompletions = 50000
+	// memoryContextWords is how many trailing words of the context form its key
+	memoryContextWords = 12
+	// pruneEvery is how many remembered completions trigger a prune
+	pruneEvery = 100
+	// touchEvery is how many recalled completions are marked as used in one write
+	touchEvery = 100
+	// touchInterval is the longest a recalled completion waits to be marked as used
+	touchInterval = time.Minute
+)
+
+// CompletionMemory remembers completions accepted for a given context so they can
+// be returned deterministically, like learned snippets, instead of a random walk.
+// Recalls only read; the completions they return are marked as used in batches.
+type CompletionMemory struct {
+	graph      *db.Graph
+	ttl        time.Duration
+	maxEntries int
+
+	mu         sync.Mutex
+	sincePrune int
+	touched    []int64
+	touchedAt  time.Time
+}
+
+// NewCompletionMemory creates a completion memory stored in the graph's database.
+// A zero ttl or maxEntries uses the defaults.
+func NewCompletionMemory(graph *db.Graph, ttl time.Duration, maxEntries int) (*CompletionMemory, error) {
+	if ttl <= 0 {
+		ttl = DefaultCompletionTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxCompletions
+	}
+
+	if err := graph.EnsureCompletionsTable(); err != nil {
+		return nil, err
+	}
+
+	return &CompletionMemory{
+		graph:      graph,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		touchedAt:  time.Now(),
+	}, nil
+}
+
+// Remember stores a completion for the context
+func (m *CompletionMemory) Remember(context, completion string) error {
+	completion = strings.TrimSpace(completion)
+	if completion == "" {
+		return nil
+	}
+
+	now := time.Now()
+	if err := m.graph.RememberCompletion(ContextKey(context), completion, now); err != nil {
+		return err
+	}
+
+	// Enforce the TTL and size cap every so often rather than on every write
+	m.mu.Lock()
+	m.sincePrune++
+	prune := m.sincePrune >= pruneEvery
+	if prune {
+		m.sincePrune = 0
+	}
+	m.mu.Unlock()
+
+	if prune {
+		// Recently recalled completions must not be pruned as unused
+		if err := m.Flush(); err != nil {
+			return err
+		}
+		deleted, err := m.graph.PruneCompletions(now.Add(-m.ttl), m.maxEntries)
+		if err != nil {
+			return err
+		}
+		slog.Debug("Pruned completion memory", "deleted", deleted)
+	}
+
+	return nil
+}
+
+// Recall returns the most frequently accepted completion for the context, if any
+func (m *CompletionMemory) Recall(context string) (string, bool, error) {
+	id, completion, err := m.graph.LookupCompletion(ContextKey(context), time.Now().Add(-m.ttl))
+	if err != nil || id == 0 {
+		return "", false, err
+	}
+
+	m.mu.Lock()
+	m.touched = append(m.touched, id)
+	flush := len(m.touched) >= touchEvery || time.Since(m.touchedAt) >= touchInterval
+	m.mu.Unlock()
+
+	if flush {
+		if err := m.Flush(); err != nil {
+			return "", false, err
+		}
+	}
+	return completion, true, nil
+}
+
+// Flush marks the completions recalled since the last flush as used
+func (m *CompletionMemory) Flush() error {
+	m.mu.Lock()
+	touched := m.touched
+	m.touched = nil
+	m.touchedAt = time.Now()
+	m.mu.Unlock()
+
+	return m.graph.TouchCompletions(touched, time.Now())
+}
+
+// RememberCompletion remembers a completion like Remember, logging failures. It
+// lets the memory stand in for a brain's own in api.Handler.
+func (m *CompletionMemory) RememberCompletion(context, completion string) {
+	if err := m.Remember(context, completion); err != nil {
+		slog.Error("Failed to remember completion", "error", err)
+	}
+}
+
+// RecallCompletion recalls a completion like Recall, treating failures as
+// nothing remembered
+func (m *CompletionMemory) RecallCompletion(context string) (string, bool) {
+	completion, ok, err := m.Recall(context)
+	if err != nil {
+		slog.Error("Failed to recall completion", "error", err)
+		return "", false
+	}
+	return completion, ok
+}
+
+// ContextKey returns a normalized hash of the trailing words of the context, so
+// completions match regardless of indentation and line breaks
+func ContextKey(context string) string {
+	words := strings.Fields(context)
+	if len(words) > memoryContextWords {
+		words = words[len(words)-memoryContextWords:]
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(words, " ")))
+	return hex.EncodeToString(sum[:])
+}
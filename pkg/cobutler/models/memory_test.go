@@ -0,0 +1,109 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db/dbtest"
+)
+
+// newTestGraph opens a graph over a temporary database holding brain
+func newTestGraph(t *testing.T, brain dbtest.Brain) *db.Graph {
+	t.Helper()
+
+	graph, err := db.NewGraph(dbtest.Create(t, brain), db.GraphOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open graph: %v", err)
+	}
+	t.Cleanup(func() { graph.Close() })
+
+	// Leave the writer's transaction open, as it is after learning, so writes
+	// that aren't committed stay hidden from the reader
+	if err := graph.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	return graph
+}
+
+func TestCompletionMemory(t *testing.T) {
+	memory, err := NewCompletionMemory(newTestGraph(t, dbtest.Brain{Order: 1}), 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to create memory: %v", err)
+	}
+
+	if _, ok, err := memory.Recall("if err != nil"); err != nil || ok {
+		t.Fatalf("Expected nothing to recall, got ok=%v err=%v", ok, err)
+	}
+
+	// The most frequently accepted completion wins
+	context := "func main() {\n\tif err != nil"
+	for _, completion := range []string{"{ return err }", "{ panic(err) }", "{ return err }"} {
+		if err := memory.Remember(context, completion); err != nil {
+			t.Fatalf("Failed to remember: %v", err)
+		}
+	}
+
+	// Indentation and line breaks do not change the key
+	completion, ok, err := memory.Recall("func main() { if err != nil")
+	if err != nil {
+		t.Fatalf("Failed to recall: %v", err)
+	}
+	if !ok || completion != "{ return err }" {
+		t.Errorf("Expected %q, got %q (ok=%v)", "{ return err }", completion, ok)
+	}
+}
+
+func TestCompletionMemoryBatchesTouches(t *testing.T) {
+	graph := newTestGraph(t, dbtest.Brain{Order: 1})
+	memory, err := NewCompletionMemory(graph, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to create memory: %v", err)
+	}
+	if err := memory.Remember("if err != nil", "{ return err }"); err != nil {
+		t.Fatalf("Failed to remember: %v", err)
+	}
+	err = graph.Batch(func() error {
+		_, err := graph.Conn.Exec("UPDATE completions SET last_used = 1")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to age completion: %v", err)
+	}
+	lastUsed := func() int64 {
+		t.Helper()
+		var lastUsed int64
+		if err := graph.Reader.QueryRow("SELECT last_used FROM completions").Scan(&lastUsed); err != nil {
+			t.Fatalf("Failed to read last use: %v", err)
+		}
+		return lastUsed
+	}
+
+	// Recalling doesn't write until the batch is flushed
+	memory.ttl = time.Since(time.Unix(0, 0))
+	if _, ok := memory.RecallCompletion("if err != nil"); !ok {
+		t.Fatal("Expected a recalled completion")
+	}
+	if got := lastUsed(); got != 1 {
+		t.Errorf("Expected recall not to touch the completion, got last use %d", got)
+	}
+
+	if err := memory.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if got := lastUsed(); got < time.Now().Add(-time.Minute).Unix() {
+		t.Errorf("Expected flush to mark the completion as used, got last use %d", got)
+	}
+}
+
+func TestContextKeyUsesTrailingWords(t *testing.T) {
+	short := "a b c d e f g h i j k l"
+	long := "unrelated words before " + short
+
+	if ContextKey(short) != ContextKey(long) {
+		t.Error("Expected contexts with the same trailing words to share a key")
+	}
+	if ContextKey(short) == ContextKey("a b c") {
+		t.Error("Expected different contexts to have different keys")
+	}
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+)
+
+// Replier replies to text the way cobe does. It picks a word of the text as a
+// pivot, or a random word when the graph knows none of them, and walks from a
+// node starting with the pivot back to where learned text started and forward to
+// where it ended. Every random choice comes from the caller's source, so the same
+// seed and graph give the same reply.
+type Replier struct {
+	graph     *db.Graph
+	tokenizer Tokenizer
+}
+
+// NewReplier creates a Replier over the graph, splitting texts with tokenizer
+func NewReplier(graph *db.Graph, tokenizer Tokenizer) *Replier {
+	return &Replier{graph: graph, tokenizer: tokenizer}
+}
+
+// ReplySample returns a reply to text sampled with the given settings
+func (r *Replier) ReplySample(text string, sampling db.Sampling) (string, error) {
+	var reply strings.Builder
+	_, _, err := r.ReplyStreamSample(context.Background(), text, sampling, func(token string) error {
+		reply.WriteString(token)
+		return nil
+	})
+	return strings.TrimSpace(reply.String()), err
+}
+
+// ReplyStreamSample replies to text with the given sampling, calling emit with
+// each token. The walk back from the pivot is emitted once it is done, and the
+// walk forward token by token as it goes. It returns the edges of both walks and
+// why the forward walk stopped; when emit returns an error the reply stops,
+// reported as db.StopCancelled.
+func (r *Replier) ReplyStreamSample(ctx context.Context, text string, sampling db.Sampling, emit func(token string) error) ([]int, db.StopReason, error) {
+	pivot, err := r.pivot(ctx, text, sampling)
+	if err != nil {
+		return nil, "", err
+	}
+	startID, err := r.graph.GetRandomNodeWithToken(ctx, sampling.Rand, pivot)
+	if err != nil || startID == 0 {
+		return nil, db.StopDeadEnd, err
+	}
+	endID, err := r.graph.EndNode(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	backward, reason, err := r.graph.SearchRandomWalkContext(ctx, sampling, startID, endID, false, nil)
+	if err != nil || reason == db.StopCancelled {
+		return backward, reason, err
+	}
+
+	// The reply starts with the node the backward walk reached, then follows the
+	// backward edges in reading order
+	firstID := startID
+	if len(backward) > 0 {
+		if firstID, err = r.graph.GetPrevNodeByEdge(ctx, backward[len(backward)-1]); err != nil {
+			return nil, "", err
+		}
+	}
+	head, err := r.graph.GetNodeTokens(ctx, firstID)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := emit(joinNodeTokens(head)); err != nil {
+		return backward, db.StopCancelled, nil
+	}
+	for i := len(backward) - 1; i >= 0; i-- {
+		token, err := r.edgeToken(ctx, backward[i])
+		if err != nil {
+			return nil, "", err
+		}
+		if err := emit(token); err != nil {
+			return backward, db.StopCancelled, nil
+		}
+	}
+
+	// The walk reports a failed step as cancelled, so lookup errors are kept here
+	var lookupErr error
+	forward, reason, err := r.graph.SearchRandomWalkContext(ctx, sampling, startID, endID, true, func(edgeID int) error {
+		token, err := r.edgeToken(ctx, edgeID)
+		if err != nil {
+			lookupErr = err
+			return err
+		}
+		return emit(token)
+	})
+	if lookupErr != nil {
+		return nil, "", lookupErr
+	}
+	return append(backward, forward...), reason, err
+}
+
+// pivot picks a random word of text that the graph knows, or a random token when
+// it knows none of them
+func (r *Replier) pivot(ctx context.Context, text string, sampling db.Sampling) (int, error) {
+	var known []int
+	for _, token := range r.tokenizer.Split(text) {
+		if strings.TrimSpace(token) == "" {
+			continue
+		}
+		id, err := r.graph.GetTokenByText(ctx, token, false)
+		if err != nil {
+			return 0, err
+		}
+		if id != 0 {
+			known = append(known, id)
+		}
+	}
+
+	words, err := r.graph.GetWordTokens(ctx, known)
+	if err != nil {
+		return 0, err
+	}
+	if len(words) == 0 {
+		return r.graph.GetRandomToken(ctx, sampling.Rand)
+	}
+	return words[sampling.Rand.Intn(len(words))], nil
+}
+
+// edgeToken returns the text an edge adds when read forward, with the space
+// before it. The end token has no text.
+func (r *Replier) edgeToken(ctx context.Context, edgeID int) (string, error) {
+	text, hasSpace, err := r.graph.GetNextTextByEdge(ctx, edgeID)
+	if err != nil || text == "" {
+		return "", err
+	}
+	if hasSpace {
+		text = " " + text
+	}
+	return text, nil
+}
+
+// joinNodeTokens joins the tokens a reply starts with. Nodes don't record the
+// spaces between their own tokens, so words are separated by one; end tokens
+// are skipped.
+func joinNodeTokens(tokens []string) string {
+	var words []string
+	for _, token := range tokens {
+		if token != "" {
+			words = append(words, token)
+		}
+	}
+	return strings.Join(words, " ")
+}
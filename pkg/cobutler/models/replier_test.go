@@ -0,0 +1,56 @@
+package models
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db/dbtest"
+)
+
+func TestReplier(t *testing.T) {
+	graph := newTestGraph(t, dbtest.Brain{Order: 2})
+	texts := []string{
+		"the quick brown fox jumps",
+		"a quick red fox sleeps",
+		"the lazy dog sleeps",
+		"a brown dog jumps",
+	}
+	if err := NewLearner(graph, NewCobeTokenizer()).LearnBatch(texts); err != nil {
+		t.Fatalf("LearnBatch failed: %v", err)
+	}
+	replier := NewReplier(graph, NewCobeTokenizer())
+
+	reply := func(text string, seed int64) string {
+		t.Helper()
+		sampling := db.Sampling{Rand: rand.New(rand.NewSource(seed)), Temperature: 1}
+		reply, err := replier.ReplySample(text, sampling)
+		if err != nil {
+			t.Fatalf("ReplySample failed: %v", err)
+		}
+		return reply
+	}
+
+	// Replies run from the start of a learned sentence through the pivot to the
+	// end of one, so they hold one of the text's words
+	seen := map[string]bool{}
+	for seed := int64(0); seed < 50; seed++ {
+		got := reply("the dog", seed)
+		if again := reply("the dog", seed); again != got {
+			t.Fatalf("Seed %d: expected the same reply twice, got %q and %q", seed, got, again)
+		}
+		if !strings.Contains(got, "the") && !strings.Contains(got, "dog") {
+			t.Errorf("Seed %d: expected the reply to hold a word of the text, got %q", seed, got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("Expected different seeds to give different replies, got %v", seen)
+	}
+
+	// Texts the graph knows nothing of reply from a random word
+	if got := reply("unknown words", 1); got == "" {
+		t.Error("Expected a reply to unknown words")
+	}
+}
@@ -0,0 +1,353 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Snippet is a code template offered as a completion
+type Snippet struct {
+	// Trigger is the text at the end of the prefix that selected the template
+	Trigger string
+	// Name is the template name, e.g. "function" or "if"
+	Name string
+	// Text is the completion with placeholders replaced by their defaults
+	Text string
+	// Body is the completion in snippet syntax with ${1:default} tab stops and a final $0
+	Body string
+	// Replace is how many bytes before the cursor the completion replaces. It is
+	// zero when the template starts with its trigger and the completion continues it.
+	Replace int
+}
+
+var (
+	// identifierRegex matches identifiers in the context
+	identifierRegex = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+	// placeholderRegex matches template placeholders such as NAME or CONDITION
+	placeholderRegex = regexp.MustCompile(`\b[A-Z][A-Z_]*[A-Z]\b|\bN\b`)
+)
+
+// languageAliases maps editor filetypes to the language of their templates
+var languageAliases = map[string]string{
+	"typescript":      "javascript",
+	"javascriptreact": "javascript",
+	"typescriptreact": "javascript",
+	"jsx":             "javascript",
+	"tsx":             "javascript",
+}
+
+// snippetKeywords are never used to fill placeholders
+var snippetKeywords = map[string]bool{
+	"if": true, "else": true, "elif": true, "for": true, "while": true, "do": true,
+	"func": true, "function": true, "def": true, "fn": true, "return": true,
+	"class": true, "struct": true, "interface": true, "type": true, "impl": true,
+	"var": true, "let": true, "const": true, "local": true, "end": true, "then": true,
+	"in": true, "range": true, "nil": true, "null": true, "None": true, "true": true,
+	"false": true, "True": true, "False": true, "import": true, "package": true,
+	"from": true, "as": true, "with": true, "switch": true, "case": true, "default": true,
+	"break": true, "continue": true, "go": true, "defer": true, "try": true, "catch": true,
+	"except": true, "not": true, "and": true, "or": true, "new": true, "self": true,
+	"this": true, "pub": true, "public": true, "private": true, "static": true,
+	"void": true, "int": true, "string": true, "bool": true, "err": true,
+}
+
+// FindSnippet returns a template for the language when the prefix ends with one of
+// its triggers. Longer triggers win, so "fori" is preferred over "i". Placeholders
+// whose default is NAME, CONDITION, VALUE or PARAMS are filled from identifiers
+// near the end of the prefix.
+func (s *TemplateStore) FindSnippet(prefix, language string) (Snippet, bool) {
+	for _, candidate := range s.candidates(language) {
+		start, ok := matchTrigger(prefix, candidate.trigger)
+		if !ok {
+			continue
+		}
+
+		text, body := renderSnippet(candidate.template.Body, placeholderValues(nearbyIdentifiers(prefix[:start])))
+		snippet := Snippet{
+			Trigger: candidate.trigger,
+			Name:    candidate.template.Name,
+			Text:    text,
+			Body:    body,
+			Replace: len(prefix) - start,
+		}
+
+		// Templates starting with their trigger continue what was typed
+		rest, ok := strings.CutPrefix(text, candidate.trigger)
+		if ok && strings.HasPrefix(body, candidate.trigger) && (rest == "" || !isWordChar(rest[0])) {
+			snippet.Text = rest
+			snippet.Body = body[len(candidate.trigger):]
+			snippet.Replace = 0
+
+			// Avoid a double space when the prefix already ends with one
+			if strings.HasSuffix(prefix, " ") || strings.HasSuffix(prefix, "\t") {
+				snippet.Text = strings.TrimLeft(snippet.Text, " ")
+				snippet.Body = strings.TrimLeft(snippet.Body, " ")
+			}
+		}
+
+		return snippet, true
+	}
+
+	return Snippet{}, false
+}
+
+// matchTrigger reports whether the prefix ends with the trigger, ignoring trailing
+// spaces, and returns where the trigger starts. A trigger starting with a word
+// character must start a word.
+func matchTrigger(prefix, trigger string) (int, bool) {
+	trimmed := strings.TrimRight(prefix, " \t")
+	if !strings.HasSuffix(trimmed, trigger) {
+		return 0, false
+	}
+
+	start := len(trimmed) - len(trigger)
+	if start > 0 && isWordChar(trigger[0]) && isWordChar(trimmed[start-1]) {
+		return 0, false
+	}
+	return start, true
+}
+
+// nearbyIdentifiers returns the distinct non-keyword identifiers in the context,
+// most recent first
+func nearbyIdentifiers(context string) []string {
+	matches := identifierRegex.FindAllString(context, -1)
+
+	seen := make(map[string]bool)
+	var identifiers []string
+	for i := len(matches) - 1; i >= 0; i-- {
+		id := matches[i]
+		if snippetKeywords[id] || seen[id] {
+			continue
+		}
+		seen[id] = true
+		identifiers = append(identifiers, id)
+	}
+
+	return identifiers
+}
+
+// placeholderValues maps placeholder names to identifiers: NAME, CONDITION and
+// VALUE take the most recent identifier and PARAMS the one before it
+func placeholderValues(identifiers []string) map[string]string {
+	values := make(map[string]string)
+	if len(identifiers) > 0 {
+		values["NAME"] = identifiers[0]
+		values["CONDITION"] = identifiers[0]
+		values["VALUE"] = identifiers[0]
+	}
+	if len(identifiers) > 1 {
+		values["PARAMS"] = identifiers[1]
+	}
+	return values
+}
+
+// leadingWord returns the identifier a built-in template starts with
+func leadingWord(text string) string {
+	end := 0
+	for end < len(text) && isWordChar(text[end]) {
+		end++
+	}
+	return text[:end]
+}
+
+// placeholdersToSnippet converts a built-in template with upper case placeholders
+// to snippet syntax. Each placeholder becomes a tab stop defaulting to its name and
+// the cursor ends up on the first empty indented line.
+func placeholdersToSnippet(template string) string {
+	var body strings.Builder
+	stops := make(map[string]int)
+	last := 0
+	for _, loc := range placeholderRegex.FindAllStringIndex(template, -1) {
+		body.WriteString(escapeSnippet(template[last:loc[0]]))
+
+		// Repeated placeholders share a tab stop
+		placeholder := template[loc[0]:loc[1]]
+		stop, ok := stops[placeholder]
+		if !ok {
+			stop = len(stops) + 1
+			stops[placeholder] = stop
+		}
+
+		fmt.Fprintf(&body, "${%d:%s}", stop, placeholder)
+		last = loc[1]
+	}
+	body.WriteString(escapeSnippet(template[last:]))
+
+	result := body.String()
+	if i := strings.Index(result, "\n\t\n"); i >= 0 {
+		return result[:i+2] + "$0" + result[i+2:]
+	}
+	return result + "$0"
+}
+
+// renderSnippet expands a body in snippet syntax. It returns the plain text, with
+// tab stops replaced by their defaults, and the body with defaults and variables
+// found in values filled in.
+func renderSnippet(body string, values map[string]string) (string, string) {
+	p := &snippetParser{src: body, values: values, stops: make(map[string]string)}
+	return p.parse(false)
+}
+
+// snippetParser renders the subset of the LSP snippet grammar used by templates:
+// $1, ${1}, ${1:default}, ${1|one,two|}, $VAR, ${VAR} and ${VAR:default}
+type snippetParser struct {
+	src    string
+	pos    int
+	values map[string]string
+	// stops holds the text of each tab stop so mirrors like $1 repeat it
+	stops map[string]string
+}
+
+// parse renders until the end of the input or, inside a placeholder, an unescaped
+// closing brace, which is left for the caller
+func (p *snippetParser) parse(nested bool) (string, string) {
+	var text, body strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.src) && strings.IndexByte(`$}\`, p.src[p.pos+1]) >= 0:
+			text.WriteByte(p.src[p.pos+1])
+			body.WriteString(p.src[p.pos : p.pos+2])
+			p.pos += 2
+		case c == '}' && nested:
+			return text.String(), body.String()
+		case c == '$':
+			t, b := p.parseDollar()
+			text.WriteString(t)
+			body.WriteString(b)
+		default:
+			text.WriteByte(c)
+			body.WriteByte(c)
+			p.pos++
+		}
+	}
+	return text.String(), body.String()
+}
+
+// parseDollar renders a tab stop, placeholder or variable starting at a dollar sign
+func (p *snippetParser) parseDollar() (string, string) {
+	start := p.pos
+	p.pos++
+
+	braced := p.pos < len(p.src) && p.src[p.pos] == '{'
+	if braced {
+		p.pos++
+	}
+
+	// Tab stops are numbered and variables are named like identifiers
+	nameStart := p.pos
+	isStop := p.pos < len(p.src) && isDigit(p.src[p.pos])
+	for p.pos < len(p.src) && (isStop && isDigit(p.src[p.pos]) || !isStop && isWordChar(p.src[p.pos])) {
+		p.pos++
+	}
+	name := p.src[nameStart:p.pos]
+	if name == "" {
+		// Not a tab stop or variable, so the dollar sign is literal
+		p.pos = start + 1
+		return "$", `\$`
+	}
+
+	value, known := p.values[name]
+
+	if !braced {
+		if isStop {
+			return p.stops[name], p.src[start:p.pos]
+		}
+		if known {
+			return value, escapeSnippet(value)
+		}
+		return "", p.src[start:p.pos]
+	}
+
+	if p.pos >= len(p.src) {
+		p.pos = start + 1
+		return "$", `\$`
+	}
+
+	switch p.src[p.pos] {
+	case '}':
+		p.pos++
+		if isStop {
+			return p.stops[name], p.src[start:p.pos]
+		}
+		if known {
+			return value, escapeSnippet(value)
+		}
+		return "", p.src[start:p.pos]
+
+	case ':':
+		p.pos++
+		defaultStart := p.pos
+		defaultText, defaultBody := p.parse(true)
+		raw := p.src[defaultStart:p.pos]
+		if p.pos < len(p.src) {
+			p.pos++
+		}
+
+		if !isStop {
+			if known {
+				return value, escapeSnippet(value)
+			}
+			return defaultText, "${" + name + ":" + defaultBody + "}"
+		}
+
+		// Placeholders named like NAME default to nearby identifiers
+		if filled, ok := p.values[raw]; ok {
+			p.stops[name] = filled
+			return filled, "${" + name + ":" + escapePlaceholder(filled) + "}"
+		}
+		p.stops[name] = defaultText
+		return defaultText, "${" + name + ":" + defaultBody + "}"
+
+	case '|':
+		if !isStop {
+			break
+		}
+		end := strings.Index(p.src[p.pos:], "|}")
+		if end < 0 {
+			break
+		}
+		choices := p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 2
+
+		first := choices
+		for i := 0; i < len(choices); i++ {
+			if choices[i] == '\\' {
+				i++
+			} else if choices[i] == ',' {
+				first = choices[:i]
+				break
+			}
+		}
+		first = strings.NewReplacer(`\,`, ",", `\|`, "|", `\\`, `\`).Replace(first)
+		p.stops[name] = first
+		return first, p.src[start:p.pos]
+	}
+
+	// Malformed, so the dollar sign is literal
+	p.pos = start + 1
+	return "$", `\$`
+}
+
+// escapeSnippet escapes characters with a special meaning in snippet syntax.
+// A closing brace only needs escaping inside a placeholder.
+func escapeSnippet(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	return strings.ReplaceAll(text, `$`, `\$`)
+}
+
+// escapePlaceholder escapes text for use as a placeholder default
+func escapePlaceholder(text string) string {
+	return strings.ReplaceAll(escapeSnippet(text), "}", `\}`)
+}
+
+// isDigit reports whether b is a decimal digit
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// isWordChar reports whether b can be part of an identifier
+func isWordChar(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
@@ -0,0 +1,51 @@
+package models
+
+import "testing"
+
+func TestFindSnippet(t *testing.T) {
+	store, err := NewTemplateStore("")
+	if err != nil {
+		t.Fatalf("Failed to create template store: %v", err)
+	}
+
+	snippet, ok := store.FindSnippet("handler := newHandler(config)\nfunc ", "go")
+	if !ok {
+		t.Fatal("Expected the func trigger to match a template")
+	}
+	if snippet.Name != "function" || snippet.Trigger != "func" {
+		t.Errorf("Expected the function template for func, got %q for %q", snippet.Name, snippet.Trigger)
+	}
+
+	// NAME takes the most recent identifier and PARAMS the one before it
+	if want := "config(newHandler) RETURNS {\n\t\n}"; snippet.Text != want {
+		t.Errorf("Expected text %q, got %q", want, snippet.Text)
+	}
+	if want := "${1:config}(${2:newHandler}) ${3:RETURNS} {\n\t$0\n}"; snippet.Body != want {
+		t.Errorf("Expected body %q, got %q", want, snippet.Body)
+	}
+
+	// The template named after the trigger wins over others starting with it
+	snippet, ok = store.FindSnippet("\tif", "go")
+	if !ok || snippet.Name != "if" {
+		t.Errorf("Expected the if template, got %q (ok=%v)", snippet.Name, ok)
+	}
+	if want := " CONDITION {\n\t\n}"; snippet.Text != want {
+		t.Errorf("Expected text %q, got %q", want, snippet.Text)
+	}
+
+	// Aliased filetypes use the templates of their language
+	if _, ok := store.FindSnippet("const ", "typescript"); !ok {
+		t.Error("Expected typescript to use the javascript templates")
+	}
+
+	// Triggers must be whole words
+	for _, prefix := range []string{"funky", "x := iffy", "func()"} {
+		if snippet, ok := store.FindSnippet(prefix, "go"); ok {
+			t.Errorf("Expected no template for %q, got %q", prefix, snippet.Name)
+		}
+	}
+
+	if _, ok := store.FindSnippet("func ", "text"); ok {
+		t.Error("Expected no templates for plain text")
+	}
+}
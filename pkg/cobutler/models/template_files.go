@@ -0,0 +1,280 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// addedTemplatesFile stores templates added at runtime in the templates directory.
+// It is hidden so it isn't read as a language file.
+const addedTemplatesFile = ".added.json"
+
+// snippetFileEntry is a template in the VS Code snippet file format, used for
+// .json, .yaml and .code-snippets files
+type snippetFileEntry struct {
+	Prefix      stringList `json:"prefix" yaml:"prefix"`
+	Body        stringList `json:"body" yaml:"body"`
+	Description string     `json:"description" yaml:"description"`
+	// Scope lists the languages of a .code-snippets template, separated by commas
+	Scope string `json:"scope" yaml:"scope"`
+}
+
+// stringList accepts either a single string or a list of strings
+type stringList []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %w", err)
+	}
+	*l = list
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %w", err)
+	}
+	*l = list
+	return nil
+}
+
+// loadTemplateDir reads the template files in dir. Files are named after their
+// language, like go.json or python.yaml; .code-snippets files name the languages
+// of each template in its scope. Files that fail to parse are logged and skipped.
+func loadTemplateDir(dir string) ([]Template, []Template, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	var templates []Template
+	for _, entry := range entries {
+		if entry.IsDir() || !isTemplateFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		fileTemplates, err := loadTemplateFile(path)
+		if err != nil {
+			slog.Warn("Skipping invalid template file", "path", path, "error", err)
+			continue
+		}
+		templates = append(templates, fileTemplates...)
+	}
+
+	added, err := loadAddedTemplates(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return templates, added, nil
+}
+
+// isTemplateFile reports whether a file in the templates directory holds templates
+func isTemplateFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml", ".code-snippets":
+		return true
+	}
+	return false
+}
+
+// loadTemplateFile parses a snippet file into templates
+func loadTemplateFile(path string) ([]Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]snippetFileEntry)
+	ext := filepath.Ext(path)
+	switch ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &entries)
+	default:
+		// VS Code snippet files commonly start with a comment block
+		err = json.Unmarshal(stripJSONComments(data), &entries)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// go.json and go.snippets.yaml both hold Go templates
+	language, _, _ := strings.Cut(filepath.Base(path), ".")
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var templates []Template
+	for _, name := range names {
+		entry := entries[name]
+
+		languages := []string{language}
+		if ext == ".code-snippets" {
+			// Templates without a scope apply to every language
+			languages = []string{""}
+			if entry.Scope != "" {
+				languages = strings.Split(entry.Scope, ",")
+			}
+		}
+
+		for _, lang := range languages {
+			t := Template{
+				Language:    strings.TrimSpace(lang),
+				Name:        name,
+				Triggers:    entry.Prefix,
+				Body:        strings.Join(entry.Body, "\n"),
+				Description: entry.Description,
+				Source:      path,
+			}
+			if err := t.Validate(); err != nil {
+				return nil, fmt.Errorf("template %q: %w", name, err)
+			}
+			templates = append(templates, t)
+		}
+	}
+
+	return templates, nil
+}
+
+// loadAddedTemplates reads the templates added at runtime
+func loadAddedTemplates(dir string) ([]Template, error) {
+	data, err := os.ReadFile(filepath.Join(dir, addedTemplatesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read added templates: %w", err)
+	}
+
+	var added []Template
+	if err := json.Unmarshal(data, &added); err != nil {
+		return nil, fmt.Errorf("failed to parse added templates: %w", err)
+	}
+	for i := range added {
+		added[i].Source = SourceAdded
+	}
+	return added, nil
+}
+
+// saveAddedTemplates replaces the added templates file
+func saveAddedTemplates(dir string, added []Template) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create templates directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(added, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial file
+	path := filepath.Join(dir, addedTemplatesFile)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to save added templates: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save added templates: %w", err)
+	}
+	return nil
+}
+
+// dirSignature summarizes the names, sizes and modification times of the
+// template files so changes can be detected without reading them
+func dirSignature(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	var signature strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || (!isTemplateFile(entry.Name()) && entry.Name() != addedTemplatesFile) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// The file was removed since the directory was read
+			continue
+		}
+		fmt.Fprintf(&signature, "%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return signature.String(), nil
+}
+
+// stripJSONComments removes // and /* */ comments outside of strings
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		if inString {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out = append(out, data[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := strings.Index(string(data[i+2:]), "*/")
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -1,8 +1,18 @@
 package models
 
-import "strings"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
 
-// Templates for common code constructs in different programming languages
+// Templates for common code constructs in different programming languages. Their
+// trigger is the first word of the template and upper case words are placeholders.
 var codeTemplates = map[string]map[string]string{
 	"go": {
 		"function":  "func NAME(PARAMS) RETURNS {\n\t\n}",
@@ -108,32 +118,342 @@ var codeTemplates = map[string]map[string]string{
 	},
 }
 
-// FindTemplate looks for a suitable template based on a prefix and language
-func FindTemplate(prefix string, language string) (string, bool) {
-	// Default to "go" if language not specified
-	if language == "" {
-		language = "go"
+// Template sources other than files
+const (
+	SourceBuiltin = "builtin"
+	SourceAdded   = "added"
+)
+
+var (
+	// ErrTemplateNotFound is returned when removing a template that doesn't exist
+	ErrTemplateNotFound = errors.New("template not found")
+	// ErrTemplateReadOnly is returned when removing a built-in or file template
+	ErrTemplateReadOnly = errors.New("template is not removable")
+)
+
+// Template is a code template in snippet syntax. It is offered when the text
+// before the cursor ends with one of its triggers.
+type Template struct {
+	// Language is the editor filetype, or empty for all languages
+	Language string `json:"language"`
+	Name     string `json:"name"`
+	// Triggers are the words that select the template
+	Triggers []string `json:"triggers"`
+	// Body uses snippet syntax with $1, ${2:default} tab stops and a final $0
+	Body        string `json:"body"`
+	Description string `json:"description,omitempty"`
+	// Source is "builtin", "added" or the file the template was loaded from
+	Source string `json:"source,omitempty"`
+}
+
+// Validate checks that the template can be matched and expanded
+func (t Template) Validate() error {
+	if t.Name == "" {
+		return errors.New("template name is required")
+	}
+	if t.Body == "" {
+		return errors.New("template body is required")
+	}
+	if len(t.Triggers) == 0 {
+		return errors.New("template needs at least one trigger")
 	}
+	for _, trigger := range t.Triggers {
+		if trigger == "" || strings.ContainsAny(trigger, " \t\r\n") {
+			return fmt.Errorf("invalid trigger %q", trigger)
+		}
+	}
+	return nil
+}
 
-	// Get templates for this language
-	langTemplates, exists := codeTemplates[language]
-	if !exists {
-		return "", false
+// TemplateStore holds the built-in templates, templates loaded from a directory
+// and templates added at runtime. Later sources override earlier ones with the
+// same language and name.
+type TemplateStore struct {
+	dir string
+
+	mu        sync.RWMutex
+	builtin   []Template
+	files     []Template
+	added     []Template
+	byLang    map[string][]Template
+	signature string
+}
+
+// NewTemplateStore creates a store with the built-in templates and, if dir is not
+// empty, the templates in that directory. A missing directory is not an error.
+func NewTemplateStore(dir string) (*TemplateStore, error) {
+	s := &TemplateStore{
+		dir:     dir,
+		builtin: builtinTemplates(),
 	}
 
-	// Check for direct matches with template keys
-	for pattern, template := range langTemplates {
-		if strings.HasPrefix(prefix, pattern) {
-			return template, true
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// builtinTemplates converts codeTemplates to snippet syntax
+func builtinTemplates() []Template {
+	var templates []Template
+	for language, langTemplates := range codeTemplates {
+		for name, text := range langTemplates {
+			trigger := leadingWord(text)
+			if trigger == "" {
+				continue
+			}
+			templates = append(templates, Template{
+				Language: language,
+				Name:     name,
+				Triggers: []string{trigger},
+				Body:     placeholdersToSnippet(text),
+				Source:   SourceBuiltin,
+			})
 		}
 	}
+	return templates
+}
+
+// Reload reads the templates directory again
+func (s *TemplateStore) Reload() error {
+	if s.dir == "" {
+		s.mu.Lock()
+		s.rebuild()
+		s.mu.Unlock()
+		return nil
+	}
+
+	signature, err := dirSignature(s.dir)
+	if err != nil {
+		return err
+	}
+	files, added, err := loadTemplateDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.files = files
+	s.added = added
+	s.signature = signature
+	s.rebuild()
+	s.mu.Unlock()
+
+	slog.Info("Loaded templates", "dir", s.dir, "files", len(files), "added", len(added))
+	return nil
+}
+
+// Watch reloads the templates directory whenever its files change, checking every
+// interval until ctx is done
+func (s *TemplateStore) Watch(ctx context.Context, interval time.Duration) {
+	if s.dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		signature, err := dirSignature(s.dir)
+		if err != nil {
+			slog.Warn("Failed to check templates directory", "dir", s.dir, "error", err)
+			continue
+		}
+
+		s.mu.RLock()
+		changed := signature != s.signature
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := s.Reload(); err != nil {
+			slog.Error("Failed to reload templates", "dir", s.dir, "error", err)
+		}
+	}
+}
+
+// rebuild merges the template sources into the per-language lists. The caller
+// must hold the write lock.
+func (s *TemplateStore) rebuild() {
+	type key struct{ language, name string }
+	merged := make(map[key]Template)
+	for _, source := range [][]Template{s.builtin, s.files, s.added} {
+		for _, t := range source {
+			merged[key{t.Language, t.Name}] = t
+		}
+	}
+
+	s.byLang = make(map[string][]Template)
+	for k, t := range merged {
+		s.byLang[k.language] = append(s.byLang[k.language], t)
+	}
+	for _, templates := range s.byLang {
+		sort.Slice(templates, func(i, j int) bool {
+			return templates[i].Name < templates[j].Name
+		})
+	}
+}
+
+// List returns the templates for a language, or all templates if language is empty
+func (s *TemplateStore) List(language string) []Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	// Look for more fuzzy matches
-	for pattern, template := range langTemplates {
-		if strings.Contains(prefix, pattern) {
-			return template, true
+	var languages []string
+	if language != "" {
+		languages = []string{language}
+	} else {
+		for lang := range s.byLang {
+			languages = append(languages, lang)
 		}
+		sort.Strings(languages)
+	}
+
+	templates := []Template{}
+	for _, lang := range languages {
+		templates = append(templates, s.byLang[lang]...)
+	}
+	return templates
+}
+
+// Add adds or replaces a template at runtime. Added templates are saved in the
+// templates directory, if there is one, so they survive a restart.
+func (s *TemplateStore) Add(t Template) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	t.Source = SourceAdded
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := make([]Template, 0, len(s.added)+1)
+	for _, existing := range s.added {
+		if existing.Language != t.Language || existing.Name != t.Name {
+			added = append(added, existing)
+		}
+	}
+	added = append(added, t)
+
+	if err := s.saveAdded(added); err != nil {
+		return err
+	}
+	s.added = added
+	s.rebuild()
+	return nil
+}
+
+// Remove removes a template added at runtime. Built-in and file templates can
+// only be overridden.
+func (s *TemplateStore) Remove(language, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.added {
+		if t.Language != language || t.Name != name {
+			continue
+		}
+
+		added := append(append([]Template{}, s.added[:i]...), s.added[i+1:]...)
+		if err := s.saveAdded(added); err != nil {
+			return err
+		}
+		s.added = added
+		s.rebuild()
+		return nil
+	}
+
+	for _, t := range s.byLang[language] {
+		if t.Name == name {
+			return fmt.Errorf("%w: %s/%s comes from %s", ErrTemplateReadOnly, language, name, t.Source)
+		}
+	}
+	return fmt.Errorf("%w: %s/%s", ErrTemplateNotFound, language, name)
+}
+
+// saveAdded writes the added templates to the templates directory. The caller
+// must hold the write lock.
+func (s *TemplateStore) saveAdded(added []Template) error {
+	if s.dir == "" {
+		return nil
+	}
+
+	if err := saveAddedTemplates(s.dir, added); err != nil {
+		return err
+	}
+
+	// Our own write shouldn't trigger a reload
+	signature, err := dirSignature(s.dir)
+	if err != nil {
+		return err
+	}
+	s.signature = signature
+	return nil
+}
+
+// candidates returns the templates for a language and the templates for all
+// languages, ordered for matching: longest trigger first, then templates named
+// after their trigger, then by name
+func (s *TemplateStore) candidates(language string) []templateTrigger {
+	languages := []string{language, ""}
+	if alias, ok := languageAliases[language]; ok {
+		languages = append(languages, alias)
+	}
+
+	s.mu.RLock()
+	var candidates []templateTrigger
+	for _, lang := range languages {
+		for _, t := range s.byLang[lang] {
+			for _, trigger := range t.Triggers {
+				candidates = append(candidates, templateTrigger{template: t, trigger: trigger})
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if len(a.trigger) != len(b.trigger) {
+			return len(a.trigger) > len(b.trigger)
+		}
+		if (a.template.Name == a.trigger) != (b.template.Name == b.trigger) {
+			return a.template.Name == a.trigger
+		}
+		if a.template.Name != b.template.Name {
+			return a.template.Name < b.template.Name
+		}
+		return a.template.Language < b.template.Language
+	})
+	return candidates
+}
+
+// templateTrigger pairs a template with one of its triggers
+type templateTrigger struct {
+	template Template
+	trigger  string
+}
+
+// builtinStore matches the built-in templates for FindTemplate
+var builtinStore = sync.OnceValue(func() *TemplateStore {
+	store, _ := NewTemplateStore("")
+	return store
+})
+
+// FindTemplate looks for a suitable built-in template based on a prefix and
+// language and returns the text it completes the prefix with
+func FindTemplate(prefix string, language string) (string, bool) {
+	// Default to "go" if language not specified
+	if language == "" {
+		language = "go"
 	}
 
-	return "", false
+	snippet, ok := builtinStore().FindSnippet(prefix, language)
+	return snippet.Text, ok
 }
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplateStoreLoadsFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.json"), `{
+		// Comments are allowed like in VS Code snippet files
+		"for index": {
+			"prefix": ["fori"],
+			"body": ["for ${1:i} := 0; $1 < ${2:n}; $1++ {", "\t$0", "}"]
+		},
+		"if": {"prefix": "if", "body": "if ${1:CONDITION} != nil {\n\t$0\n}"}
+	}`)
+	writeFile(t, filepath.Join(dir, "python.yaml"), "main:\n  prefix: ifmain\n  body: |-\n    if __name__ == \"__main__\":\n        ${1:main()}\n")
+
+	store, err := NewTemplateStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create template store: %v", err)
+	}
+
+	// Templates that don't start with their trigger replace it
+	snippet, ok := store.FindSnippet("x := 1\nfori", "go")
+	if !ok || snippet.Name != "for index" {
+		t.Fatalf("Expected the for index template, got %q (ok=%v)", snippet.Name, ok)
+	}
+	if snippet.Replace != len("fori") {
+		t.Errorf("Expected the trigger to be replaced, got replace=%d", snippet.Replace)
+	}
+	if want := "for i := 0; i < n; i++ {\n\t\n}"; snippet.Text != want {
+		t.Errorf("Expected text %q, got %q", want, snippet.Text)
+	}
+
+	// File templates override built-in ones with the same name
+	snippet, ok = store.FindSnippet("x := 1\nif", "go")
+	if !ok || snippet.Text != " x != nil {\n\t\n}" {
+		t.Errorf("Expected the file if template, got %q (ok=%v)", snippet.Text, ok)
+	}
+
+	if snippet, ok := store.FindSnippet("ifmain", "python"); !ok || snippet.Name != "main" {
+		t.Errorf("Expected the YAML main template, got %q (ok=%v)", snippet.Name, ok)
+	}
+}
+
+func TestTemplateStoreMatchesLongestTrigger(t *testing.T) {
+	store, err := NewTemplateStore("")
+	if err != nil {
+		t.Fatalf("Failed to create template store: %v", err)
+	}
+
+	for _, tmpl := range []Template{
+		{Language: "go", Name: "a", Triggers: []string{"!"}, Body: "short"},
+		{Language: "go", Name: "b", Triggers: []string{"!!"}, Body: "long"},
+	} {
+		if err := store.Add(tmpl); err != nil {
+			t.Fatalf("Failed to add template: %v", err)
+		}
+	}
+
+	// The result must not depend on map iteration order
+	for i := 0; i < 20; i++ {
+		snippet, ok := store.FindSnippet("x!!", "go")
+		if !ok || snippet.Text != "long" {
+			t.Fatalf("Expected the longest trigger to win, got %q (ok=%v)", snippet.Text, ok)
+		}
+	}
+}
+
+func TestTemplateStoreAddRemove(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewTemplateStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create template store: %v", err)
+	}
+
+	tmpl := Template{Language: "go", Name: "todo", Triggers: []string{"todo"}, Body: "// TODO: $0"}
+	if err := store.Add(tmpl); err != nil {
+		t.Fatalf("Failed to add template: %v", err)
+	}
+
+	// Added templates are saved and loaded again
+	reloaded, err := NewTemplateStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reload template store: %v", err)
+	}
+	if _, ok := reloaded.FindSnippet("todo", "go"); !ok {
+		t.Error("Expected the added template after a reload")
+	}
+
+	if err := store.Remove("go", "todo"); err != nil {
+		t.Fatalf("Failed to remove template: %v", err)
+	}
+	if _, ok := store.FindSnippet("todo", "go"); ok {
+		t.Error("Expected the template to be removed")
+	}
+
+	if err := store.Remove("go", "todo"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+	if err := store.Remove("go", "if"); !errors.Is(err, ErrTemplateReadOnly) {
+		t.Errorf("Expected ErrTemplateReadOnly for a built-in template, got %v", err)
+	}
+}
+
+// writeFile writes a test fixture
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
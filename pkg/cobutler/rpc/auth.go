@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/rpc/cobutlerpb"
+)
+
+// methodScopes are the scopes keys need to call each method, like the matching
+// HTTP endpoints. Methods not listed need the admin scope.
+var methodScopes = map[string]string{
+	cobutlerpb.Cobutler_Predict_FullMethodName:       api.ScopePredict,
+	cobutlerpb.Cobutler_PredictStream_FullMethodName: api.ScopePredict,
+	cobutlerpb.Cobutler_Learn_FullMethodName:         api.ScopeLearn,
+	cobutlerpb.Cobutler_Forget_FullMethodName:        api.ScopeLearn,
+	cobutlerpb.Cobutler_Stats_FullMethodName:         api.ScopeAdmin,
+}
+
+// unaryAuthInterceptor rejects unary calls without a key that has the method's scope
+func unaryAuthInterceptor(config *api.AuthConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, config, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamAuthInterceptor rejects streaming calls without a key that has the method's scope
+func streamAuthInterceptor(config *api.AuthConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), config, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &deadlineStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate finds the key of a call from its authorization or x-api-key
+// metadata, falling back to its verified client certificate, and checks that the
+// key may call method. The returned context carries the key.
+func authenticate(ctx context.Context, config *api.AuthConfig, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		token = values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		if bearer, ok := strings.CutPrefix(values[0], "Bearer "); ok {
+			token = bearer
+		}
+	}
+
+	var key api.APIKey
+	var ok bool
+	if token != "" {
+		key, ok = config.AuthenticateToken(token)
+	} else if p, found := peer.FromContext(ctx); found {
+		if info, isTLS := p.AuthInfo.(credentials.TLSInfo); isTLS {
+			key, ok = config.AuthenticateCertificate(info.State.VerifiedChains)
+		}
+	}
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	scope, listed := methodScopes[method]
+	if !listed {
+		scope = api.ScopeAdmin
+	}
+	if !key.HasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "key %s lacks the %s scope", key.Name, scope)
+	}
+	return api.WithAPIKey(ctx, key), nil
+}
@@ -0,0 +1,879 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: cobutler.proto
+
+package cobutlerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LearnRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Text  string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	// Context the text was accepted as a completion for, if any
+	Context       string `protobuf:"bytes,2,opt,name=context,proto3" json:"context,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LearnRequest) Reset() {
+	*x = LearnRequest{}
+	mi := &file_cobutler_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LearnRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LearnRequest) ProtoMessage() {}
+
+func (x *LearnRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LearnRequest.ProtoReflect.Descriptor instead.
+func (*LearnRequest) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LearnRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *LearnRequest) GetContext() string {
+	if x != nil {
+		return x.Context
+	}
+	return ""
+}
+
+type LearnResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LearnResponse) Reset() {
+	*x = LearnResponse{}
+	mi := &file_cobutler_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LearnResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LearnResponse) ProtoMessage() {}
+
+func (x *LearnResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LearnResponse.ProtoReflect.Descriptor instead.
+func (*LearnResponse) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{1}
+}
+
+type PredictRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Text     string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	MaxWords int32                  `protobuf:"varint,2,opt,name=max_words,json=maxWords,proto3" json:"max_words,omitempty"`
+	UseCache bool                   `protobuf:"varint,4,opt,name=use_cache,json=useCache,proto3" json:"use_cache,omitempty"`
+	// Conditions that end the reply: "line", "statement", "scope" or "sentence"
+	Stop      []string `protobuf:"bytes,5,rep,name=stop,proto3" json:"stop,omitempty"`
+	MaxTokens int32    `protobuf:"varint,6,opt,name=max_tokens,json=maxTokens,proto3" json:"max_tokens,omitempty"`
+	// Makes the reply reproducible; without it a random seed is used
+	Seed *int64 `protobuf:"varint,7,opt,name=seed,proto3,oneof" json:"seed,omitempty"`
+	// Weights edge choices by count; 0 always takes the most frequent edge
+	Temperature *float64 `protobuf:"fixed64,8,opt,name=temperature,proto3,oneof" json:"temperature,omitempty"`
+	// "walk" for a random walk or "beam" for the most likely reply
+	Strategy  string `protobuf:"bytes,9,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	BeamWidth int32  `protobuf:"varint,10,opt,name=beam_width,json=beamWidth,proto3" json:"beam_width,omitempty"`
+	// "reply" to reply to the text or "continue" to complete it from its end
+	Mode string `protobuf:"bytes,11,opt,name=mode,proto3" json:"mode,omitempty"`
+	// Makes beam search rank replies by their mean rather than total
+	// log-probability, so longer replies aren't penalized
+	LengthNormalize bool `protobuf:"varint,12,opt,name=length_normalize,json=lengthNormalize,proto3" json:"length_normalize,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *PredictRequest) Reset() {
+	*x = PredictRequest{}
+	mi := &file_cobutler_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PredictRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PredictRequest) ProtoMessage() {}
+
+func (x *PredictRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PredictRequest.ProtoReflect.Descriptor instead.
+func (*PredictRequest) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PredictRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *PredictRequest) GetMaxWords() int32 {
+	if x != nil {
+		return x.MaxWords
+	}
+	return 0
+}
+
+func (x *PredictRequest) GetUseCache() bool {
+	if x != nil {
+		return x.UseCache
+	}
+	return false
+}
+
+func (x *PredictRequest) GetStop() []string {
+	if x != nil {
+		return x.Stop
+	}
+	return nil
+}
+
+func (x *PredictRequest) GetMaxTokens() int32 {
+	if x != nil {
+		return x.MaxTokens
+	}
+	return 0
+}
+
+func (x *PredictRequest) GetSeed() int64 {
+	if x != nil && x.Seed != nil {
+		return *x.Seed
+	}
+	return 0
+}
+
+func (x *PredictRequest) GetTemperature() float64 {
+	if x != nil && x.Temperature != nil {
+		return *x.Temperature
+	}
+	return 0
+}
+
+func (x *PredictRequest) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *PredictRequest) GetBeamWidth() int32 {
+	if x != nil {
+		return x.BeamWidth
+	}
+	return 0
+}
+
+func (x *PredictRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *PredictRequest) GetLengthNormalize() bool {
+	if x != nil {
+		return x.LengthNormalize
+	}
+	return false
+}
+
+type PredictResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Reply string                 `protobuf:"bytes,1,opt,name=reply,proto3" json:"reply,omitempty"`
+	// Why generation stopped, e.g. "statement" or "dead_end"
+	FinishReason string `protobuf:"bytes,2,opt,name=finish_reason,json=finishReason,proto3" json:"finish_reason,omitempty"`
+	// Reproduces the reply when sent back with the same request
+	Seed          int64 `protobuf:"varint,3,opt,name=seed,proto3" json:"seed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PredictResponse) Reset() {
+	*x = PredictResponse{}
+	mi := &file_cobutler_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PredictResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PredictResponse) ProtoMessage() {}
+
+func (x *PredictResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PredictResponse.ProtoReflect.Descriptor instead.
+func (*PredictResponse) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PredictResponse) GetReply() string {
+	if x != nil {
+		return x.Reply
+	}
+	return ""
+}
+
+func (x *PredictResponse) GetFinishReason() string {
+	if x != nil {
+		return x.FinishReason
+	}
+	return ""
+}
+
+func (x *PredictResponse) GetSeed() int64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+type PredictStreamResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*PredictStreamResponse_Token
+	//	*PredictStreamResponse_Done
+	Event         isPredictStreamResponse_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PredictStreamResponse) Reset() {
+	*x = PredictStreamResponse{}
+	mi := &file_cobutler_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PredictStreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PredictStreamResponse) ProtoMessage() {}
+
+func (x *PredictStreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PredictStreamResponse.ProtoReflect.Descriptor instead.
+func (*PredictStreamResponse) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PredictStreamResponse) GetEvent() isPredictStreamResponse_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *PredictStreamResponse) GetToken() string {
+	if x != nil {
+		if x, ok := x.Event.(*PredictStreamResponse_Token); ok {
+			return x.Token
+		}
+	}
+	return ""
+}
+
+func (x *PredictStreamResponse) GetDone() *PredictDone {
+	if x != nil {
+		if x, ok := x.Event.(*PredictStreamResponse_Done); ok {
+			return x.Done
+		}
+	}
+	return nil
+}
+
+type isPredictStreamResponse_Event interface {
+	isPredictStreamResponse_Event()
+}
+
+type PredictStreamResponse_Token struct {
+	// A generated token
+	Token string `protobuf:"bytes,1,opt,name=token,proto3,oneof"`
+}
+
+type PredictStreamResponse_Done struct {
+	// The final event of the stream
+	Done *PredictDone `protobuf:"bytes,2,opt,name=done,proto3,oneof"`
+}
+
+func (*PredictStreamResponse_Token) isPredictStreamResponse_Event() {}
+
+func (*PredictStreamResponse_Done) isPredictStreamResponse_Event() {}
+
+type PredictDone struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reply         string                 `protobuf:"bytes,1,opt,name=reply,proto3" json:"reply,omitempty"`
+	Score         float64                `protobuf:"fixed64,2,opt,name=score,proto3" json:"score,omitempty"`
+	StopReason    string                 `protobuf:"bytes,3,opt,name=stop_reason,json=stopReason,proto3" json:"stop_reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PredictDone) Reset() {
+	*x = PredictDone{}
+	mi := &file_cobutler_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PredictDone) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PredictDone) ProtoMessage() {}
+
+func (x *PredictDone) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PredictDone.ProtoReflect.Descriptor instead.
+func (*PredictDone) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PredictDone) GetReply() string {
+	if x != nil {
+		return x.Reply
+	}
+	return ""
+}
+
+func (x *PredictDone) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *PredictDone) GetStopReason() string {
+	if x != nil {
+		return x.StopReason
+	}
+	return ""
+}
+
+type ForgetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForgetRequest) Reset() {
+	*x = ForgetRequest{}
+	mi := &file_cobutler_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForgetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForgetRequest) ProtoMessage() {}
+
+func (x *ForgetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForgetRequest.ProtoReflect.Descriptor instead.
+func (*ForgetRequest) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ForgetRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type ForgetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForgetResponse) Reset() {
+	*x = ForgetResponse{}
+	mi := &file_cobutler_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForgetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForgetResponse) ProtoMessage() {}
+
+func (x *ForgetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForgetResponse.ProtoReflect.Descriptor instead.
+func (*ForgetResponse) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{7}
+}
+
+type StatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsRequest) Reset() {
+	*x = StatsRequest{}
+	mi := &file_cobutler_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsRequest) ProtoMessage() {}
+
+func (x *StatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
+func (*StatsRequest) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{8}
+}
+
+type StatsResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Order     int32                  `protobuf:"varint,1,opt,name=order,proto3" json:"order,omitempty"`
+	Tokens    int64                  `protobuf:"varint,2,opt,name=tokens,proto3" json:"tokens,omitempty"`
+	Nodes     int64                  `protobuf:"varint,3,opt,name=nodes,proto3" json:"nodes,omitempty"`
+	Edges     int64                  `protobuf:"varint,4,opt,name=edges,proto3" json:"edges,omitempty"`
+	Tokenizer string                 `protobuf:"bytes,5,opt,name=tokenizer,proto3" json:"tokenizer,omitempty"`
+	// Sum of all edge counts
+	EdgeWeight int64        `protobuf:"varint,6,opt,name=edge_weight,json=edgeWeight,proto3" json:"edge_weight,omitempty"`
+	TopTokens  []*Frequency `protobuf:"bytes,7,rep,name=top_tokens,json=topTokens,proto3" json:"top_tokens,omitempty"`
+	TopNgrams  []*Frequency `protobuf:"bytes,8,rep,name=top_ngrams,json=topNgrams,proto3" json:"top_ngrams,omitempty"`
+	// Sizes in bytes of the database file and its write-ahead log
+	FileSize      int64 `protobuf:"varint,9,opt,name=file_size,json=fileSize,proto3" json:"file_size,omitempty"`
+	WalSize       int64 `protobuf:"varint,10,opt,name=wal_size,json=walSize,proto3" json:"wal_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsResponse) Reset() {
+	*x = StatsResponse{}
+	mi := &file_cobutler_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsResponse) ProtoMessage() {}
+
+func (x *StatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsResponse.ProtoReflect.Descriptor instead.
+func (*StatsResponse) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StatsResponse) GetOrder() int32 {
+	if x != nil {
+		return x.Order
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetTokens() int64 {
+	if x != nil {
+		return x.Tokens
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetNodes() int64 {
+	if x != nil {
+		return x.Nodes
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetEdges() int64 {
+	if x != nil {
+		return x.Edges
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetTokenizer() string {
+	if x != nil {
+		return x.Tokenizer
+	}
+	return ""
+}
+
+func (x *StatsResponse) GetEdgeWeight() int64 {
+	if x != nil {
+		return x.EdgeWeight
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetTopTokens() []*Frequency {
+	if x != nil {
+		return x.TopTokens
+	}
+	return nil
+}
+
+func (x *StatsResponse) GetTopNgrams() []*Frequency {
+	if x != nil {
+		return x.TopNgrams
+	}
+	return nil
+}
+
+func (x *StatsResponse) GetFileSize() int64 {
+	if x != nil {
+		return x.FileSize
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetWalSize() int64 {
+	if x != nil {
+		return x.WalSize
+	}
+	return 0
+}
+
+// Frequency is a token or n-gram with the total count of the edges leading to it
+type Frequency struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Count         int64                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Frequency) Reset() {
+	*x = Frequency{}
+	mi := &file_cobutler_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Frequency) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Frequency) ProtoMessage() {}
+
+func (x *Frequency) ProtoReflect() protoreflect.Message {
+	mi := &file_cobutler_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Frequency.ProtoReflect.Descriptor instead.
+func (*Frequency) Descriptor() ([]byte, []int) {
+	return file_cobutler_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Frequency) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *Frequency) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+var File_cobutler_proto protoreflect.FileDescriptor
+
+const file_cobutler_proto_rawDesc = "" +
+	"\n" +
+	"\x0ecobutler.proto\x12\vcobutler.v1\"<\n" +
+	"\fLearnRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x18\n" +
+	"\acontext\x18\x02 \x01(\tR\acontext\"\x0f\n" +
+	"\rLearnResponse\"\xf5\x02\n" +
+	"\x0ePredictRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x1b\n" +
+	"\tmax_words\x18\x02 \x01(\x05R\bmaxWords\x12\x1b\n" +
+	"\tuse_cache\x18\x04 \x01(\bR\buseCache\x12\x12\n" +
+	"\x04stop\x18\x05 \x03(\tR\x04stop\x12\x1d\n" +
+	"\n" +
+	"max_tokens\x18\x06 \x01(\x05R\tmaxTokens\x12\x17\n" +
+	"\x04seed\x18\a \x01(\x03H\x00R\x04seed\x88\x01\x01\x12%\n" +
+	"\vtemperature\x18\b \x01(\x01H\x01R\vtemperature\x88\x01\x01\x12\x1a\n" +
+	"\bstrategy\x18\t \x01(\tR\bstrategy\x12\x1d\n" +
+	"\n" +
+	"beam_width\x18\n" +
+	" \x01(\x05R\tbeamWidth\x12\x12\n" +
+	"\x04mode\x18\v \x01(\tR\x04mode\x12)\n" +
+	"\x10length_normalize\x18\f \x01(\bR\x0flengthNormalizeB\a\n" +
+	"\x05_seedB\x0e\n" +
+	"\f_temperatureJ\x04\b\x03\x10\x04R\tprecision\"`\n" +
+	"\x0fPredictResponse\x12\x14\n" +
+	"\x05reply\x18\x01 \x01(\tR\x05reply\x12#\n" +
+	"\rfinish_reason\x18\x02 \x01(\tR\ffinishReason\x12\x12\n" +
+	"\x04seed\x18\x03 \x01(\x03R\x04seed\"h\n" +
+	"\x15PredictStreamResponse\x12\x16\n" +
+	"\x05token\x18\x01 \x01(\tH\x00R\x05token\x12.\n" +
+	"\x04done\x18\x02 \x01(\v2\x18.cobutler.v1.PredictDoneH\x00R\x04doneB\a\n" +
+	"\x05event\"Z\n" +
+	"\vPredictDone\x12\x14\n" +
+	"\x05reply\x18\x01 \x01(\tR\x05reply\x12\x14\n" +
+	"\x05score\x18\x02 \x01(\x01R\x05score\x12\x1f\n" +
+	"\vstop_reason\x18\x03 \x01(\tR\n" +
+	"stopReason\"#\n" +
+	"\rForgetRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\"\x10\n" +
+	"\x0eForgetResponse\"\x0e\n" +
+	"\fStatsRequest\"\xce\x02\n" +
+	"\rStatsResponse\x12\x14\n" +
+	"\x05order\x18\x01 \x01(\x05R\x05order\x12\x16\n" +
+	"\x06tokens\x18\x02 \x01(\x03R\x06tokens\x12\x14\n" +
+	"\x05nodes\x18\x03 \x01(\x03R\x05nodes\x12\x14\n" +
+	"\x05edges\x18\x04 \x01(\x03R\x05edges\x12\x1c\n" +
+	"\ttokenizer\x18\x05 \x01(\tR\ttokenizer\x12\x1f\n" +
+	"\vedge_weight\x18\x06 \x01(\x03R\n" +
+	"edgeWeight\x125\n" +
+	"\n" +
+	"top_tokens\x18\a \x03(\v2\x16.cobutler.v1.FrequencyR\ttopTokens\x125\n" +
+	"\n" +
+	"top_ngrams\x18\b \x03(\v2\x16.cobutler.v1.FrequencyR\ttopNgrams\x12\x1b\n" +
+	"\tfile_size\x18\t \x01(\x03R\bfileSize\x12\x19\n" +
+	"\bwal_size\x18\n" +
+	" \x01(\x03R\awalSize\"5\n" +
+	"\tFrequency\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x03R\x05count2\xe7\x02\n" +
+	"\bCobutler\x12>\n" +
+	"\x05Learn\x12\x19.cobutler.v1.LearnRequest\x1a\x1a.cobutler.v1.LearnResponse\x12D\n" +
+	"\aPredict\x12\x1b.cobutler.v1.PredictRequest\x1a\x1c.cobutler.v1.PredictResponse\x12R\n" +
+	"\rPredictStream\x12\x1b.cobutler.v1.PredictRequest\x1a\".cobutler.v1.PredictStreamResponse0\x01\x12A\n" +
+	"\x06Forget\x12\x1a.cobutler.v1.ForgetRequest\x1a\x1b.cobutler.v1.ForgetResponse\x12>\n" +
+	"\x05Stats\x12\x19.cobutler.v1.StatsRequest\x1a\x1a.cobutler.v1.StatsResponseB<Z:github.com/kirkegaard/cobutler/pkg/cobutler/rpc/cobutlerpbb\x06proto3"
+
+var (
+	file_cobutler_proto_rawDescOnce sync.Once
+	file_cobutler_proto_rawDescData []byte
+)
+
+func file_cobutler_proto_rawDescGZIP() []byte {
+	file_cobutler_proto_rawDescOnce.Do(func() {
+		file_cobutler_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_cobutler_proto_rawDesc), len(file_cobutler_proto_rawDesc)))
+	})
+	return file_cobutler_proto_rawDescData
+}
+
+var file_cobutler_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_cobutler_proto_goTypes = []any{
+	(*LearnRequest)(nil),          // 0: cobutler.v1.LearnRequest
+	(*LearnResponse)(nil),         // 1: cobutler.v1.LearnResponse
+	(*PredictRequest)(nil),        // 2: cobutler.v1.PredictRequest
+	(*PredictResponse)(nil),       // 3: cobutler.v1.PredictResponse
+	(*PredictStreamResponse)(nil), // 4: cobutler.v1.PredictStreamResponse
+	(*PredictDone)(nil),           // 5: cobutler.v1.PredictDone
+	(*ForgetRequest)(nil),         // 6: cobutler.v1.ForgetRequest
+	(*ForgetResponse)(nil),        // 7: cobutler.v1.ForgetResponse
+	(*StatsRequest)(nil),          // 8: cobutler.v1.StatsRequest
+	(*StatsResponse)(nil),         // 9: cobutler.v1.StatsResponse
+	(*Frequency)(nil),             // 10: cobutler.v1.Frequency
+}
+var file_cobutler_proto_depIdxs = []int32{
+	5,  // 0: cobutler.v1.PredictStreamResponse.done:type_name -> cobutler.v1.PredictDone
+	10, // 1: cobutler.v1.StatsResponse.top_tokens:type_name -> cobutler.v1.Frequency
+	10, // 2: cobutler.v1.StatsResponse.top_ngrams:type_name -> cobutler.v1.Frequency
+	0,  // 3: cobutler.v1.Cobutler.Learn:input_type -> cobutler.v1.LearnRequest
+	2,  // 4: cobutler.v1.Cobutler.Predict:input_type -> cobutler.v1.PredictRequest
+	2,  // 5: cobutler.v1.Cobutler.PredictStream:input_type -> cobutler.v1.PredictRequest
+	6,  // 6: cobutler.v1.Cobutler.Forget:input_type -> cobutler.v1.ForgetRequest
+	8,  // 7: cobutler.v1.Cobutler.Stats:input_type -> cobutler.v1.StatsRequest
+	1,  // 8: cobutler.v1.Cobutler.Learn:output_type -> cobutler.v1.LearnResponse
+	3,  // 9: cobutler.v1.Cobutler.Predict:output_type -> cobutler.v1.PredictResponse
+	4,  // 10: cobutler.v1.Cobutler.PredictStream:output_type -> cobutler.v1.PredictStreamResponse
+	7,  // 11: cobutler.v1.Cobutler.Forget:output_type -> cobutler.v1.ForgetResponse
+	9,  // 12: cobutler.v1.Cobutler.Stats:output_type -> cobutler.v1.StatsResponse
+	8,  // [8:13] is the sub-list for method output_type
+	3,  // [3:8] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_cobutler_proto_init() }
+func file_cobutler_proto_init() {
+	if File_cobutler_proto != nil {
+		return
+	}
+	file_cobutler_proto_msgTypes[2].OneofWrappers = []any{}
+	file_cobutler_proto_msgTypes[4].OneofWrappers = []any{
+		(*PredictStreamResponse_Token)(nil),
+		(*PredictStreamResponse_Done)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_cobutler_proto_rawDesc), len(file_cobutler_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_cobutler_proto_goTypes,
+		DependencyIndexes: file_cobutler_proto_depIdxs,
+		MessageInfos:      file_cobutler_proto_msgTypes,
+	}.Build()
+	File_cobutler_proto = out.File
+	file_cobutler_proto_goTypes = nil
+	file_cobutler_proto_depIdxs = nil
+}
@@ -0,0 +1,291 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: cobutler.proto
+
+package cobutlerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Cobutler_Learn_FullMethodName         = "/cobutler.v1.Cobutler/Learn"
+	Cobutler_Predict_FullMethodName       = "/cobutler.v1.Cobutler/Predict"
+	Cobutler_PredictStream_FullMethodName = "/cobutler.v1.Cobutler/PredictStream"
+	Cobutler_Forget_FullMethodName        = "/cobutler.v1.Cobutler/Forget"
+	Cobutler_Stats_FullMethodName         = "/cobutler.v1.Cobutler/Stats"
+)
+
+// CobutlerClient is the client API for Cobutler service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Cobutler exposes a brain for learning and prediction
+type CobutlerClient interface {
+	// Learn trains the brain with new text
+	Learn(ctx context.Context, in *LearnRequest, opts ...grpc.CallOption) (*LearnResponse, error)
+	// Predict generates a reply for the given text
+	Predict(ctx context.Context, in *PredictRequest, opts ...grpc.CallOption) (*PredictResponse, error)
+	// PredictStream sends reply tokens while they are generated
+	PredictStream(ctx context.Context, in *PredictRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PredictStreamResponse], error)
+	// Forget removes previously learned text from the brain
+	Forget(ctx context.Context, in *ForgetRequest, opts ...grpc.CallOption) (*ForgetResponse, error)
+	// Stats reports the size of the brain
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+}
+
+type cobutlerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCobutlerClient(cc grpc.ClientConnInterface) CobutlerClient {
+	return &cobutlerClient{cc}
+}
+
+func (c *cobutlerClient) Learn(ctx context.Context, in *LearnRequest, opts ...grpc.CallOption) (*LearnResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LearnResponse)
+	err := c.cc.Invoke(ctx, Cobutler_Learn_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cobutlerClient) Predict(ctx context.Context, in *PredictRequest, opts ...grpc.CallOption) (*PredictResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PredictResponse)
+	err := c.cc.Invoke(ctx, Cobutler_Predict_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cobutlerClient) PredictStream(ctx context.Context, in *PredictRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PredictStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Cobutler_ServiceDesc.Streams[0], Cobutler_PredictStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PredictRequest, PredictStreamResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Cobutler_PredictStreamClient = grpc.ServerStreamingClient[PredictStreamResponse]
+
+func (c *cobutlerClient) Forget(ctx context.Context, in *ForgetRequest, opts ...grpc.CallOption) (*ForgetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ForgetResponse)
+	err := c.cc.Invoke(ctx, Cobutler_Forget_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cobutlerClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, Cobutler_Stats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CobutlerServer is the server API for Cobutler service.
+// All implementations must embed UnimplementedCobutlerServer
+// for forward compatibility.
+//
+// Cobutler exposes a brain for learning and prediction
+type CobutlerServer interface {
+	// Learn trains the brain with new text
+	Learn(context.Context, *LearnRequest) (*LearnResponse, error)
+	// Predict generates a reply for the given text
+	Predict(context.Context, *PredictRequest) (*PredictResponse, error)
+	// PredictStream sends reply tokens while they are generated
+	PredictStream(*PredictRequest, grpc.ServerStreamingServer[PredictStreamResponse]) error
+	// Forget removes previously learned text from the brain
+	Forget(context.Context, *ForgetRequest) (*ForgetResponse, error)
+	// Stats reports the size of the brain
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	mustEmbedUnimplementedCobutlerServer()
+}
+
+// UnimplementedCobutlerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCobutlerServer struct{}
+
+func (UnimplementedCobutlerServer) Learn(context.Context, *LearnRequest) (*LearnResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Learn not implemented")
+}
+func (UnimplementedCobutlerServer) Predict(context.Context, *PredictRequest) (*PredictResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Predict not implemented")
+}
+func (UnimplementedCobutlerServer) PredictStream(*PredictRequest, grpc.ServerStreamingServer[PredictStreamResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method PredictStream not implemented")
+}
+func (UnimplementedCobutlerServer) Forget(context.Context, *ForgetRequest) (*ForgetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Forget not implemented")
+}
+func (UnimplementedCobutlerServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedCobutlerServer) mustEmbedUnimplementedCobutlerServer() {}
+func (UnimplementedCobutlerServer) testEmbeddedByValue()                  {}
+
+// UnsafeCobutlerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CobutlerServer will
+// result in compilation errors.
+type UnsafeCobutlerServer interface {
+	mustEmbedUnimplementedCobutlerServer()
+}
+
+func RegisterCobutlerServer(s grpc.ServiceRegistrar, srv CobutlerServer) {
+	// If the following call pancis, it indicates UnimplementedCobutlerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Cobutler_ServiceDesc, srv)
+}
+
+func _Cobutler_Learn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LearnRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CobutlerServer).Learn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cobutler_Learn_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CobutlerServer).Learn(ctx, req.(*LearnRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cobutler_Predict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PredictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CobutlerServer).Predict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cobutler_Predict_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CobutlerServer).Predict(ctx, req.(*PredictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cobutler_PredictStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PredictRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CobutlerServer).PredictStream(m, &grpc.GenericServerStream[PredictRequest, PredictStreamResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Cobutler_PredictStreamServer = grpc.ServerStreamingServer[PredictStreamResponse]
+
+func _Cobutler_Forget_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForgetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CobutlerServer).Forget(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cobutler_Forget_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CobutlerServer).Forget(ctx, req.(*ForgetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cobutler_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CobutlerServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Cobutler_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CobutlerServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Cobutler_ServiceDesc is the grpc.ServiceDesc for Cobutler service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Cobutler_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cobutler.v1.Cobutler",
+	HandlerType: (*CobutlerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Learn",
+			Handler:    _Cobutler_Learn_Handler,
+		},
+		{
+			MethodName: "Predict",
+			Handler:    _Cobutler_Predict_Handler,
+		},
+		{
+			MethodName: "Forget",
+			Handler:    _Cobutler_Forget_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _Cobutler_Stats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PredictStream",
+			Handler:       _Cobutler_PredictStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "cobutler.proto",
+}
@@ -0,0 +1,4 @@
+// Package cobutlerpb contains the protobuf messages and gRPC service generated from cobutler.proto
+package cobutlerpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative cobutler.proto
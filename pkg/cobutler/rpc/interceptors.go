@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// unaryLoggingInterceptor logs every unary call with its duration and status code
+func unaryLoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(info.FullMethod, start, err)
+	return resp, err
+}
+
+// streamLoggingInterceptor logs every streaming call with its duration and status code
+func streamLoggingInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(info.FullMethod, start, err)
+	return err
+}
+
+// logCall writes a single log line for a finished call
+func logCall(method string, start time.Time, err error) {
+	code := status.Code(err)
+	if err != nil {
+		slog.Warn("gRPC call failed", "method", method, "code", code.String(), "duration", time.Since(start), "error", err)
+		return
+	}
+	slog.Info("gRPC call succeeded", "method", method, "code", code.String(), "duration", time.Since(start))
+}
+
+// unaryDeadlineInterceptor applies a default deadline to unary calls that have none
+func unaryDeadlineInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamDeadlineInterceptor applies a default deadline to streaming calls that have none
+func streamDeadlineInterceptor(timeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if _, ok := ss.Context().Deadline(); ok {
+			return handler(srv, ss)
+		}
+
+		ctx, cancel := context.WithTimeout(ss.Context(), timeout)
+		defer cancel()
+		return handler(srv, &deadlineStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// deadlineStream overrides the context of a server stream
+type deadlineStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream context with the applied deadline
+func (s *deadlineStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/metrics"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/rpc/cobutlerpb"
+)
+
+// unaryRateLimitInterceptor rejects unary calls over their client's rate for the
+// method's scope. Learn requests count their size against the learn quota.
+func unaryRateLimitInterceptor(limiter *api.RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var size int64
+		if msg, ok := req.(proto.Message); ok && info.FullMethod == cobutlerpb.Cobutler_Learn_FullMethodName {
+			size = int64(proto.Size(msg))
+		}
+		if err := allow(ctx, limiter, info.FullMethod, size); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamRateLimitInterceptor rejects streaming calls over their client's rate for
+// the method's scope
+func streamRateLimitInterceptor(limiter *api.RateLimiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(ss.Context(), limiter, info.FullMethod, 0); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// allow takes a call to method from its client's limits, like the HTTP rate
+// limits. Rejected calls get a retry-after header with the seconds to wait.
+func allow(ctx context.Context, limiter *api.RateLimiter, method string, size int64) error {
+	scope, listed := methodScopes[method]
+	if !listed || scope == api.ScopeAdmin {
+		return nil
+	}
+
+	client := clientID(ctx)
+	retryAfter, ok := limiter.Allow(client, scope, size)
+	if ok {
+		return nil
+	}
+
+	metrics.RateLimited.WithLabelValues(scope).Inc()
+	slog.Warn("Rate limited", "client", client, "scope", scope, "method", method, "retry_after", retryAfter)
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", seconds))
+	return status.Errorf(codes.ResourceExhausted, "too many requests, retry after %s", retryAfter.Round(time.Second))
+}
+
+// clientID identifies the client of a call by its API key, or by its IP address
+// for unauthenticated calls
+func clientID(ctx context.Context) string {
+	if key, ok := api.APIKeyFromContext(ctx); ok {
+		return "key:" + key.Name
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "ip:"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
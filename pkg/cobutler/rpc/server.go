@@ -0,0 +1,296 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/db"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/rpc/cobutlerpb"
+)
+
+// defaultDeadline bounds calls that arrive without a deadline of their own
+const defaultDeadline = 30 * time.Second
+
+// Service implements the Cobutler gRPC service on top of the API handler
+type Service struct {
+	cobutlerpb.UnimplementedCobutlerServer
+	handler *api.Handler
+	// namespaces serve calls whose key has a namespace
+	namespaces map[string]*api.Handler
+}
+
+// NewService creates a new Service backed by the given handler
+func NewService(handler *api.Handler) *Service {
+	return &Service{
+		handler: handler,
+	}
+}
+
+// handlerFor returns the handler serving a call: its key's namespace handler,
+// or the default one
+func (s *Service) handlerFor(ctx context.Context) (*api.Handler, error) {
+	key, _ := api.APIKeyFromContext(ctx)
+	if key.Namespace == "" {
+		return s.handler, nil
+	}
+	handler, ok := s.namespaces[key.Namespace]
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "no brain for namespace %s", key.Namespace)
+	}
+	return handler, nil
+}
+
+// Learn trains the brain with new text
+func (s *Service) Learn(ctx context.Context, req *cobutlerpb.LearnRequest) (*cobutlerpb.LearnResponse, error) {
+	handler, err := s.handlerFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Text is learned like the HTTP handler learns it, through the learn queue
+	if _, err := handler.LearnText(ctx, req.GetText(), req.GetContext()); err != nil {
+		return nil, statusFromError(err, "failed to learn")
+	}
+
+	return &cobutlerpb.LearnResponse{}, nil
+}
+
+// Predict generates a reply for the given text
+func (s *Service) Predict(ctx context.Context, req *cobutlerpb.PredictRequest) (*cobutlerpb.PredictResponse, error) {
+	handler, err := s.handlerFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	completion, err := handler.Complete(ctx, payloadFromRequest(req))
+	if err != nil {
+		return nil, statusFromError(err, "failed to generate reply")
+	}
+
+	return &cobutlerpb.PredictResponse{
+		Reply:        completion.Reply,
+		FinishReason: completion.FinishReason,
+		Seed:         completion.Seed,
+	}, nil
+}
+
+// PredictStream sends reply tokens while they are generated, followed by a final done event
+func (s *Service) PredictStream(req *cobutlerpb.PredictRequest, stream cobutlerpb.Cobutler_PredictStreamServer) error {
+	handler, err := s.handlerFor(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	done, err := handler.StreamReply(stream.Context(), payloadFromRequest(req), func(token string) error {
+		return stream.Send(&cobutlerpb.PredictStreamResponse{
+			Event: &cobutlerpb.PredictStreamResponse_Token{Token: token},
+		})
+	})
+	if err != nil {
+		return statusFromError(err, "failed to generate reply")
+	}
+
+	return stream.Send(&cobutlerpb.PredictStreamResponse{
+		Event: &cobutlerpb.PredictStreamResponse_Done{Done: &cobutlerpb.PredictDone{
+			Reply:      done.Reply,
+			Score:      done.Score,
+			StopReason: done.StopReason,
+		}},
+	})
+}
+
+// Forget removes previously learned text from the brain
+func (s *Service) Forget(ctx context.Context, req *cobutlerpb.ForgetRequest) (*cobutlerpb.ForgetResponse, error) {
+	handler, err := s.handlerFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	forgetter, ok := handler.Brain.(api.ForgettingBrain)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "brain does not support forgetting")
+	}
+
+	if err := forgetter.Forget(req.GetText()); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to forget: %v", err)
+	}
+
+	return &cobutlerpb.ForgetResponse{}, nil
+}
+
+// Stats reports the size of the brain
+func (s *Service) Stats(ctx context.Context, req *cobutlerpb.StatsRequest) (*cobutlerpb.StatsResponse, error) {
+	handler, err := s.handlerFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statsBrain, ok := handler.Brain.(api.StatsBrain)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "brain does not report statistics")
+	}
+
+	stats, err := statsBrain.Stats()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get stats: %v", err)
+	}
+
+	return &cobutlerpb.StatsResponse{
+		Order:      int32(stats.Order),
+		Tokens:     stats.Tokens,
+		Nodes:      stats.Nodes,
+		Edges:      stats.Edges,
+		Tokenizer:  stats.Tokenizer,
+		EdgeWeight: stats.EdgeWeight,
+		TopTokens:  frequenciesToProto(stats.TopTokens),
+		TopNgrams:  frequenciesToProto(stats.TopNgrams),
+		FileSize:   stats.FileSize,
+		WalSize:    stats.WALSize,
+	}, nil
+}
+
+// frequenciesToProto converts token or n-gram frequencies into their messages
+func frequenciesToProto(frequencies []db.Frequency) []*cobutlerpb.Frequency {
+	messages := make([]*cobutlerpb.Frequency, len(frequencies))
+	for i, f := range frequencies {
+		messages[i] = &cobutlerpb.Frequency{Text: f.Text, Count: f.Count}
+	}
+	return messages
+}
+
+// payloadFromRequest converts a gRPC predict request into the API payload
+func payloadFromRequest(req *cobutlerpb.PredictRequest) api.RequestPayload {
+	return api.RequestPayload{
+		Text:            req.GetText(),
+		MaxWords:        int(req.GetMaxWords()),
+		Temperature:     req.Temperature,
+		UseCache:        req.GetUseCache(),
+		Stop:            req.GetStop(),
+		MaxTokens:       int(req.GetMaxTokens()),
+		Seed:            req.Seed,
+		Strategy:        req.GetStrategy(),
+		BeamWidth:       int(req.GetBeamWidth()),
+		LengthNormalize: req.GetLengthNormalize(),
+		Mode:            req.GetMode(),
+	}
+}
+
+// statusFromError maps context errors and invalid requests to their gRPC codes and
+// everything else to Internal
+func statusFromError(err error, message string) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, api.ErrUnknownStrategy), errors.Is(err, api.ErrUnknownMode):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, api.ErrLearnQueueFull), errors.Is(err, api.ErrLearnQueueClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", message, err)
+	}
+}
+
+// Config configures the optional features of a Server
+type Config struct {
+	// Auth requires calls to send a key as "authorization: Bearer <key>" or
+	// "x-api-key" metadata, or to present a verified client certificate. Its TLS
+	// settings serve the API over TLS.
+	Auth *api.AuthConfig
+	// Namespaces serve calls whose key has a namespace
+	Namespaces map[string]*api.Handler
+	// RateLimits limits how fast each client calls, per key or per IP address
+	// without auth. Sharing the HTTP server's limiter applies the same limits
+	// across both APIs.
+	RateLimits *api.RateLimiter
+}
+
+// Server serves the gRPC API next to the HTTP server
+type Server struct {
+	server   *grpc.Server
+	addr     string
+	listener net.Listener
+}
+
+// NewServer creates a new gRPC server with the given handler, listening on addr,
+// like ":9090". Requests are limited to the size of HTTP request bodies.
+func NewServer(handler *api.Handler, addr string, config Config) (*Server, error) {
+	unary := []grpc.UnaryServerInterceptor{unaryDeadlineInterceptor(defaultDeadline), unaryLoggingInterceptor}
+	stream := []grpc.StreamServerInterceptor{streamDeadlineInterceptor(defaultDeadline), streamLoggingInterceptor}
+	options := []grpc.ServerOption{grpc.MaxRecvMsgSize(api.DefaultMaxBodyBytes)}
+	if config.Auth != nil {
+		unary = append(unary, unaryAuthInterceptor(config.Auth))
+		stream = append(stream, streamAuthInterceptor(config.Auth))
+		if config.Auth.TLS.CertFile != "" {
+			tlsConfig, err := config.Auth.TLS.ServerTLSConfig()
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+	}
+	if config.RateLimits != nil {
+		unary = append(unary, unaryRateLimitInterceptor(config.RateLimits))
+		stream = append(stream, streamRateLimitInterceptor(config.RateLimits))
+	}
+	options = append(options, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+
+	service := NewService(handler)
+	service.namespaces = config.Namespaces
+	server := grpc.NewServer(options...)
+	cobutlerpb.RegisterCobutlerServer(server, service)
+
+	return &Server{
+		server: server,
+		addr:   addr,
+	}, nil
+}
+
+// Start starts the server in a goroutine
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("gRPC server failed to listen: %w", err)
+	}
+	s.listener = listener
+
+	go func() {
+		slog.Info("gRPC server starting", "addr", listener.Addr().String())
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			slog.Error("gRPC server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Stop gracefully shuts down the server, forcing a stop when ctx expires
+func (s *Server) Stop(ctx context.Context) error {
+	slog.Info("Shutting down gRPC server...")
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.server.Stop()
+		return fmt.Errorf("gRPC server shutdown failed: %w", ctx.Err())
+	}
+
+	slog.Info("gRPC server stopped")
+	return nil
+}
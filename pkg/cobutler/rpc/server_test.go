@@ -0,0 +1,269 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/kirkegaard/cobutler/pkg/cobutler/api"
+	"github.com/kirkegaard/cobutler/pkg/cobutler/rpc/cobutlerpb"
+)
+
+// mockBrain is a mock implementation of the Brain for testing
+type mockBrain struct{}
+
+func (m *mockBrain) Reply(text string) (string, error) {
+	return "instant mock reply for: " + text, nil
+}
+
+func (m *mockBrain) Learn(text string) error {
+	return nil
+}
+
+func (m *mockBrain) RememberCompletion(context, completion string) {}
+
+func (m *mockBrain) EnableCache() {}
+
+func (m *mockBrain) DisableCache() {}
+
+func (m *mockBrain) Close() error {
+	return nil
+}
+
+// newTestClient serves the service over an in-memory listener and returns a client for it
+func newTestClient(t *testing.T) cobutlerpb.CobutlerClient {
+	t.Helper()
+	return newTestClientWithConfig(t, Config{})
+}
+
+// newTestClientWithConfig is newTestClient for a server configured with config
+func newTestClientWithConfig(t *testing.T, config Config) cobutlerpb.CobutlerClient {
+	t.Helper()
+	return newTestClientWithHandler(t, api.NewHandler(&mockBrain{}), config)
+}
+
+// newTestClientWithHandler is newTestClientWithConfig for a server backed by handler
+func newTestClientWithHandler(t *testing.T, handler *api.Handler, config Config) cobutlerpb.CobutlerClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server, err := NewServer(handler, "localhost:0", config)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	go server.server.Serve(listener)
+	t.Cleanup(server.server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return cobutlerpb.NewCobutlerClient(conn)
+}
+
+func TestPredict(t *testing.T) {
+	client := newTestClient(t)
+
+	resp, err := client.Predict(context.Background(), &cobutlerpb.PredictRequest{Text: "Test input"})
+	if err != nil {
+		t.Fatalf("Predict failed: %v", err)
+	}
+
+	expectedReply := "instant mock reply for: Test input"
+	if resp.GetReply() != expectedReply {
+		t.Errorf("Expected reply %q, got %q", expectedReply, resp.GetReply())
+	}
+}
+
+// beamBrain records the options of its beam search replies
+type beamBrain struct {
+	mockBrain
+	opts api.BeamReplyOptions
+}
+
+func (b *beamBrain) ReplyBeam(ctx context.Context, text string, opts api.BeamReplyOptions) (string, api.StreamResult, error) {
+	b.opts = opts
+	return "beam reply", api.StreamResult{}, nil
+}
+
+func TestPredictBeam(t *testing.T) {
+	brain := &beamBrain{}
+	client := newTestClientWithHandler(t, api.NewHandler(brain), Config{})
+
+	resp, err := client.Predict(context.Background(), &cobutlerpb.PredictRequest{
+		Text:            "Test input",
+		Strategy:        api.StrategyBeam,
+		BeamWidth:       4,
+		LengthNormalize: true,
+	})
+	if err != nil {
+		t.Fatalf("Predict failed: %v", err)
+	}
+	if resp.GetReply() != "beam reply" {
+		t.Errorf("Expected the beam reply, got %q", resp.GetReply())
+	}
+	if brain.opts.Width != 4 || !brain.opts.LengthNormalize {
+		t.Errorf("Expected width 4 with length normalization, got %+v", brain.opts)
+	}
+}
+
+func TestPredictStream(t *testing.T) {
+	client := newTestClient(t)
+
+	stream, err := client.PredictStream(context.Background(), &cobutlerpb.PredictRequest{Text: "Test input", MaxWords: 2})
+	if err != nil {
+		t.Fatalf("PredictStream failed: %v", err)
+	}
+
+	var tokens []string
+	var done *cobutlerpb.PredictDone
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to receive: %v", err)
+		}
+		if token, ok := resp.GetEvent().(*cobutlerpb.PredictStreamResponse_Token); ok {
+			tokens = append(tokens, token.Token)
+		}
+		if resp.GetDone() != nil {
+			done = resp.GetDone()
+		}
+	}
+
+	if len(tokens) != 2 {
+		t.Errorf("Expected 2 tokens, got %d", len(tokens))
+	}
+	if done == nil || done.GetReply() != "instant mock" || done.GetStopReason() != api.StopReasonMaxWords {
+		t.Errorf("Unexpected done event: %v", done)
+	}
+}
+
+func TestForgetUnimplemented(t *testing.T) {
+	client := newTestClient(t)
+
+	_, err := client.Forget(context.Background(), &cobutlerpb.ForgetRequest{Text: "Test input"})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("Expected code %v, got %v", codes.Unimplemented, status.Code(err))
+	}
+}
+
+func TestAuth(t *testing.T) {
+	client := newTestClientWithConfig(t, Config{Auth: &api.AuthConfig{
+		Keys: []api.APIKey{{Name: "editor", Key: "editor-key", Scopes: []string{api.ScopePredict}}},
+	}})
+
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+key)
+	}
+	predict := &cobutlerpb.PredictRequest{Text: "Test input"}
+
+	if _, err := client.Predict(context.Background(), predict); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected code %v without a key, got %v", codes.Unauthenticated, status.Code(err))
+	}
+	if _, err := client.Predict(withKey("nope"), predict); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected code %v for an unknown key, got %v", codes.Unauthenticated, status.Code(err))
+	}
+	if _, err := client.Predict(withKey("editor-key"), predict); err != nil {
+		t.Errorf("Expected a key with the predict scope to predict, got %v", err)
+	}
+	if _, err := client.Learn(withKey("editor-key"), &cobutlerpb.LearnRequest{Text: "hello"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected code %v without the learn scope, got %v", codes.PermissionDenied, status.Code(err))
+	}
+
+	// Streams are checked too
+	stream, err := client.PredictStream(context.Background(), predict)
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected code %v for a stream without a key, got %v", codes.Unauthenticated, status.Code(err))
+	}
+}
+
+// learningBrain records the texts it learns
+type learningBrain struct {
+	mockBrain
+	mu      sync.Mutex
+	learned []string
+}
+
+func (b *learningBrain) Learn(text string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.learned = append(b.learned, text)
+	return nil
+}
+
+func TestLearnQueued(t *testing.T) {
+	brain := &learningBrain{}
+	handler := api.NewHandler(brain)
+	handler.Queue = api.NewLearnQueue(brain, api.LearnQueueConfig{})
+	client := newTestClientWithHandler(t, handler, Config{})
+
+	if _, err := client.Learn(context.Background(), &cobutlerpb.LearnRequest{Text: "hello world"}); err != nil {
+		t.Fatalf("Learn failed: %v", err)
+	}
+	if err := handler.Queue.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to flush the learn queue: %v", err)
+	}
+
+	brain.mu.Lock()
+	defer brain.mu.Unlock()
+	if len(brain.learned) != 1 || brain.learned[0] != "hello world" {
+		t.Errorf("Expected the queue to learn the text, got %q", brain.learned)
+	}
+
+	// A closed queue answers as unavailable
+	if _, err := client.Learn(context.Background(), &cobutlerpb.LearnRequest{Text: "again"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected code %v from a closed queue, got %v", codes.Unavailable, status.Code(err))
+	}
+}
+
+func TestLearnLimits(t *testing.T) {
+	client := newTestClientWithConfig(t, Config{RateLimits: api.NewRateLimiter(api.RateLimitConfig{
+		Learn:            api.RateLimit{PerSecond: 0.1, Burst: 1},
+		LearnBytesPerDay: 1000,
+	})})
+
+	// Messages are limited like HTTP bodies, before they count against the limits
+	_, err := client.Learn(context.Background(), &cobutlerpb.LearnRequest{Text: strings.Repeat("a", api.DefaultMaxBodyBytes+1)})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected code %v for an oversized message, got %v", codes.ResourceExhausted, status.Code(err))
+	}
+
+	if _, err := client.Learn(context.Background(), &cobutlerpb.LearnRequest{Text: "hello"}); err != nil {
+		t.Fatalf("Expected the first learn to pass, got %v", err)
+	}
+	var header metadata.MD
+	_, err = client.Learn(context.Background(), &cobutlerpb.LearnRequest{Text: "hello"}, grpc.Header(&header))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected code %v over the rate, got %v", codes.ResourceExhausted, status.Code(err))
+	}
+	if got := header.Get("retry-after"); len(got) != 1 || got[0] != "10" {
+		t.Errorf("Expected retry-after 10, got %q", got)
+	}
+
+	// Predictions have their own limit
+	if _, err := client.Predict(context.Background(), &cobutlerpb.PredictRequest{Text: "hello"}); err != nil {
+		t.Errorf("Expected predicting to pass, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package syntax
+
+import "strings"
+
+// Boundaries a completion can stop at
+const (
+	// BoundaryStatement is the end of the statement the completion starts
+	BoundaryStatement = "statement"
+	// BoundaryScope is the closer of the scope the cursor is in
+	BoundaryScope = "scope"
+)
+
+// Supported reports whether the filetype has a lexer; other filetypes are prose
+func Supported(filetype string) bool {
+	_, ok := lookup(filetype)
+	return ok
+}
+
+// FindBoundary returns the offset in completion just after the first statement
+// end or closer of the cursor's scope, whichever are enabled, and which boundary
+// it is. A statement ends at a semicolon or a line break after a complete line at
+// the cursor's depth, or when a block opened by the completion is closed.
+func FindBoundary(prefix, completion, filetype string, statement, scope bool) (int, string, bool) {
+	l, ok := lookup(filetype)
+	if !ok || (!statement && !scope) {
+		return 0, "", false
+	}
+
+	base := len(l.scan(prefix, len(prefix), nil).stack)
+	text := prefix + completion
+
+	end, boundary := -1, ""
+	l.scan(text, len(prefix), func(e event) bool {
+		switch {
+		case scope && e.kind == eventClose && e.depth < base:
+			end, boundary = e.end, BoundaryScope
+		case !statement || e.depth != base:
+		case e.kind == eventSemicolon:
+			end, boundary = e.end, BoundaryStatement
+		case e.kind == eventClose && e.block:
+			end, boundary = e.end, BoundaryStatement
+		case e.kind == eventNewline && completesLine(text[len(prefix):e.end-1]):
+			end, boundary = e.end-1, BoundaryStatement
+		}
+		return end >= 0
+	})
+
+	if end < 0 {
+		return 0, "", false
+	}
+	return end - len(prefix), boundary, true
+}
+
+// completesLine reports whether the last line of text looks like a complete
+// statement rather than one that continues on the next line
+func completesLine(text string) bool {
+	line := strings.TrimSpace(text[strings.LastIndexByte(text, '\n')+1:])
+	if line == "" {
+		return false
+	}
+
+	switch line[len(line)-1] {
+	case ')', ']', '}', '"', '\'', '`':
+		return true
+	}
+	return isWordByte(line[len(line)-1])
+}
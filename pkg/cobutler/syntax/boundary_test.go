@@ -0,0 +1,78 @@
+package syntax
+
+import "testing"
+
+func TestFindBoundary(t *testing.T) {
+	tests := []struct {
+		name       string
+		filetype   string
+		prefix     string
+		completion string
+		statement  bool
+		scope      bool
+		want       string
+		boundary   string
+	}{
+		{
+			name:       "semicolons end statements",
+			filetype:   "javascript",
+			prefix:     "function f() {\n\tconst x = ",
+			completion: "compute(a; b); next();",
+			statement:  true,
+			want:       "compute(a; b);",
+			boundary:   BoundaryStatement,
+		},
+		{
+			name:       "line breaks end complete lines",
+			filetype:   "go",
+			prefix:     "func f() {\n\tx := ",
+			completion: "a +\n\t\tb\n\ty := 2",
+			statement:  true,
+			want:       "a +\n\t\tb",
+			boundary:   BoundaryStatement,
+		},
+		{
+			name:       "blocks end statements",
+			filetype:   "go",
+			prefix:     "func f() {\n\t",
+			completion: "if x {\n\t\ty()\n\t}\n\tz()",
+			statement:  true,
+			want:       "if x {\n\t\ty()\n\t}",
+			boundary:   BoundaryStatement,
+		},
+		{
+			name:       "the cursor's scope closes",
+			filetype:   "go",
+			prefix:     "func f() {\n\tx := 1\n\t",
+			completion: "return x\n}\n\nfunc g() {",
+			scope:      true,
+			want:       "return x\n}",
+			boundary:   BoundaryScope,
+		},
+		{
+			name:       "closers in strings are ignored",
+			filetype:   "lua",
+			prefix:     "local function f()\n\t",
+			completion: "print(\"end }\")\nend\nlocal y",
+			scope:      true,
+			want:       "print(\"end }\")\nend",
+			boundary:   BoundaryScope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, boundary, ok := FindBoundary(tt.prefix, tt.completion, tt.filetype, tt.statement, tt.scope)
+			if !ok {
+				t.Fatalf("Expected a boundary in %q", tt.completion)
+			}
+			if got := tt.completion[:end]; got != tt.want || boundary != tt.boundary {
+				t.Errorf("Got %q at a %s boundary, want %q at a %s boundary", got, boundary, tt.want, tt.boundary)
+			}
+		})
+	}
+
+	if _, _, ok := FindBoundary("Hello", " world. Bye", "text", true, true); ok {
+		t.Error("Expected no boundaries for prose")
+	}
+}
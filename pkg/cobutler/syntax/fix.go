@@ -0,0 +1,85 @@
+// Package syntax post-processes generated code completions. It trims a completion
+// at the last syntactically valid point and closes the scopes it opened, using a
+// lexer that knows about the strings, comments and nesting of each language.
+package syntax
+
+import "strings"
+
+// Fix returns the completion trimmed where it stops being valid after prefix and
+// with the brackets and blocks it opened closed again. Scopes that were already
+// open in the prefix are left for the user to close. Completions for filetypes
+// without a lexer are returned unchanged.
+func Fix(prefix, completion, filetype string) string {
+	l, ok := lookup(filetype)
+	if !ok {
+		return completion
+	}
+
+	fixed := l.fix(prefix, completion)
+
+	// Go completions are also checked with the Go parser
+	if filetype == "go" {
+		fixed = fixGo(l, prefix, fixed)
+	}
+
+	return fixed
+}
+
+// fix trims a completion at its first problem and closes the scopes it opened
+func (l *language) fix(prefix, completion string) string {
+	result := l.scan(prefix+completion, len(prefix), nil)
+	if result.cut >= 0 {
+		completion = strings.TrimRight(completion[:result.cut-len(prefix)], " \t\r\n")
+	}
+
+	// Close the scopes opened in the completion, innermost first
+	text := prefix + completion
+	var closers strings.Builder
+	open := result.stack
+	for len(open) > 0 && open[len(open)-1].pos >= len(prefix) {
+		s := open[len(open)-1]
+		open = open[:len(open)-1]
+
+		// Blocks spanning lines are closed on their own line at the indentation
+		// of the line that opened them
+		body := strings.TrimRight(text[s.pos+len(s.open):]+closers.String(), " \t\r\n")
+		switch {
+		case s.open == "(" || s.open == "[":
+			closers.WriteString(s.close)
+		case strings.TrimSpace(body) == "" || strings.Contains(body, "\n"):
+			closers.WriteString("\n" + indentation(text, s.pos) + s.close)
+		default:
+			closers.WriteString(" " + s.close)
+		}
+	}
+
+	if closers.Len() > 0 {
+		completion = strings.TrimRight(completion, " \t\r\n") + closers.String()
+	}
+	return completion
+}
+
+// closeScopes returns the closers for scopes, innermost first, each on its own line
+// unless it is a bracket
+func closeScopes(text string, scopes []scope) string {
+	var closers strings.Builder
+	for i := len(scopes) - 1; i >= 0; i-- {
+		s := scopes[i]
+		if s.open == "(" || s.open == "[" {
+			closers.WriteString(s.close)
+			continue
+		}
+		closers.WriteString("\n" + indentation(text, s.pos) + s.close)
+	}
+	return closers.String()
+}
+
+// indentation returns the leading whitespace of the line containing pos
+func indentation(text string, pos int) string {
+	start := strings.LastIndexByte(text[:pos], '\n') + 1
+	end := start
+	for end < len(text) && (text[end] == ' ' || text[end] == '\t') {
+		end++
+	}
+	return text[start:end]
+}
@@ -0,0 +1,120 @@
+package syntax
+
+import "testing"
+
+func TestFix(t *testing.T) {
+	tests := []struct {
+		name       string
+		filetype   string
+		prefix     string
+		completion string
+		want       string
+	}{
+		{
+			name:       "prose is left alone",
+			filetype:   "text",
+			prefix:     "Hello (",
+			completion: "world",
+			want:       "world",
+		},
+		{
+			name:       "scopes open in the prefix stay open",
+			filetype:   "go",
+			prefix:     "func main() {\n\tx := compute(",
+			completion: "a, b",
+			want:       "a, b",
+		},
+		{
+			name:       "brackets in strings are not counted",
+			filetype:   "go",
+			prefix:     "func main() {\n\tfmt.Println(",
+			completion: `"(hi" + name`,
+			want:       `"(hi" + name`,
+		},
+		{
+			name:       "blocks opened in the completion are closed",
+			filetype:   "go",
+			prefix:     "func f() {\n\t",
+			completion: "for i := range xs {\n\t\tuse(i)",
+			want:       "for i := range xs {\n\t\tuse(i)\n\t}",
+		},
+		{
+			name:       "unterminated strings are cut",
+			filetype:   "go",
+			prefix:     "func f() {\n\ts := ",
+			completion: "x + 1\n\tlog(\"oops",
+			want:       "x + 1\n\tlog()",
+		},
+		{
+			name:       "stray closers are cut",
+			filetype:   "go",
+			prefix:     "func f() {\n\tif x {\n\t\t",
+			completion: "y()\n\t}\n}\n)",
+			want:       "y()\n\t}\n}",
+		},
+		{
+			name:       "go is cut to what parses",
+			filetype:   "go",
+			prefix:     "func f() int {\n\treturn ",
+			completion: "a +",
+			want:       "a",
+		},
+		{
+			name:       "go keeps what parses before a late error",
+			filetype:   "go",
+			prefix:     "func f() int {\n\treturn ",
+			completion: "a + b + c + d +",
+			want:       "a + b + c + d",
+		},
+		{
+			name:       "go after a prefix that doesn't parse is left alone",
+			filetype:   "go",
+			prefix:     "x, y)\n",
+			completion: "foo(1) + ",
+			want:       "foo(1) + ",
+		},
+		{
+			name:       "comments are not counted",
+			filetype:   "typescript",
+			prefix:     "const s = ",
+			completion: "'{' + f(x) // )",
+			want:       "'{' + f(x) // )",
+		},
+		{
+			name:       "mismatched closers are cut",
+			filetype:   "python",
+			prefix:     "x = foo(",
+			completion: "a, [1, 2)",
+			want:       "a, [1, 2]",
+		},
+		{
+			name:       "lua blocks are closed with end",
+			filetype:   "lua",
+			prefix:     "local function f()\n\t",
+			completion: "if x then\n\t\treturn 1",
+			want:       "if x then\n\t\treturn 1\n\tend",
+		},
+		{
+			name:       "end inside a string does not close a block",
+			filetype:   "lua",
+			prefix:     "",
+			completion: `function f() print("the end")`,
+			want:       `function f() print("the end") end`,
+		},
+		{
+			name:       "ruby modifiers do not open blocks",
+			filetype:   "ruby",
+			prefix:     "def f\n  ",
+			completion: "return 1 if x\n  items.each do |i|\n    puts i",
+			want:       "return 1 if x\n  items.each do |i|\n    puts i\n  end",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fix(tt.prefix, tt.completion, tt.filetype); got != tt.want {
+				t.Errorf("Fix(%q, %q) = %q, want %q", tt.prefix, tt.completion, got, tt.want)
+			}
+		})
+	}
+}
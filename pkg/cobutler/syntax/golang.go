@@ -0,0 +1,114 @@
+package syntax
+
+import (
+	"errors"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// goWrapper turns a fragment of Go into a file the parser accepts
+type goWrapper struct {
+	head, tail string
+}
+
+// goWrappers are tried in order: the fragment as a file, as top-level
+// declarations and as statements in a function body
+var goWrappers = []goWrapper{
+	{head: "", tail: ""},
+	{head: "package p\n", tail: ""},
+	{head: "package p\nfunc _() {\n", tail: "\n}"},
+}
+
+// maxGoParses bounds how many cuts fixGo parses, so fixing a completion takes
+// time linear in its length
+const maxGoParses = 16
+
+// fixGo cuts a Go completion back to the longest version that parses after the
+// prefix, trying cuts before each of its tokens. The parser stops at the first
+// token it can't accept, so cuts that keep that token are skipped. If no version
+// parses, the prefix can't be parsed either, usually because its window starts
+// inside a declaration, and the completion is returned as the lexer fixed it.
+func fixGo(l *language, prefix, completion string) string {
+	cuts := append(goTokenStarts(prefix, completion), len(completion))
+
+	i := len(cuts) - 1
+	for parses := 0; i >= 0 && parses < maxGoParses; parses++ {
+		candidate := completion
+		if cuts[i] < len(completion) {
+			candidate = l.fix(prefix, strings.TrimRight(completion[:cuts[i]], " \t\r\n"))
+		}
+		failed := goParseError(l, prefix+candidate)
+		if failed < 0 {
+			return candidate
+		}
+
+		// Cuts that keep the token the parser failed at fail the same way
+		i--
+		for i >= 0 && cuts[i] > failed-len(prefix) {
+			i--
+		}
+	}
+
+	return completion
+}
+
+// goParseError returns -1 if text parses with one of the wrappers once the
+// scopes still open at its end are closed. Otherwise it returns the offset in
+// text of the furthest first error among the wrappers, which is past the end of
+// text when only the closed scopes fail.
+func goParseError(l *language, text string) int {
+	result := l.scan(text, len(text), nil)
+	closed := text + closeScopes(text, result.stack)
+
+	furthest := 0
+	for _, w := range goWrappers {
+		if w.head == "" && !strings.HasPrefix(strings.TrimSpace(closed), "package ") {
+			continue
+		}
+
+		src := w.head + closed + w.tail
+		_, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+		if err == nil {
+			return -1
+		}
+
+		// Errors without a position, or in the wrapper's tail, don't narrow the cuts
+		offset := len(closed)
+		var errs scanner.ErrorList
+		if errors.As(err, &errs) && len(errs) > 0 {
+			offset = min(errs[0].Pos.Offset-len(w.head), len(closed))
+		}
+		furthest = max(furthest, offset)
+	}
+	return furthest
+}
+
+// goTokenStarts returns the offsets in completion where its Go tokens start
+func goTokenStarts(prefix, completion string) []int {
+	text := prefix + completion
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(text))
+
+	var s scanner.Scanner
+	s.Init(file, []byte(text), func(token.Position, string) {}, 0)
+
+	var starts []int
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// Skip the semicolons the scanner inserts at line ends
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+
+		offset := file.Offset(pos) - len(prefix)
+		if offset >= 0 {
+			starts = append(starts, offset)
+		}
+	}
+	return starts
+}
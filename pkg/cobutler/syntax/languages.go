@@ -0,0 +1,109 @@
+package syntax
+
+// brackets are the bracket pairs shared by all supported languages
+var brackets = map[byte]byte{'(': ')', '[': ']', '{': '}'}
+
+// cLike covers languages with C comments and double or single quoted strings
+var cLike = &language{
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes: []quote{
+		{open: `"`, close: `"`, escapes: true},
+		{open: `'`, close: `'`, escapes: true},
+	},
+	brackets: brackets,
+}
+
+// languages maps editor filetypes to their lexical structure
+var languages = map[string]*language{
+	"go": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes: []quote{
+			{open: `"`, close: `"`, escapes: true},
+			{open: "`", close: "`", multiline: true},
+			{open: `'`, close: `'`, escapes: true},
+		},
+		brackets: brackets,
+	},
+	"javascript": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes: []quote{
+			{open: `"`, close: `"`, escapes: true},
+			{open: `'`, close: `'`, escapes: true},
+			{open: "`", close: "`", escapes: true, multiline: true},
+		},
+		brackets: brackets,
+	},
+	"python": {
+		lineComments: []string{"#"},
+		quotes: []quote{
+			{open: `"""`, close: `"""`, escapes: true, multiline: true},
+			{open: `'''`, close: `'''`, escapes: true, multiline: true},
+			{open: `"`, close: `"`, escapes: true},
+			{open: `'`, close: `'`, escapes: true},
+		},
+		brackets: brackets,
+	},
+	"lua": {
+		lineComments:  []string{"--"},
+		blockComments: [][2]string{{"--[[", "]]"}},
+		quotes: []quote{
+			{open: "[[", close: "]]", multiline: true},
+			{open: `"`, close: `"`, escapes: true},
+			{open: `'`, close: `'`, escapes: true},
+		},
+		brackets:  brackets,
+		blocks:    map[string]string{"function": "end", "do": "end", "then": "end", "repeat": "until"},
+		reopeners: map[string]bool{"elseif": true},
+	},
+	"ruby": {
+		lineComments:  []string{"#"},
+		blockComments: [][2]string{{"=begin", "=end"}},
+		quotes: []quote{
+			{open: `"`, close: `"`, escapes: true},
+			{open: `'`, close: `'`, escapes: true},
+		},
+		brackets: brackets,
+		blocks: map[string]string{
+			"def": "end", "class": "end", "module": "end", "begin": "end", "case": "end", "do": "end",
+		},
+		statementBlocks: map[string]string{
+			"if": "end", "unless": "end", "while": "end", "until": "end", "for": "end",
+		},
+		absorbDo: map[string]bool{"while": true, "until": true, "for": true},
+	},
+	"rust": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		// Single quotes are left out since they also start lifetimes
+		quotes:   []quote{{open: `"`, close: `"`, escapes: true, multiline: true}},
+		brackets: brackets,
+	},
+	"c":    cLike,
+	"cpp":  cLike,
+	"java": cLike,
+	"cs":   cLike,
+}
+
+// aliases maps editor filetypes to the language they are lexed as
+var aliases = map[string]string{
+	"typescript":      "javascript",
+	"javascriptreact": "javascript",
+	"typescriptreact": "javascript",
+	"jsx":             "javascript",
+	"tsx":             "javascript",
+	"kotlin":          "java",
+	"swift":           "java",
+	"objc":            "c",
+}
+
+// lookup returns the lexical structure for a filetype
+func lookup(filetype string) (*language, bool) {
+	if alias, ok := aliases[filetype]; ok {
+		filetype = alias
+	}
+	l, ok := languages[filetype]
+	return l, ok
+}
@@ -0,0 +1,305 @@
+package syntax
+
+import "strings"
+
+// quote is a string delimiter
+type quote struct {
+	open, close string
+	// escapes reports whether a backslash escapes the next character
+	escapes bool
+	// multiline reports whether the string may span lines
+	multiline bool
+}
+
+// language describes the lexical structure of a language: enough to tell code
+// from strings and comments and to follow nesting
+type language struct {
+	lineComments  []string
+	blockComments [][2]string
+	// quotes are tried in order, so longer delimiters like """ must come first
+	quotes   []quote
+	brackets map[byte]byte
+	// blocks map keywords that open a block to the keyword that closes it
+	blocks map[string]string
+	// statementBlocks only open a block at the start of a statement, like Ruby's if
+	statementBlocks map[string]string
+	// reopeners close the current block so the next keyword can open it again,
+	// like Lua's elseif before its then
+	reopeners map[string]bool
+	// absorbDo lists keywords whose block a following do on the same line belongs to
+	absorbDo map[string]bool
+}
+
+// scope is a bracket or keyword block that is open
+type scope struct {
+	open  string
+	close string
+	// pos is the offset of the opening token
+	pos int
+}
+
+// Kinds of structural events reported while scanning a completion
+const (
+	eventNewline = iota
+	eventSemicolon
+	eventClose
+)
+
+// event is a newline, semicolon or closer in the code of a completion
+type event struct {
+	kind int
+	// end is the offset just after the token
+	end int
+	// depth is the number of scopes open after the token
+	depth int
+	// block reports whether a closer ended a block rather than brackets
+	block bool
+}
+
+// scanResult is the state of the lexer after scanning a prefix and a completion
+type scanResult struct {
+	// stack holds the scopes still open, innermost last
+	stack []scope
+	// cut is the offset in the completion where it stops being valid, or -1.
+	// It points at a closer that doesn't match its scope or at a string or block
+	// comment that is never terminated.
+	cut int
+}
+
+// scan lexes text, whose first boundary bytes are the prefix and the rest the
+// completion. Problems in the prefix are skipped since it is usually a window
+// that starts in the middle of a file; the first problem in the completion
+// stops the scan. If visit is not nil it is called for the events in the
+// completion and stops the scan by returning true.
+func (l *language) scan(text string, boundary int, visit func(event) bool) scanResult {
+	var stack []scope
+	notify := func(e event) bool {
+		e.depth = len(stack)
+		return visit != nil && e.end > boundary && visit(e)
+	}
+	problem := func(pos int) (scanResult, bool) {
+		if pos < boundary {
+			return scanResult{}, false
+		}
+		return scanResult{stack: stack, cut: pos}, true
+	}
+
+	i := 0
+	for i < len(text) {
+		rest := text[i:]
+
+		if open, close, ok := l.blockComment(rest); ok {
+			end := strings.Index(rest[len(open):], close)
+			if end < 0 {
+				if result, stop := problem(i); stop {
+					return result
+				}
+				// The cursor is inside a comment
+				return scanResult{stack: stack, cut: -1}
+			}
+			i += len(open) + end + len(close)
+			continue
+		}
+
+		if hasAnyPrefix(rest, l.lineComments) {
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				break
+			}
+			// The newline itself is scanned as code since it can end a statement
+			i += end
+			continue
+		}
+
+		if q, ok := l.quote(rest); ok {
+			end, terminated := q.end(rest)
+			if !terminated {
+				if result, stop := problem(i); stop {
+					return result
+				}
+				if end == len(rest) {
+					// The cursor is inside a string
+					return scanResult{stack: stack, cut: -1}
+				}
+			}
+			i += end
+			continue
+		}
+
+		c := text[i]
+		if close, ok := l.brackets[c]; ok {
+			stack = append(stack, scope{open: string(c), close: string(close), pos: i})
+			i++
+			continue
+		}
+		if isCloser(c) {
+			if len(stack) > 0 && stack[len(stack)-1].close == string(c) {
+				stack = stack[:len(stack)-1]
+			} else if len(stack) > 0 {
+				if result, stop := problem(i); stop {
+					return result
+				}
+			}
+			// A closer with nothing open belongs to a scope before the window
+			i++
+			if notify(event{kind: eventClose, end: i, block: c == '}'}) {
+				return scanResult{stack: stack, cut: -1}
+			}
+			continue
+		}
+
+		if c == '\n' || c == ';' {
+			i++
+			kind := eventNewline
+			if c == ';' {
+				kind = eventSemicolon
+			}
+			if notify(event{kind: kind, end: i}) {
+				return scanResult{stack: stack, cut: -1}
+			}
+			continue
+		}
+
+		if isWordByte(c) && (i == 0 || !isWordByte(text[i-1])) {
+			end := i
+			for end < len(text) && isWordByte(text[end]) {
+				end++
+			}
+			word := text[i:end]
+
+			// Method calls like Ruby's x.class aren't keywords
+			if i > 0 && text[i-1] == '.' {
+				i = end
+				continue
+			}
+
+			switch {
+			case l.reopeners[word]:
+				if len(stack) > 0 && l.isBlockCloser(stack[len(stack)-1].close) {
+					stack = stack[:len(stack)-1]
+				}
+			case l.isBlockCloser(word):
+				if len(stack) > 0 && stack[len(stack)-1].close == word {
+					stack = stack[:len(stack)-1]
+				} else if len(stack) > 0 {
+					if result, stop := problem(i); stop {
+						return result
+					}
+				}
+				if notify(event{kind: eventClose, end: end, block: true}) {
+					return scanResult{stack: stack, cut: -1}
+				}
+			case l.blocks[word] != "":
+				if word == "do" && l.doIsAbsorbed(text, i, stack) {
+					break
+				}
+				stack = append(stack, scope{open: word, close: l.blocks[word], pos: i})
+			case l.statementBlocks[word] != "" && startsStatement(text, i):
+				stack = append(stack, scope{open: word, close: l.statementBlocks[word], pos: i})
+			}
+
+			i = end
+			continue
+		}
+
+		i++
+	}
+
+	return scanResult{stack: stack, cut: -1}
+}
+
+// blockComment reports whether text starts with a block comment
+func (l *language) blockComment(text string) (string, string, bool) {
+	for _, pair := range l.blockComments {
+		if strings.HasPrefix(text, pair[0]) {
+			return pair[0], pair[1], true
+		}
+	}
+	return "", "", false
+}
+
+// quote reports whether text starts with a string
+func (l *language) quote(text string) (quote, bool) {
+	for _, q := range l.quotes {
+		if strings.HasPrefix(text, q.open) {
+			return q, true
+		}
+	}
+	return quote{}, false
+}
+
+// isBlockCloser reports whether word closes a keyword block
+func (l *language) isBlockCloser(word string) bool {
+	for _, close := range l.blocks {
+		if close == word {
+			return true
+		}
+	}
+	for _, close := range l.statementBlocks {
+		if close == word {
+			return true
+		}
+	}
+	return false
+}
+
+// doIsAbsorbed reports whether the do at pos belongs to a loop opened earlier on
+// the same line, as in Ruby's "while x do"
+func (l *language) doIsAbsorbed(text string, pos int, stack []scope) bool {
+	if len(stack) == 0 || !l.absorbDo[stack[len(stack)-1].open] {
+		return false
+	}
+	return !strings.Contains(text[stack[len(stack)-1].pos:pos], "\n")
+}
+
+// end returns the length of the string at the start of text and whether it is
+// terminated. Unterminated single-line strings end at the newline.
+func (q quote) end(text string) (int, bool) {
+	for i := len(q.open); i < len(text); i++ {
+		switch {
+		case q.escapes && text[i] == '\\':
+			i++
+		case strings.HasPrefix(text[i:], q.close):
+			return i + len(q.close), true
+		case text[i] == '\n' && !q.multiline:
+			return i, false
+		}
+	}
+	return len(text), false
+}
+
+// startsStatement reports whether the word at pos is the first on its line or
+// follows an assignment or semicolon
+func startsStatement(text string, pos int) bool {
+	for i := pos - 1; i >= 0; i-- {
+		switch text[i] {
+		case ' ', '\t':
+			continue
+		case '\n', ';', '=':
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// hasAnyPrefix reports whether text starts with any of the prefixes
+func hasAnyPrefix(text string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCloser reports whether c closes a bracket
+func isCloser(c byte) bool {
+	return c == ')' || c == ']' || c == '}'
+}
+
+// isWordByte reports whether c can be part of an identifier
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
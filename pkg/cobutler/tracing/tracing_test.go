@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	handler := Middleware("/predict", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "reply attempt")
+		span.End()
+		http.Error(w, "Failed to generate reply", http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/predict", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	attempt, server := spans[0], spans[1]
+
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the trace from the traceparent header, got %s", got)
+	}
+	if server.Name() != "POST /predict" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Unexpected server span %q of kind %v", server.Name(), server.SpanKind())
+	}
+	if server.Status().Code.String() != "Error" {
+		t.Errorf("Expected the 500 to mark the span as failed, got %v", server.Status().Code)
+	}
+	if attempt.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("Expected the handler's span to be a child of the server span")
+	}
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	if _, err := Setup(t.Context(), "zipkin"); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}